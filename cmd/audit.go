@@ -0,0 +1,161 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/jedib0t/go-pretty/table"
+	. "github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
+	. "github.com/mudler/luet/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+type AuditResult struct {
+	Advisory    string `json:"advisory"`
+	Severity    string `json:"severity,omitempty"`
+	Description string `json:"description,omitempty"`
+	Package     string `json:"package"`
+	Upgrade     string `json:"upgrade,omitempty"`
+	Repository  string `json:"repository,omitempty"`
+}
+
+type AuditResults struct {
+	Advisories []AuditResult `json:"advisories"`
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Check installed packages against the repository advisories",
+	Long: `Audit cross-checks the installed packages with the security advisories
+shipped by the enabled repositories, and suggests the minimal upgrades fixing them.
+
+	$ luet audit
+
+Results can be printed as json or yaml:
+
+	$ luet audit --output json
+
+The command exits with status 1 if any installed package is affected.
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		LuetCfg.Viper.BindPFlag("system.database_path", cmd.Flags().Lookup("system-dbpath"))
+		LuetCfg.Viper.BindPFlag("system.rootfs", cmd.Flags().Lookup("system-target"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var results AuditResults
+
+		out, _ := cmd.Flags().GetString("output")
+		if out != "terminal" {
+			LuetCfg.GetLogging().SetLogLevel("error")
+		}
+
+		repos := installer.Repositories{}
+		for _, repo := range LuetCfg.SystemRepositories {
+			if !repo.Enable {
+				continue
+			}
+			repos = append(repos, installer.NewSystemRepository(repo))
+		}
+
+		inst := installer.NewLuetInstaller(
+			installer.LuetInstallerOptions{
+				Concurrency:   LuetCfg.GetGeneral().Concurrency,
+				SolverOptions: *LuetCfg.GetSolverOptions(),
+			},
+		)
+		inst.Repositories(repos)
+		synced, err := inst.SyncRepositories(false)
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
+		advisories := installer.Advisories{}
+		for _, r := range synced {
+			advisories = append(advisories, r.GetAdvisories()...)
+		}
+
+		system := &installer.System{Database: LuetCfg.GetSystemDB(), Target: LuetCfg.GetSystem().Rootfs}
+		installed, err := system.World()
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
+		t := table.NewWriter()
+		header := table.Row{"Advisory", "Severity", "Package", "Upgrade", "Repository"}
+		t.AppendHeader(header)
+
+		for _, m := range advisories.Audit(installed, synced, nil) {
+			r := AuditResult{
+				Advisory:    m.Advisory.ID,
+				Severity:    m.Advisory.Severity,
+				Description: m.Advisory.Description,
+				Package:     m.Package.HumanReadableString(),
+				Repository:  m.Repository,
+			}
+			if m.Upgrade != nil {
+				r.Upgrade = m.Upgrade.HumanReadableString()
+			}
+			results.Advisories = append(results.Advisories, r)
+			t.AppendRow(table.Row{r.Advisory, r.Severity, r.Package, r.Upgrade, r.Repository})
+		}
+
+		switch out {
+		case "yaml", "json":
+			y, err := yaml.Marshal(results)
+			if err != nil {
+				Fatal("Error: " + err.Error())
+			}
+			if out == "json" {
+				y, err = yaml.YAMLToJSON(y)
+				if err != nil {
+					Fatal("Error: " + err.Error())
+				}
+			}
+			fmt.Println(string(y))
+		default:
+			if len(results.Advisories) == 0 {
+				Info("No installed package is affected by the", len(advisories), "known advisories.")
+			} else {
+				t.SetStyle(table.StyleColoredBright)
+				Info(t.Render())
+				for _, r := range results.Advisories {
+					if r.Upgrade == "" {
+						Warning(r.Package, "is affected by", r.Advisory, "and no fixed version is available yet.")
+					}
+				}
+			}
+		}
+
+		if len(results.Advisories) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	path, err := os.Getwd()
+	if err != nil {
+		Fatal(err)
+	}
+	auditCmd.Flags().String("system-dbpath", path, "System db path")
+	auditCmd.Flags().String("system-target", path, "System rootpath")
+	auditCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	RootCmd.AddCommand(auditCmd)
+}
@@ -18,12 +18,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	helpers "github.com/mudler/luet/cmd/helpers"
 	"github.com/mudler/luet/pkg/compiler"
 	"github.com/mudler/luet/pkg/compiler/backend"
 	. "github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
 	. "github.com/mudler/luet/pkg/logger"
 	pkg "github.com/mudler/luet/pkg/package"
 	"github.com/mudler/luet/pkg/solver"
@@ -52,6 +55,11 @@ Build package revdeps:
 	
 	$ luet build --revdeps utils/yq
 
+Dependencies shared by the packages are built once, and independent ones are built in parallel,
+running at most --concurrency builds at once:
+
+	$ luet build --concurrency 4 utils/busybox utils/yq
+
 Build package without dependencies (needs the images already in the host, or either need to be available online):
 
 	$ luet build --nodeps utils/yq ...
@@ -59,6 +67,78 @@ Build package without dependencies (needs the images already in the host, or eit
 Build packages specifying multiple definition trees:
 
 	$ luet build --tree overlay/path --tree overlay/path2 utils/yq ...
+
+Build packages for another platform, the artifacts can be published in the same
+repository of the ones of the other architectures:
+
+	$ luet build --platform linux/arm64 utils/yq ...
+
+Build a variant of the packages for each values file, the artifacts and images of each variant are
+tagged with the name of the file:
+
+	$ luet build --values gcc.yaml --values clang.yaml utils/yq ...
+
+The variants can also be declared by the tree, in a matrix.yaml file at its root:
+
+	variants:
+	- name: "gcc"
+	  values: "values/gcc.yaml"
+	- name: "clang"
+	  values: "values/clang.yaml"
+
+The "use" entries of a values file are defaults for the use flags of the packages, the flags
+enabled on a package always take precedence over them.
+
+Along with each artifact a provenance document (<package>.provenance.json) is written, recording
+the images, the hashes and the definition files used by the build. It can be verified against the tree with:
+
+	$ luet tree provenance --tree overlay/path build/
+
+The output of the builds of each package is written, with timestamps, to <destination>/logs/<category>-<name>-<version>.log,
+with the variant and the architecture appended when set.
+
+Packages whose sources (definition, build specs, values, retrieved files and dependencies) didn't
+change since the artifact in the destination was built are not built again. Artifacts built from the
+same sources can also be taken from the configured repositories:
+
+	$ luet build --all --cache-repositories
+
+The sources listed in the build specs are verified against their checksums, and cached by checksum
+in the sources_cache_path of the configuration. Build using only the cached sources with:
+
+	$ luet build --offline utils/yq
+
+A build spec can split its files in subpackages, each with its own includes and excludes, and
+definition fields. They are generated by the same build of the package:
+
+	subpackages:
+	- name: "yq-doc"
+	  includes:
+	  - usr/share/doc
+
+Definitions can require, or conflict with, packages only when a use flag is enabled. The flags
+enabled are available to the build specs as {{.Values.use.<flag>}}, and recorded in the artifacts:
+
+	use_flags:
+	- "ssl"
+	requires_if:
+	  ssl:
+	  - name: "openssl"
+	    category: "libs"
+
+Enable or disable (-flag) use flags for all the packages, or for a single one:
+
+	$ luet build --use -ssl --use net/curl:ssl net/curl
+
+By default no package is built after the first failure, even the ones not depending on the failed
+package. Keep building the packages not depending on the failed ones, and write a report with the
+outcome of each build (built, reused, skipped, failed) for CI:
+
+	$ luet build --all --keep-going --report report.xml --report-format junit
+
+Build reproducible artifacts, and check that rebuilding them from scratch yields the same checksums:
+
+	$ SOURCE_DATE_EPOCH=1600000000 luet build --verify-reproducible utils/yq
 `, PreRun: func(cmd *cobra.Command, args []string) {
 		viper.BindPFlag("tree", cmd.Flags().Lookup("tree"))
 		viper.BindPFlag("destination", cmd.Flags().Lookup("destination"))
@@ -97,7 +177,7 @@ Build packages specifying multiple definition trees:
 		databaseType := viper.GetString("database")
 		compressionType := viper.GetString("compression")
 		imageRepository := viper.GetString("image-repository")
-		values := viper.GetString("values")
+		values := viper.GetStringSlice("values")
 		wait := viper.GetBool("wait")
 		push := viper.GetBool("push")
 		pull := viper.GetBool("pull")
@@ -106,6 +186,15 @@ Build packages specifying multiple definition trees:
 		onlydeps := viper.GetBool("onlydeps")
 		keepExportedImages := viper.GetBool("keep-exported-images")
 		onlyTarget, _ := cmd.Flags().GetBool("only-target-package")
+		platform, _ := cmd.Flags().GetString("platform")
+		reproducible, _ := cmd.Flags().GetBool("reproducible")
+		verifyReproducible, _ := cmd.Flags().GetBool("verify-reproducible")
+		rebuild, _ := cmd.Flags().GetBool("rebuild")
+		cacheRepositories, _ := cmd.Flags().GetBool("cache-repositories")
+		keepGoing, _ := cmd.Flags().GetBool("keep-going")
+		offline, _ := cmd.Flags().GetBool("offline")
+		reportPath, _ := cmd.Flags().GetString("report")
+		reportFormat, _ := cmd.Flags().GetString("report-format")
 		full, _ := cmd.Flags().GetBool("full")
 		concurrent, _ := cmd.Flags().GetBool("solver-concurrent")
 		var results Results
@@ -115,7 +204,6 @@ Build packages specifying multiple definition trees:
 			LuetCfg.GetLogging().SetLogLevel("error")
 		}
 		pretend, _ := cmd.Flags().GetBool("pretend")
-		compilerSpecs := compiler.NewLuetCompilationspecs()
 		var compilerBackend compiler.CompilerBackend
 		var db pkg.PackageDatabase
 		switch backendType {
@@ -154,6 +242,14 @@ Build packages specifying multiple definition trees:
 			}
 		}
 
+		uses, _ := cmd.Flags().GetStringSlice("use")
+		if err := LuetCfg.GetUseFlags().Add(uses...); err != nil {
+			Fatal("Error: " + err.Error())
+		}
+		if err := LuetCfg.GetUseFlags().ApplyDatabase(generalRecipe.GetDatabase()); err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
 		Info("Building in", dst)
 
 		stype := LuetCfg.Viper.GetString("solver.type")
@@ -168,6 +264,11 @@ Build packages specifying multiple definition trees:
 
 		Debug("Solver", LuetCfg.GetSolverOptions().CompactString())
 
+		variants, err := compiler.NewBuildMatrix(values, treePaths)
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
 		opts := compiler.NewDefaultCompilerOptions()
 		opts.SolverOptions = *LuetCfg.GetSolverOptions()
 		opts.ImageRepository = imageRepository
@@ -179,7 +280,13 @@ Build packages specifying multiple definition trees:
 		opts.Wait = wait
 		opts.KeepImageExport = keepExportedImages
 		opts.PackageTargetOnly = onlyTarget
-		opts.BuildValuesFile = values
+		opts.Platform = platform
+		opts.BackendType = backendType
+		opts.Reproducible = reproducible || verifyReproducible
+		opts.Rebuild = rebuild
+		opts.KeepGoing = keepGoing
+		opts.SourceCachePath = LuetCfg.GetSystem().GetSystemSourcesCacheDirPath()
+		opts.Offline = offline
 		var solverOpts solver.Options
 		if concurrent {
 			solverOpts = solver.Options{Type: solver.ParallelSimple, Concurrency: concurrency}
@@ -187,84 +294,117 @@ Build packages specifying multiple definition trees:
 			solverOpts = solver.Options{Type: solver.SingleCoreSimple, Concurrency: concurrency}
 		}
 
-		luetCompiler := compiler.NewLuetCompiler(compilerBackend, generalRecipe.GetDatabase(), opts, solverOpts)
-		luetCompiler.SetConcurrency(concurrency)
-		luetCompiler.SetCompressionType(compiler.CompressionImplementation(compressionType))
-		if full {
-			specs, err := luetCompiler.FromDatabase(generalRecipe.GetDatabase(), true, dst)
-			if err != nil {
-				Fatal(err.Error())
-			}
-			for _, spec := range specs {
-				Info(":package: Selecting ", spec.GetPackage().GetName(), spec.GetPackage().GetVersion())
+		var cache compiler.ArtifactCache
+		if cacheRepositories && !rebuild {
+			cache = installer.NewRepositoryArtifactCache(syncRepositories())
+		}
 
-				compilerSpecs.Add(spec)
+		var artifact []compiler.Artifact
+		var errs []error
+		report := &compiler.BuildReport{}
+		built := map[string][]compiler.Artifact{}
+		for _, variant := range variants {
+			variantOpts := *opts
+			variantOpts.BuildValuesFile = variant.Values
+			variantOpts.Variant = variant.Name
+			if variant.Name != "" {
+				Info(":gear: Building variant", variant.Name)
 			}
-		} else if !all {
-			for _, a := range args {
 
-				pack, err := helpers.ParsePackageStr(a)
+			compilerSpecs := compiler.NewLuetCompilationspecs()
+			luetCompiler := compiler.NewLuetCompiler(compilerBackend, generalRecipe.GetDatabase(), &variantOpts, solverOpts)
+			luetCompiler.SetConcurrency(concurrency)
+			luetCompiler.SetCompressionType(compiler.CompressionImplementation(compressionType))
+			if cache != nil {
+				luetCompiler.SetArtifactCache(cache)
+			}
+			if full {
+				specs, err := luetCompiler.FromDatabase(generalRecipe.GetDatabase(), true, dst)
 				if err != nil {
-					Fatal("Invalid package string ", a, ": ", err.Error())
+					Fatal(err.Error())
 				}
+				for _, spec := range specs {
+					Info(":package: Selecting ", spec.GetPackage().GetName(), spec.GetPackage().GetVersion())
 
-				spec, err := luetCompiler.FromPackage(pack)
-				if err != nil {
-					Fatal("Error: " + err.Error())
+					compilerSpecs.Add(spec)
 				}
+			} else if !all {
+				for _, a := range args {
 
-				spec.SetOutputPath(dst)
-				compilerSpecs.Add(spec)
-			}
-		} else {
-			w := generalRecipe.GetDatabase().World()
+					pack, err := helpers.ParsePackageStr(a)
+					if err != nil {
+						Fatal("Invalid package string ", a, ": ", err.Error())
+					}
 
-			for _, p := range w {
-				spec, err := luetCompiler.FromPackage(p)
-				if err != nil {
-					Fatal("Error: " + err.Error())
-				}
-				Info(":package: Selecting ", p.GetName(), p.GetVersion())
-				spec.SetOutputPath(dst)
-				compilerSpecs.Add(spec)
-			}
-		}
+					spec, err := luetCompiler.FromPackage(pack)
+					if err != nil {
+						Fatal("Error: " + err.Error())
+					}
 
-		var artifact []compiler.Artifact
-		var errs []error
-		if revdeps {
-			artifact, errs = luetCompiler.CompileWithReverseDeps(privileged, compilerSpecs)
-
-		} else if pretend {
-			toCalculate := []compiler.CompilationSpec{}
-			if full {
-				var err error
-				toCalculate, err = luetCompiler.ComputeMinimumCompilableSet(compilerSpecs.All()...)
-				if err != nil {
-					errs = append(errs, err)
+					spec.SetOutputPath(dst)
+					compilerSpecs.Add(spec)
 				}
 			} else {
-				toCalculate = compilerSpecs.All()
+				w := generalRecipe.GetDatabase().World()
+
+				for _, p := range w {
+					spec, err := luetCompiler.FromPackage(p)
+					if err != nil {
+						Fatal("Error: " + err.Error())
+					}
+					Info(":package: Selecting ", p.GetName(), p.GetVersion())
+					spec.SetOutputPath(dst)
+					compilerSpecs.Add(spec)
+				}
 			}
 
-			for _, sp := range toCalculate {
-				packs, err := luetCompiler.ComputeDepTree(sp)
-				if err != nil {
-					errs = append(errs, err)
+			var artifacts []compiler.Artifact
+			var compileErrs []error
+			if revdeps {
+				artifacts, compileErrs = luetCompiler.CompileWithReverseDeps(privileged, compilerSpecs)
+
+			} else if pretend {
+				toCalculate := []compiler.CompilationSpec{}
+				if full {
+					var err error
+					toCalculate, err = luetCompiler.ComputeMinimumCompilableSet(compilerSpecs.All()...)
+					if err != nil {
+						compileErrs = append(compileErrs, err)
+					}
+				} else {
+					toCalculate = compilerSpecs.All()
 				}
-				for _, p := range packs {
-					results.Packages = append(results.Packages,
-						PackageResult{
-							Name:       p.Package.GetName(),
-							Version:    p.Package.GetVersion(),
-							Category:   p.Package.GetCategory(),
-							Repository: "",
-							Hidden:     p.Package.IsHidden(),
-							Target:     sp.GetPackage().HumanReadableString(),
-						})
+
+				for _, sp := range toCalculate {
+					packs, err := luetCompiler.ComputeDepTree(sp)
+					if err != nil {
+						compileErrs = append(compileErrs, err)
+					}
+					for _, p := range packs {
+						results.Packages = append(results.Packages,
+							PackageResult{
+								Name:       p.Package.GetName(),
+								Version:    p.Package.GetVersion(),
+								Category:   p.Package.GetCategory(),
+								Repository: "",
+								Hidden:     p.Package.IsHidden(),
+								Target:     sp.GetPackage().HumanReadableString(),
+								Variant:    variant.Name,
+							})
+					}
 				}
+			} else {
+				artifacts, compileErrs = luetCompiler.CompileParallel(privileged, compilerSpecs)
+			}
+			if !pretend {
+				report.Merge(luetCompiler.GetBuildReport())
 			}
+			built[variant.Name] = artifacts
+			artifact = append(artifact, artifacts...)
+			errs = append(errs, compileErrs...)
+		}
 
+		if pretend {
 			y, err := yaml.Marshal(results)
 			if err != nil {
 				fmt.Printf("err: %v\n", err)
@@ -286,7 +426,14 @@ Build packages specifying multiple definition trees:
 				}
 			}
 		} else {
-			artifact, errs = luetCompiler.CompileParallel(privileged, compilerSpecs)
+			Info(fmt.Sprintf(":memo: %d built, %d reused, %d skipped, %d failed",
+				report.Count(compiler.BuildStatusBuilt), report.Count(compiler.BuildStatusReused),
+				report.Count(compiler.BuildStatusSkipped), report.Count(compiler.BuildStatusFailed)))
+			if reportPath != "" {
+				if err := writeBuildReport(report, reportPath, reportFormat); err != nil {
+					Error("Error: " + err.Error())
+				}
+			}
 		}
 		if len(errs) != 0 {
 			for _, e := range errs {
@@ -297,9 +444,127 @@ Build packages specifying multiple definition trees:
 		for _, a := range artifact {
 			Info("Artifact generated:", a.GetPath())
 		}
+
+		if verifyReproducible && !pretend {
+			for _, variant := range variants {
+				verifyOpts := *opts
+				verifyOpts.BuildValuesFile = variant.Values
+				verifyOpts.Variant = variant.Name
+				verifyOpts.NoCache = true
+				verifyOpts.PullFirst = false
+				verifyOpts.Push = false
+				verifyOpts.Rebuild = true
+				verifier := compiler.NewLuetCompiler(compilerBackend, generalRecipe.GetDatabase(), &verifyOpts, solverOpts)
+				verifier.SetConcurrency(concurrency)
+				verifier.SetCompressionType(compiler.CompressionImplementation(compressionType))
+				if err := verifyReproducibleBuild(verifier, privileged, built[variant.Name], dst); err != nil {
+					Fatal("Error: " + err.Error())
+				}
+			}
+		}
 	},
 }
 
+// writeBuildReport writes the build report in the given format (json, junit)
+func writeBuildReport(report *compiler.BuildReport, path, format string) error {
+	switch format {
+	case "json":
+		return report.WriteJSON(path)
+	case "junit":
+		return report.WriteJUnit(path)
+	}
+	return fmt.Errorf("invalid report format %s", format)
+}
+
+// syncRepositories returns the enabled repositories of the configuration
+func syncRepositories() installer.Repositories {
+	repos := installer.Repositories{}
+	for _, repo := range LuetCfg.SystemRepositories {
+		if !repo.Enable {
+			continue
+		}
+		repos = append(repos, installer.NewSystemRepository(repo))
+	}
+
+	inst := installer.NewLuetInstaller(
+		installer.LuetInstallerOptions{
+			Concurrency:   LuetCfg.GetGeneral().Concurrency,
+			SolverOptions: *LuetCfg.GetSolverOptions(),
+		},
+	)
+	inst.Repositories(repos)
+	synced, err := inst.SyncRepositories(false)
+	if err != nil {
+		Fatal("Error: " + err.Error())
+	}
+	return synced
+}
+
+// verifyReproducibleBuild rebuilds the artifacts from scratch in a temporary
+// folder, and compares their checksums with the ones in dst.
+func verifyReproducibleBuild(c compiler.Compiler, keepPermissions bool, artifacts []compiler.Artifact, dst string) error {
+	tmpdir, err := LuetCfg.GetSystem().TempDir("reproducible")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	Info(":recycle: Rebuilding the artifacts to verify they are reproducible")
+	specs := compiler.NewLuetCompilationspecs()
+	for _, a := range artifacts {
+		spec, err := c.FromPackage(a.GetCompileSpec().GetPackage())
+		if err != nil {
+			return err
+		}
+		spec.SetOutputPath(tmpdir)
+		specs.Add(spec)
+	}
+	if _, errs := c.CompileParallel(keepPermissions, specs); len(errs) != 0 {
+		for _, e := range errs {
+			Error("Error: " + e.Error())
+		}
+		return fmt.Errorf("rebuild failed")
+	}
+
+	files, err := ioutil.ReadDir(tmpdir)
+	if err != nil {
+		return err
+	}
+	mismatches := 0
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".metadata.yaml") {
+			continue
+		}
+		rebuilt, err := loadArtifactMetadata(filepath.Join(tmpdir, f.Name()))
+		if err != nil {
+			return err
+		}
+		original, err := loadArtifactMetadata(filepath.Join(dst, f.Name()))
+		if err != nil {
+			return err
+		}
+		name := rebuilt.GetCompileSpec().GetPackage().HumanReadableString()
+		if err := rebuilt.GetChecksums().Compare(original.GetChecksums()); err != nil {
+			Error(":x:", name, "is not reproducible")
+			mismatches++
+			continue
+		}
+		Info(":white_check_mark:", name, "is reproducible")
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d artifacts are not reproducible", mismatches)
+	}
+	return nil
+}
+
+func loadArtifactMetadata(path string) (compiler.Artifact, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.NewPackageArtifactFromYaml(dat)
+}
+
 func init() {
 	path, err := os.Getwd()
 	if err != nil {
@@ -312,10 +577,11 @@ func init() {
 	buildCmd.Flags().Bool("revdeps", false, "Build with revdeps")
 	buildCmd.Flags().Bool("all", false, "Build all specfiles in the tree")
 	buildCmd.Flags().Bool("full", false, "Build all packages (optimized)")
-	buildCmd.Flags().String("values", "", "Build values file to interpolate with each package")
+	buildCmd.Flags().StringSlice("use", []string{}, "Use flags to enable, or disable with -flag, for all packages or for one with category/name:flag")
+	buildCmd.Flags().StringSlice("values", []string{}, "Build values file to interpolate with each package, a variant is built for each one if more than one is given")
 
 	buildCmd.Flags().String("destination", path, "Destination folder")
-	buildCmd.Flags().String("compression", "none", "Compression alg: none, gzip, zstd")
+	buildCmd.Flags().String("compression", "none", "Compression alg: none, gzip, zstd, xz, lz4")
 	buildCmd.Flags().String("image-repository", "luet/cache", "Default base image string for generated image")
 	buildCmd.Flags().Bool("push", false, "Push images to a hub")
 	buildCmd.Flags().Bool("pull", false, "Pull images from a hub")
@@ -331,6 +597,16 @@ func init() {
 	buildCmd.Flags().Int("solver-attempts", 9000, "Solver maximum attempts")
 	buildCmd.Flags().Bool("solver-concurrent", false, "Use concurrent solver (experimental)")
 
+	buildCmd.Flags().String("platform", "", "Target platform of the build (e.g. linux/arm64), artifacts are tagged with its architecture")
+	buildCmd.Flags().Bool("reproducible", false, "Generate reproducible archives, with mtimes clamped to $SOURCE_DATE_EPOCH")
+	buildCmd.Flags().Bool("verify-reproducible", false, "Rebuild the artifacts without cache and check they are identical (implies --reproducible)")
+	buildCmd.Flags().Bool("rebuild", false, "Build the packages even if an artifact built from the same sources is available")
+	buildCmd.Flags().Bool("cache-repositories", false, "Reuse the artifacts built from the same sources found in the configured repositories")
+
+	buildCmd.Flags().Bool("offline", false, "Use only the sources already in the sources cache, without downloading them")
+	buildCmd.Flags().Bool("keep-going", false, "Keep building after a failure, skipping only the packages depending on the failed ones (by default no package is built after the first failure)")
+	buildCmd.Flags().String("report", "", "Write a report with the outcome of the build of each package to the given file")
+	buildCmd.Flags().String("report-format", "json", "Format of the build report: json, junit")
 	buildCmd.Flags().Bool("pretend", false, "Just print what packages will be compiled")
 
 	buildCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
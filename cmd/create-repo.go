@@ -20,6 +20,7 @@ import (
 	"github.com/mudler/luet/pkg/compiler"
 	. "github.com/mudler/luet/pkg/config"
 	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/mudler/luet/pkg/license"
 	. "github.com/mudler/luet/pkg/logger"
 	pkg "github.com/mudler/luet/pkg/package"
 
@@ -46,6 +47,44 @@ Change compression method:
 	
 	$ luet create-repo --tree-compression gzip --meta-compression gzip
 
+Publish deltas for the last 5 revisions, so cached repositories can sync incrementally:
+
+	$ luet create-repo --deltas 5 ...
+
+Publish also the tree in the compact format, which is faster to load for newer clients:
+
+	$ luet create-repo --compact-tree ...
+
+Security advisories found in the "advisories" folder of the trees are shipped
+with the repository, and checked against the installed packages by "luet audit".
+Each advisory is a yaml file:
+
+	id: LUET-2020-0001
+	severity: high
+	description: Remote code execution in foo
+	affected:
+	- category: app
+	  name: foo
+	  version: "<1.2"
+	fixed:
+	- category: app
+	  name: foo
+	  version: "1.2"
+
+News items found in the "news" folder of the trees are shipped as well, and
+shown by "luet upgrade" and "luet news" to the users having affected packages
+installed. Items without affected packages are shown to everyone:
+
+	id: 2020-10-01-foo-migration
+	date: "2020-10-01"
+	title: foo 2.0 needs a manual migration
+	body: |
+	  Run foo-migrate after upgrading.
+	affected:
+	- category: app
+	  name: foo
+	  version: ">=2.0"
+
 Create a repository from the metadata description defined in the luet.yaml config file:
 
 	$ luet create-repo --repo repository1
@@ -64,6 +103,8 @@ Create a repository from the metadata description defined in the luet.yaml confi
 		viper.BindPFlag("meta-filename", cmd.Flags().Lookup("meta-filename"))
 		viper.BindPFlag("reset-revision", cmd.Flags().Lookup("reset-revision"))
 		viper.BindPFlag("repo", cmd.Flags().Lookup("repo"))
+		viper.BindPFlag("deltas", cmd.Flags().Lookup("deltas"))
+		viper.BindPFlag("compact-tree", cmd.Flags().Lookup("compact-tree"))
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
@@ -82,6 +123,8 @@ Create a repository from the metadata description defined in the luet.yaml confi
 		metatype := viper.GetString("meta-compression")
 		metaName := viper.GetString("meta-filename")
 		source_repo := viper.GetString("repo")
+		deltas := viper.GetInt("deltas")
+		compact := viper.GetBool("compact-tree")
 
 		treeFile := installer.NewDefaultTreeRepositoryFile()
 		metaFile := installer.NewDefaultMetaRepositoryFile()
@@ -118,6 +161,11 @@ Create a repository from the metadata description defined in the luet.yaml confi
 			Fatal("Error: " + err.Error())
 		}
 
+		err = license.NewPolicy(LuetCfg.GetLicensePolicy()).Enforce(repo.GetTree().GetDatabase().World())
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
 		if treetype != "" {
 			treeFile.SetCompressionType(compiler.CompressionImplementation(treetype))
 		}
@@ -136,6 +184,15 @@ Create a repository from the metadata description defined in the luet.yaml confi
 
 		repo.SetRepositoryFile(installer.REPOFILE_TREE_KEY, treeFile)
 		repo.SetRepositoryFile(installer.REPOFILE_META_KEY, metaFile)
+		repo.SetDeltaRevisions(deltas)
+
+		if compact {
+			compactFile := installer.NewDefaultCompactTreeRepositoryFile()
+			if treetype != "" {
+				compactFile.SetCompressionType(compiler.CompressionImplementation(treetype))
+			}
+			repo.SetRepositoryFile(installer.REPOFILE_COMPACT_TREE_KEY, compactFile)
+		}
 
 		err = repo.Write(dst, reset)
 		if err != nil {
@@ -158,10 +215,12 @@ func init() {
 	createrepoCmd.Flags().String("type", "disk", "Repository type (disk)")
 	createrepoCmd.Flags().Bool("reset-revision", false, "Reset repository revision.")
 	createrepoCmd.Flags().String("repo", "", "Use repository defined in configuration.")
+	createrepoCmd.Flags().Bool("compact-tree", false, "Publish also the tree in the compact format, which is faster to load")
+	createrepoCmd.Flags().Int("deltas", 0, "Number of revisions for which deltas are published (0 disables deltas)")
 
-	createrepoCmd.Flags().String("tree-compression", "gzip", "Compression alg: none, gzip, zstd")
+	createrepoCmd.Flags().String("tree-compression", "gzip", "Compression alg: none, gzip, zstd, xz, lz4")
 	createrepoCmd.Flags().String("tree-filename", installer.TREE_TARBALL, "Repository tree filename")
-	createrepoCmd.Flags().String("meta-compression", "none", "Compression alg: none, gzip, zstd")
+	createrepoCmd.Flags().String("meta-compression", "none", "Compression alg: none, gzip, zstd, xz, lz4")
 	createrepoCmd.Flags().String("meta-filename", installer.REPOSITORY_METAFILE+".tar", "Repository metadata filename")
 
 	RootCmd.AddCommand(createrepoCmd)
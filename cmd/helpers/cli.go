@@ -60,19 +60,26 @@ func ParsePackageStr(p string) (*pkg.DefaultPackage, error) {
 		ver := ">=0"
 		cat := ""
 		name := ""
+		slot := ""
 
 		if strings.Contains(p, "@") {
 			packageinfo := strings.Split(p, "@")
 			ver = packageinfo[1]
-			cat, name = packageData(packageinfo[0])
-		} else {
-			cat, name = packageData(p)
+			p = packageinfo[0]
 		}
+		// A slot can be given as category/name:slot
+		if strings.Contains(p, ":") {
+			packageinfo := strings.SplitN(p, ":", 2)
+			slot = packageinfo[1]
+			p = packageinfo[0]
+		}
+		cat, name = packageData(p)
 
 		return &pkg.DefaultPackage{
 			Name:     name,
 			Category: cat,
 			Version:  ver,
+			Slot:     slot,
 			Uri:      make([]string, 0),
 		}, nil
 	}
@@ -108,6 +115,10 @@ func ParsePackageStr(p string) (*pkg.DefaultPackage, error) {
 		Version:  pkgVersion,
 		Uri:      make([]string, 0),
 	}
+	// The gentoo parser defaults to slot 0
+	if strings.Contains(strings.ReplaceAll(p, "::", ""), ":") {
+		pack.Slot = gp.Slot
+	}
 
 	return pack, nil
 }
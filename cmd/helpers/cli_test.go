@@ -66,5 +66,29 @@ var _ = Describe("CLI Helpers", func() {
 			Expect(pack.GetCategory()).To(Equal("cat"))
 			Expect(pack.GetVersion()).To(Equal("1.2"))
 		})
+		It("accept slots", func() {
+			pack, err := ParsePackageStr("cat/foo:3")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pack.GetName()).To(Equal("foo"))
+			Expect(pack.GetCategory()).To(Equal("cat"))
+			Expect(pack.GetVersion()).To(Equal(">=0"))
+			Expect(pack.GetSlot()).To(Equal("3"))
+
+			pack, err = ParsePackageStr("cat/foo:3@>=3.9")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pack.GetName()).To(Equal("foo"))
+			Expect(pack.GetVersion()).To(Equal(">=3.9"))
+			Expect(pack.GetSlot()).To(Equal("3"))
+
+			pack, err = ParsePackageStr("=cat/foo-1.2:1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pack.GetName()).To(Equal("foo"))
+			Expect(pack.GetVersion()).To(Equal("1.2"))
+			Expect(pack.GetSlot()).To(Equal("1"))
+
+			pack, err = ParsePackageStr("=cat/foo-1.2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pack.GetSlot()).To(Equal(""))
+		})
 	})
 })
@@ -0,0 +1,76 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_helpers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/config"
+	fileHelpers "github.com/mudler/luet/pkg/helpers"
+	installer "github.com/mudler/luet/pkg/installer"
+)
+
+// LoadRepository returns the repository referenced by a local folder, the name
+// of a configured repository or an url, and a function to clean it up.
+// Remote repositories are filtered for the system architecture and variant,
+// unless all is set. Local folders are always loaded with all the artifacts.
+func LoadRepository(ref string, all bool) (installer.Repository, func(), error) {
+	dir := strings.TrimPrefix(ref, "file://")
+	if fileHelpers.Exists(filepath.Join(dir, installer.REPOSITORY_SPECFILE)) {
+		r, err := installer.LoadLocalRepository(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, func() {
+			os.RemoveAll(r.GetTreePath())
+			os.RemoveAll(r.GetMetaPath())
+		}, nil
+	}
+
+	var repo *config.LuetRepository
+	for idx := range config.LuetCfg.SystemRepositories {
+		if config.LuetCfg.SystemRepositories[idx].Name == ref {
+			repo = &config.LuetCfg.SystemRepositories[idx]
+			break
+		}
+	}
+	if repo == nil {
+		if !strings.HasPrefix(ref, "http://") && !strings.HasPrefix(ref, "https://") {
+			return nil, nil, fmt.Errorf("%s is not a repository folder, url or name", ref)
+		}
+		repo = config.NewLuetRepository(ref, "http", "", []string{ref}, 1, true, false)
+	}
+
+	system := installer.NewSystemRepository(*repo)
+	sync := system.Sync
+	if all {
+		sync = system.SyncAll
+	}
+	r, err := sync(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, func() {
+		if !repo.Cached {
+			os.RemoveAll(r.GetTreePath())
+			os.RemoveAll(r.GetMetaPath())
+		}
+	}, nil
+}
@@ -43,6 +43,10 @@ To not install deps of a package:
 	
 	$ luet install --nodeps utils/busybox ...
 
+To install a version in a slot, side by side with the ones in other slots:
+	
+	$ luet install -y lang/python:3.9 ...
+
 To force install a package:
 	
 	$ luet install --force utils/busybox ...
@@ -104,6 +108,11 @@ To force install a package:
 
 		Debug("Solver", LuetCfg.GetSolverOptions().CompactString())
 
+		uses, _ := cmd.Flags().GetStringSlice("use")
+		if err := LuetCfg.GetUseFlags().Add(uses...); err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
 		// Load config protect configs
 		installer.LoadConfigProtectConfs(LuetCfg)
 
@@ -142,6 +151,7 @@ func init() {
 	installCmd.Flags().Bool("force", false, "Skip errors and keep going (potentially harmful)")
 	installCmd.Flags().Bool("solver-concurrent", false, "Use concurrent solver (experimental)")
 	installCmd.Flags().BoolP("yes", "y", false, "Don't ask questions")
+	installCmd.Flags().StringSlice("use", []string{}, "Use flags to enable, or disable with -flag, for all packages or for one with category/name:flag")
 
 	RootCmd.AddCommand(installCmd)
 }
@@ -0,0 +1,137 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_license
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	helpers "github.com/mudler/luet/cmd/helpers"
+	. "github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/mudler/luet/pkg/license"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+
+	"github.com/ghodss/yaml"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+type LicenseReport struct {
+	Licenses   []license.Usage `json:"licenses"`
+	Violations []string        `json:"violations,omitempty"`
+}
+
+func NewLicenseReportCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "report [OPTIONS]",
+		Short: "Report the licenses of the installed packages or of a repository",
+		Long: `Lists the licenses declared by the packages, along with the packages declaring them,
+and the packages violating the license policy of the configuration.
+
+	$ luet license report
+	$ luet license report --repository my-repo -o json
+
+With --check the command exits with a non-zero status if any package violates the policy.
+`,
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			LuetCfg.Viper.BindPFlag("system.database_path", cmd.Flags().Lookup("system-dbpath"))
+			LuetCfg.Viper.BindPFlag("system.rootfs", cmd.Flags().Lookup("system-target"))
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var packs pkg.Packages
+			var err error
+
+			ref, _ := cmd.Flags().GetString("repository")
+			check, _ := cmd.Flags().GetBool("check")
+			out, _ := cmd.Flags().GetString("output")
+			if out != "terminal" {
+				LuetCfg.GetLogging().SetLogLevel("error")
+			}
+
+			if ref != "" {
+				repo, cleanup, loadErr := helpers.LoadRepository(ref, false)
+				if loadErr != nil {
+					Fatal("Error: " + loadErr.Error())
+				}
+				defer cleanup()
+				packs = repo.GetTree().GetDatabase().World()
+			} else {
+				system := &installer.System{Database: LuetCfg.GetSystemDB(), Target: LuetCfg.GetSystem().Rootfs}
+				packs, err = system.World()
+				if err != nil {
+					Fatal("Error: " + err.Error())
+				}
+			}
+
+			report := LicenseReport{Licenses: license.Report(packs)}
+			for _, v := range license.NewPolicy(LuetCfg.GetLicensePolicy()).Check(packs) {
+				report.Violations = append(report.Violations, v.String())
+			}
+
+			switch out {
+			case "yaml", "json":
+				y, err := yaml.Marshal(report)
+				if err != nil {
+					Fatal("Error: " + err.Error())
+				}
+				if out == "json" {
+					y, err = yaml.YAMLToJSON(y)
+					if err != nil {
+						Fatal("Error: " + err.Error())
+					}
+				}
+				fmt.Println(string(y))
+			default:
+				t := table.NewWriter()
+				t.AppendHeader(table.Row{"License", "Packages"})
+				for _, u := range report.Licenses {
+					l := u.License
+					if l == "" {
+						l = "(none)"
+					}
+					t.AppendRow(table.Row{l, strings.Join(u.Packages, "\n")})
+				}
+				t.SetStyle(table.StyleColoredBright)
+				Info(t.Render())
+
+				for _, v := range report.Violations {
+					Warning(":scroll: License policy:", v)
+				}
+			}
+
+			if check && len(report.Violations) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		Fatal(err)
+	}
+	ans.Flags().String("system-dbpath", path, "System db path")
+	ans.Flags().String("system-target", path, "System rootpath")
+	ans.Flags().String("repository", "", "Report the packages of a repository (folder, url or name) instead of the installed ones")
+	ans.Flags().Bool("check", false, "Exit with a non-zero status if any package violates the license policy")
+	ans.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	return ans
+}
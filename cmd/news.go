@@ -0,0 +1,44 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	. "github.com/mudler/luet/cmd/news"
+
+	"github.com/spf13/cobra"
+)
+
+var newsGroupCmd = &cobra.Command{
+	Use:   "news [command] [OPTIONS]",
+	Short: "Read the news of the repositories",
+	Long: `Repositories can ship news items announcing changes which need the attention
+of the users, like manual migrations. Items relevant for the installed packages
+are also shown by upgrade until they are read.
+
+	$ luet news list
+	$ luet news read <id>
+`,
+}
+
+func init() {
+	RootCmd.AddCommand(newsGroupCmd)
+
+	newsGroupCmd.AddCommand(
+		NewNewsListCommand(),
+		NewNewsReadCommand(),
+	)
+}
@@ -0,0 +1,82 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_news
+
+import (
+	"os"
+
+	. "github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+
+	"github.com/spf13/cobra"
+)
+
+func addSystemFlags(cmd *cobra.Command) {
+	path, err := os.Getwd()
+	if err != nil {
+		Fatal(err)
+	}
+	cmd.Flags().String("system-dbpath", path, "System db path")
+	cmd.Flags().String("system-target", path, "System rootpath")
+}
+
+func bindSystemFlags(cmd *cobra.Command) {
+	LuetCfg.Viper.BindPFlag("system.database_path", cmd.Flags().Lookup("system-dbpath"))
+	LuetCfg.Viper.BindPFlag("system.rootfs", cmd.Flags().Lookup("system-target"))
+}
+
+// searchNews syncs the enabled repositories and returns their news items,
+// along with the state of the ones already read. If all is false, only the
+// items relevant for the installed packages are returned.
+func searchNews(all bool) ([]installer.NewsMatch, *installer.NewsState) {
+	repos := installer.Repositories{}
+	for _, repo := range LuetCfg.SystemRepositories {
+		if !repo.Enable {
+			continue
+		}
+		repos = append(repos, installer.NewSystemRepository(repo))
+	}
+
+	inst := installer.NewLuetInstaller(
+		installer.LuetInstallerOptions{
+			Concurrency:   LuetCfg.GetGeneral().Concurrency,
+			SolverOptions: *LuetCfg.GetSolverOptions(),
+		},
+	)
+	inst.Repositories(repos)
+	synced, err := inst.SyncRepositories(false)
+	if err != nil {
+		Fatal("Error: " + err.Error())
+	}
+
+	var installed pkg.Packages
+	if !all {
+		system := &installer.System{Database: LuetCfg.GetSystemDB(), Target: LuetCfg.GetSystem().Rootfs}
+		installed, err = system.World()
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+	}
+
+	state, err := installer.LoadNewsState()
+	if err != nil {
+		Fatal("Error: " + err.Error())
+	}
+	return synced.SearchNews(installed, state), state
+}
@@ -0,0 +1,112 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_news
+
+import (
+	"fmt"
+
+	. "github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/ghodss/yaml"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+type NewsResult struct {
+	ID         string `json:"id"`
+	Date       string `json:"date"`
+	Title      string `json:"title"`
+	Repository string `json:"repository"`
+	Read       bool   `json:"read"`
+}
+
+type NewsResults struct {
+	News []NewsResult `json:"news"`
+}
+
+func NewNewsListCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "list [OPTIONS]",
+		Short: "List the news relevant for the installed packages",
+		Args:  cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindSystemFlags(cmd)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var results NewsResults
+
+			all, _ := cmd.Flags().GetBool("all")
+			unread, _ := cmd.Flags().GetBool("unread")
+			out, _ := cmd.Flags().GetString("output")
+			if out != "terminal" {
+				LuetCfg.GetLogging().SetLogLevel("error")
+			}
+
+			matches, _ := searchNews(all)
+
+			t := table.NewWriter()
+			t.AppendHeader(table.Row{"ID", "Date", "Title", "Repository", "Read"})
+			for _, m := range matches {
+				if unread && m.Read {
+					continue
+				}
+				results.News = append(results.News, NewsResult{
+					ID:         m.Item.ID,
+					Date:       m.Item.Date,
+					Title:      m.Item.Title,
+					Repository: m.Repository,
+					Read:       m.Read,
+				})
+				read := ""
+				if m.Read {
+					read = "yes"
+				}
+				t.AppendRow(table.Row{m.Item.ID, m.Item.Date, m.Item.Title, m.Repository, read})
+			}
+
+			switch out {
+			case "yaml", "json":
+				y, err := yaml.Marshal(results)
+				if err != nil {
+					Fatal("Error: " + err.Error())
+				}
+				if out == "json" {
+					y, err = yaml.YAMLToJSON(y)
+					if err != nil {
+						Fatal("Error: " + err.Error())
+					}
+				}
+				fmt.Println(string(y))
+			default:
+				if len(results.News) == 0 {
+					Info("No news.")
+					return
+				}
+				t.SetStyle(table.StyleColoredBright)
+				Info(t.Render())
+			}
+		},
+	}
+
+	addSystemFlags(ans)
+	ans.Flags().Bool("all", false, "Show also the news not relevant for the installed packages")
+	ans.Flags().Bool("unread", false, "Show only the news not read yet")
+	ans.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	return ans
+}
@@ -0,0 +1,85 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_news
+
+import (
+	"fmt"
+
+	. "github.com/mudler/luet/pkg/logger"
+
+	. "github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+)
+
+func NewNewsReadCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "read [id] [OPTIONS]",
+		Short: "Read news items and mark them as read",
+		Long: `Prints the given news items, or all the unread ones relevant for the
+installed packages if no id is given, and marks them as read.
+
+	$ luet news read
+	$ luet news read 2020-10-01-openssl-migration
+`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			bindSystemFlags(cmd)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			matches, state := searchNews(len(args) > 0)
+
+			ids := map[string]bool{}
+			for _, a := range args {
+				ids[a] = true
+			}
+
+			shown := 0
+			for _, m := range matches {
+				if len(args) > 0 && !ids[m.Item.ID] {
+					continue
+				}
+				if len(args) == 0 && m.Read {
+					continue
+				}
+				delete(ids, m.Item.ID)
+
+				fmt.Println(Bold(m.Item.Title).String())
+				fmt.Println(Yellow(m.Item.Date + " - " + m.Repository + " - " + m.Item.ID).String())
+				fmt.Println()
+				fmt.Println(m.Item.Body)
+				fmt.Println()
+
+				state.MarkRead(m.Repository, m.Item.ID)
+				shown++
+			}
+
+			for id := range ids {
+				Warning("News item", id, "not found")
+			}
+			if shown == 0 {
+				Info("No unread news.")
+				return
+			}
+			if err := state.Save(); err != nil {
+				Fatal("Error: " + err.Error())
+			}
+		},
+	}
+
+	addSystemFlags(ans)
+
+	return ans
+}
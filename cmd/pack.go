@@ -92,7 +92,7 @@ func init() {
 	}
 	packCmd.Flags().String("source", path, "Source folder")
 	packCmd.Flags().String("destination", path, "Destination folder")
-	packCmd.Flags().String("compression", "gzip", "Compression alg: none, gzip")
+	packCmd.Flags().String("compression", "gzip", "Compression alg: none, gzip, zstd, xz, lz4")
 
 	RootCmd.AddCommand(packCmd)
 }
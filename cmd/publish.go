@@ -0,0 +1,111 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	"encoding/base64"
+	"strings"
+
+	. "github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/mudler/luet/pkg/installer/client"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/spf13/cobra"
+)
+
+var publishCmd = &cobra.Command{
+	Use:   "publish <artifact.tar.*> <metadata.yaml>",
+	Short: "Publish an artifact to a repository",
+	Long: `Publish adds a package built with "luet build" or "luet pack" to a repository.
+
+The artifact checksums are validated against the metadata file, then the
+repository index is updated in place, without regenerating it from scratch.
+
+Publish to a repository served by "luet serve-repo --upload":
+
+	$ luet publish foo-bar-1.0.package.tar.gz foo-bar-1.0.metadata.yaml --to https://repo.example.com --auth-token mytoken
+
+Publish to a local repository folder:
+
+	$ luet publish foo-bar-1.0.package.tar.gz foo-bar-1.0.metadata.yaml --to /srv/repo
+
+The destination can also be the name of a repository in the luet config,
+in which case its urls and authentication are used.
+
+Packages not yet in the repository tree are published along with their
+definition from the source tree, which holds their runtime dependencies:
+
+	$ luet publish foo-bar-1.0.package.tar.gz foo-bar-1.0.metadata.yaml --definition tree/foo/bar/definition.yaml --to /srv/repo
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		token, _ := cmd.Flags().GetString("auth-token")
+		basic, _ := cmd.Flags().GetString("auth-basic")
+		definition, _ := cmd.Flags().GetString("definition")
+
+		if to == "" {
+			Fatal("You must specify a destination with --to")
+		}
+
+		data := client.RepoData{Urls: []string{to}, Authentication: map[string]string{}}
+		for _, r := range LuetCfg.SystemRepositories {
+			if r.Name == to {
+				data = client.RepoData{Urls: r.Urls, Authentication: r.Authentication, Http: r.Http}
+				break
+			}
+		}
+		if token != "" {
+			data.Authentication = map[string]string{"token": token}
+		} else if basic != "" {
+			data.Authentication = map[string]string{"basic": base64.StdEncoding.EncodeToString([]byte(basic))}
+		}
+
+		if len(data.Urls) == 0 {
+			Fatal("No url found for ", to)
+		}
+
+		// The provenance document is expected next to the metadata file
+		provenance, err := installer.ProvenanceFile(args[1])
+		if err != nil {
+			Fatal("Failed reading ", args[1], ": ", err.Error())
+		}
+
+		dst := data.Urls[0]
+		if strings.HasPrefix(dst, "http://") || strings.HasPrefix(dst, "https://") {
+			err := client.NewHttpClient(data).Upload(args[0], args[1], provenance, definition)
+			if err != nil {
+				Fatal("Failed publishing ", args[0], ": ", err.Error())
+			}
+		} else {
+			_, err := installer.PublishArtifact(strings.TrimPrefix(dst, "file://"), args[0], args[1], provenance, definition)
+			if err != nil {
+				Fatal("Failed publishing ", args[0], ": ", err.Error())
+			}
+		}
+
+		Info("Published", args[0], "to", dst)
+	},
+}
+
+func init() {
+	publishCmd.Flags().String("to", "", "Repository url, folder or name")
+	publishCmd.Flags().String("auth-token", "", "Authentication token")
+	publishCmd.Flags().String("auth-basic", "", "Basic auth credentials (user:password)")
+	publishCmd.Flags().String("definition", "", "Definition of the package in the source tree, required if the repository tree doesn't have it")
+
+	RootCmd.AddCommand(publishCmd)
+}
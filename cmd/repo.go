@@ -33,5 +33,7 @@ func init() {
 	repoGroupCmd.AddCommand(
 		NewRepoListCommand(),
 		NewRepoUpdateCommand(),
+		NewRepoPromoteCommand(),
+		NewRepoDiffCommand(),
 	)
 }
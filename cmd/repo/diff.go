@@ -0,0 +1,114 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_repo
+
+import (
+	"fmt"
+	"strings"
+
+	helpers "github.com/mudler/luet/cmd/helpers"
+	. "github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/ghodss/yaml"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+func NewRepoDiffCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "diff <old> <new> [OPTIONS]",
+		Short: "Show the package changes between two repositories.",
+		Long: `Compares two repositories, and lists the packages added, removed, upgraded
+and downgraded, and the ones whose definition (requires, conflicts, provides,
+labels) or artifact changed without a version bump.
+
+Repositories can be local folders, urls, or names of the configured repositories.`,
+		Example: `
+# Review what a create-repo run is about to publish
+$> luet repo diff https://repo.example.com /srv/build/repo
+
+# Release notes between two snapshots, as json
+$> luet repo diff /srv/repo-2020-10 /srv/repo-2020-11 --output json
+`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			out, _ := cmd.Flags().GetString("output")
+			if out != "terminal" {
+				LuetCfg.GetLogging().SetLogLevel("error")
+			}
+
+			// Artifacts of all the architectures and variants are compared
+			from, cleanFrom, err := helpers.LoadRepository(args[0], true)
+			if err != nil {
+				Fatal("Error loading ", args[0], ": ", err.Error())
+			}
+			defer cleanFrom()
+			to, cleanTo, err := helpers.LoadRepository(args[1], true)
+			if err != nil {
+				Fatal("Error loading ", args[1], ": ", err.Error())
+			}
+			defer cleanTo()
+
+			diff := installer.DiffRepositories(from, to, nil)
+
+			switch out {
+			case "yaml", "json":
+				y, err := yaml.Marshal(diff)
+				if err != nil {
+					Fatal("Error: " + err.Error())
+				}
+				if out == "json" {
+					y, err = yaml.YAMLToJSON(y)
+					if err != nil {
+						Fatal("Error: " + err.Error())
+					}
+				}
+				fmt.Println(string(y))
+			default:
+				if diff.Empty() {
+					Info("No changes between revision", diff.OldRevision, "and", diff.NewRevision)
+					return
+				}
+				t := table.NewWriter()
+				t.AppendHeader(table.Row{"Change", "Package", "Old", "New", "Details"})
+				for _, c := range []struct {
+					kind    string
+					changes []installer.PackageChange
+				}{
+					{"added", diff.Added},
+					{"removed", diff.Removed},
+					{"upgraded", diff.Upgraded},
+					{"downgraded", diff.Downgraded},
+					{"changed", diff.Changed},
+				} {
+					for _, p := range c.changes {
+						t.AppendRow(table.Row{c.kind, p.Package, p.Old, p.New, strings.Join(p.Changes, ", ")})
+					}
+				}
+				t.SetStyle(table.StyleColoredBright)
+				Info(fmt.Sprintf("Changes from revision %d to %d:", diff.OldRevision, diff.NewRevision))
+				Info(t.Render())
+			}
+		},
+	}
+
+	ans.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	return ans
+}
@@ -0,0 +1,83 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_repo
+
+import (
+	helpers "github.com/mudler/luet/cmd/helpers"
+	installer "github.com/mudler/luet/pkg/installer"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+
+	"github.com/spf13/cobra"
+)
+
+func NewRepoPromoteCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "promote --from <dir> --to <dir> <pkg1> <pkg2> ...",
+		Short: "Promote packages from a repository to another.",
+		Long: `Copies the artifacts of the selected packages, along with their runtime dependencies,
+from a local repository to another, and regenerates the destination repository.`,
+		Example: `
+# Promote a package and its dependencies from testing to stable
+$> luet repo promote --from /repos/testing --to /repos/stable utils/yq
+
+# Update also the definitions of the stable tree
+$> luet repo promote --from /repos/testing --to /repos/stable --tree /trees/stable utils/yq@1.0
+`,
+		Args: cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString("from")
+			to, _ := cmd.Flags().GetString("to")
+			if from == "" || to == "" {
+				Fatal("Both --from and --to are mandatory.")
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var packs pkg.Packages
+
+			from, _ := cmd.Flags().GetString("from")
+			to, _ := cmd.Flags().GetString("to")
+			treePath, _ := cmd.Flags().GetString("tree")
+
+			for _, a := range args {
+				pack, err := helpers.ParsePackageStr(a)
+				if err != nil {
+					Fatal("Invalid package string ", a, ": ", err.Error())
+				}
+				packs = append(packs, pack)
+			}
+
+			promoted, err := installer.PromotePackages(from, to, packs, installer.PromoteOptions{
+				TreePath:      treePath,
+				SolverOptions: solver.Options{Type: solver.SingleCoreSimple},
+			})
+			if err != nil {
+				Fatal("Error: " + err.Error())
+			}
+
+			for _, p := range promoted {
+				Info(":package: Promoted", p.HumanReadableString())
+			}
+		},
+	}
+
+	ans.Flags().String("from", "", "Source repository folder")
+	ans.Flags().String("to", "", "Destination repository folder")
+	ans.Flags().String("tree", "", "Destination tree where definitions are copied (defaults to the destination repository tree)")
+
+	return ans
+}
@@ -0,0 +1,177 @@
+// Copyright © 2019 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/pkg/compiler"
+	. "github.com/mudler/luet/pkg/config"
+	fileHelpers "github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/logger"
+	"github.com/mudler/luet/pkg/sbom"
+
+	"github.com/spf13/cobra"
+)
+
+var sbomCmd = &cobra.Command{
+	Use:   "sbom",
+	Short: "Generate a software bill of materials",
+	Long: `Generates a software bill of materials in the SPDX or CycloneDX json formats.
+
+Describe the packages installed in the system, along with the hashes of their files:
+
+	$ luet sbom --format spdx
+
+Describe the artifacts built in a folder by "luet build":
+
+	$ luet sbom --artifacts build/ --format cyclonedx --file sbom.json
+
+Describe the whole index of a repository (a folder, an url or a configured repository name):
+
+	$ luet sbom --repository https://repo.example.com
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		LuetCfg.Viper.BindPFlag("system.database_path", cmd.Flags().Lookup("system-dbpath"))
+		LuetCfg.Viper.BindPFlag("system.rootfs", cmd.Flags().Lookup("system-target"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		file, _ := cmd.Flags().GetString("file")
+		artifactsDir, _ := cmd.Flags().GetString("artifacts")
+		repository, _ := cmd.Flags().GetString("repository")
+		hashFiles, _ := cmd.Flags().GetBool("hash-files")
+		name, _ := cmd.Flags().GetString("name")
+
+		if file == "" {
+			// Keep stdout clean for the document
+			LuetCfg.GetLogging().SetLogLevel("error")
+		}
+
+		tool := "luet-" + LuetCLIVersion
+		var doc *sbom.Document
+		var err error
+
+		switch {
+		case artifactsDir != "" && repository != "":
+			Fatal("Only one of --artifacts and --repository can be used")
+		case artifactsDir != "":
+			artifacts, loadErr := loadArtifacts(artifactsDir)
+			if loadErr != nil {
+				Fatal("Error: " + loadErr.Error())
+			}
+			if name == "" {
+				name = filepath.Base(artifactsDir)
+			}
+			doc, err = sbom.FromArtifacts(name, tool, artifacts, hashFiles)
+		case repository != "":
+			repo, clean, loadErr := helpers.LoadRepository(repository, false)
+			if loadErr != nil {
+				Fatal("Error loading ", repository, ": ", loadErr.Error())
+			}
+			defer clean()
+
+			// Artifacts of local repositories can be hashed
+			artifacts := compiler.ArtifactIndex{}
+			for _, a := range repo.GetIndex() {
+				if dir := strings.TrimPrefix(repository, "file://"); fileHelpers.Exists(dir) {
+					a.SetPath(filepath.Join(dir, path.Base(a.GetPath())))
+				}
+				artifacts = append(artifacts, a)
+			}
+			if name == "" {
+				name = repo.GetName()
+			}
+			doc, err = sbom.FromArtifacts(name, tool, artifacts, hashFiles)
+		default:
+			target := ""
+			if hashFiles {
+				target = LuetCfg.GetSystem().Rootfs
+			}
+			if name == "" {
+				name = "system"
+			}
+			doc, err = sbom.FromSystem(name, tool, LuetCfg.GetSystemDB(), target)
+		}
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
+		data, err := doc.Export(format)
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
+		if file == "" {
+			fmt.Println(string(data))
+			return
+		}
+		err = ioutil.WriteFile(file, data, 0644)
+		if err != nil {
+			Fatal("Error: " + err.Error())
+		}
+		Info("Bill of materials of", len(doc.Components), "packages written to", file)
+	},
+}
+
+// loadArtifacts reads the artifacts metadata found in dir
+func loadArtifacts(dir string) ([]compiler.Artifact, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ans []compiler.Artifact
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".metadata.yaml") {
+			continue
+		}
+		dat, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		a, err := compiler.NewPackageArtifactFromYaml(dat)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %s", f.Name(), err.Error())
+		}
+		a.SetPath(filepath.Join(dir, path.Base(a.GetPath())))
+		ans = append(ans, a)
+	}
+	return ans, nil
+}
+
+func init() {
+	path, err := os.Getwd()
+	if err != nil {
+		Fatal(err)
+	}
+	sbomCmd.Flags().String("system-dbpath", path, "System db path")
+	sbomCmd.Flags().String("system-target", path, "System rootpath")
+	sbomCmd.Flags().String("format", sbom.SPDX, "Document format (spdx, cyclonedx)")
+	sbomCmd.Flags().String("file", "", "Write the document to the file instead of the standard output")
+	sbomCmd.Flags().String("artifacts", "", "Describe the artifacts built in the folder")
+	sbomCmd.Flags().String("repository", "", "Describe the index of a repository (folder, url or name)")
+	sbomCmd.Flags().Bool("hash-files", true, "Hash the files of the packages")
+	sbomCmd.Flags().String("name", "", "Name of the document")
+
+	RootCmd.AddCommand(sbomCmd)
+}
@@ -36,6 +36,7 @@ type PackageResult struct {
 	Repository string `json:"repository"`
 	Target     string `json:"target"`
 	Hidden     bool   `json:"hidden"`
+	Variant    string `json:"variant,omitempty"`
 }
 
 type Results struct {
@@ -43,6 +44,9 @@ type Results struct {
 }
 
 func (r PackageResult) String() string {
+	if r.Variant != "" {
+		return fmt.Sprintf("%s/%s-%s required for %s (%s)", r.Category, r.Name, r.Version, r.Target, r.Variant)
+	}
 	return fmt.Sprintf("%s/%s-%s required for %s", r.Category, r.Name, r.Version, r.Target)
 }
 
@@ -15,10 +15,10 @@
 package cmd
 
 import (
-	"net/http"
 	"os"
 
 	. "github.com/mudler/luet/pkg/logger"
+	"github.com/mudler/luet/pkg/server"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -27,11 +27,41 @@ import (
 var serverepoCmd = &cobra.Command{
 	Use:   "serve-repo",
 	Short: "Embedded micro-http server",
-	Long:  `Embedded mini http server for serving local repositories`,
+	Long: `Embedded mini http server for serving local repositories
+
+	$ luet serve-repo --dir build/ --port 9090
+
+Besides the repository files, the server exposes a JSON API:
+
+	/api/v1/repository     lists the packages of the repository
+	/api/v1/search?q=...   searches packages (mode=regexPkg|label|regexLabel)
+	/api/v1/metrics        reports statistics about the requests served
+
+Clients can be authenticated with tokens or basic auth, matching the
+authentication settings of the repositories in the luet config:
+
+	$ luet serve-repo --auth-token mytoken --auth-basic user:password
+
+Authenticated clients can publish artifacts with "luet publish" once uploads
+are enabled:
+
+	$ luet serve-repo --auth-token mytoken --upload
+
+Enable TLS, optionally requiring client certificates:
+
+	$ luet serve-repo --tls-cert cert.pem --tls-key key.pem --tls-client-ca ca.pem
+`,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		viper.BindPFlag("dir", cmd.Flags().Lookup("dir"))
 		viper.BindPFlag("address", cmd.Flags().Lookup("address"))
 		viper.BindPFlag("port", cmd.Flags().Lookup("port"))
+		viper.BindPFlag("tls-cert", cmd.Flags().Lookup("tls-cert"))
+		viper.BindPFlag("tls-key", cmd.Flags().Lookup("tls-key"))
+		viper.BindPFlag("tls-client-ca", cmd.Flags().Lookup("tls-client-ca"))
+		viper.BindPFlag("auth-token", cmd.Flags().Lookup("auth-token"))
+		viper.BindPFlag("auth-basic", cmd.Flags().Lookup("auth-basic"))
+		viper.BindPFlag("upload", cmd.Flags().Lookup("upload"))
+		viper.BindPFlag("upload-max-size", cmd.Flags().Lookup("upload-max-size"))
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -39,10 +69,24 @@ var serverepoCmd = &cobra.Command{
 		port := viper.GetString("port")
 		address := viper.GetString("address")
 
-		http.Handle("/", http.FileServer(http.Dir(dir)))
+		srv := server.NewRepositoryServer(server.Options{
+			Dir:           dir,
+			Tokens:        viper.GetStringSlice("auth-token"),
+			BasicAuth:     viper.GetStringSlice("auth-basic"),
+			Upload:        viper.GetBool("upload"),
+			MaxUploadSize: viper.GetInt64("upload-max-size") << 20,
+			TLSCert:       viper.GetString("tls-cert"),
+			TLSKey:        viper.GetString("tls-key"),
+			ClientCA:      viper.GetString("tls-client-ca"),
+		})
+		defer srv.Close()
 
-		Info("Serving ", dir, " on HTTP port: ", port)
-		Fatal(http.ListenAndServe(address+":"+port, nil))
+		if srv.Options.TLSCert != "" {
+			Info("Serving ", dir, " on HTTPS port: ", port)
+		} else {
+			Info("Serving ", dir, " on HTTP port: ", port)
+		}
+		Fatal(srv.ListenAndServe(address + ":" + port))
 	},
 }
 
@@ -54,6 +98,13 @@ func init() {
 	serverepoCmd.Flags().String("dir", path, "Packages folder (output from build)")
 	serverepoCmd.Flags().String("port", "9090", "Listening port")
 	serverepoCmd.Flags().String("address", "0.0.0.0", "Listening address")
+	serverepoCmd.Flags().String("tls-cert", "", "TLS certificate file")
+	serverepoCmd.Flags().String("tls-key", "", "TLS key file")
+	serverepoCmd.Flags().String("tls-client-ca", "", "Require client certificates signed by the given CA")
+	serverepoCmd.Flags().StringSlice("auth-token", []string{}, "Accepted authentication tokens")
+	serverepoCmd.Flags().StringSlice("auth-basic", []string{}, "Accepted basic auth credentials (user:password)")
+	serverepoCmd.Flags().Bool("upload", false, "Accept artifacts published with \"luet publish\" (requires authentication)")
+	serverepoCmd.Flags().Int64("upload-max-size", server.DefaultMaxUploadSize>>20, "Size limit of the uploads, in MiB")
 
 	RootCmd.AddCommand(serverepoCmd)
 }
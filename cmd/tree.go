@@ -35,5 +35,6 @@ func init() {
 		NewTreeValidateCommand(),
 		NewTreeBumpCommand(),
 		NewTreeImageCommand(),
+		NewTreeProvenanceCommand(),
 	)
 }
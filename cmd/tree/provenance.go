@@ -0,0 +1,136 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//                  Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_tree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/compiler"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+	tree "github.com/mudler/luet/pkg/tree"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewTreeProvenanceCommand() *cobra.Command {
+
+	var ans = &cobra.Command{
+		Use:   "provenance [OPTIONS] [artifacts dir]",
+		Short: "Verify the provenance of artifacts against the tree",
+		Long: `Checks that the artifacts in a folder were built from the definitions of the tree,
+using the provenance documents written along with the artifacts.
+
+	$ luet tree provenance -t ./tree ./build
+`,
+		Args: cobra.MaximumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			t, _ := cmd.Flags().GetStringArray("tree")
+			if len(t) == 0 {
+				Fatal("Mandatory tree param missing.")
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			treePath, _ := cmd.Flags().GetStringArray("tree")
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+
+			reciper := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			for _, t := range treePath {
+				err := reciper.Load(t)
+				if err != nil {
+					Fatal("Error on load tree ", err)
+				}
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				Fatal("Error: " + err.Error())
+			}
+
+			failed := 0
+			for _, f := range files {
+				if !strings.HasSuffix(f.Name(), ".metadata.yaml") {
+					continue
+				}
+				err := verifyProvenance(reciper.GetDatabase(), dir, f.Name())
+				if err != nil {
+					Error(":x:", err.Error())
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				Error(failed, "artifacts failed the provenance check")
+				os.Exit(1)
+			}
+			Info(":white_check_mark: All the artifacts match the tree")
+		},
+	}
+
+	ans.Flags().StringArrayP("tree", "t", []string{}, "Path of the tree to use.")
+
+	return ans
+}
+
+func verifyProvenance(db pkg.PackageDatabase, dir, metadata string) error {
+	dat, err := ioutil.ReadFile(filepath.Join(dir, metadata))
+	if err != nil {
+		return err
+	}
+	a, err := compiler.NewPackageArtifactFromYaml(dat)
+	if err != nil {
+		return errors.Wrap(err, "Error reading yaml "+metadata)
+	}
+	if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+		return errors.New("No package found in " + metadata)
+	}
+	p := a.GetCompileSpec().GetPackage()
+	ref := a.GetProvenance()
+	if ref == nil {
+		return errors.New(p.HumanReadableString() + " has no provenance")
+	}
+
+	provenanceFile := filepath.Join(dir, ref.Path)
+	err = ref.Verify(provenanceFile)
+	if err != nil {
+		return errors.Wrap(err, "Provenance of "+p.HumanReadableString()+" doesn't match the metadata")
+	}
+	provenance, err := compiler.LoadProvenance(provenanceFile)
+	if err != nil {
+		return err
+	}
+
+	definition := p.Clone()
+	definition.SetArch("")
+	found, err := db.FindPackage(definition)
+	if err != nil {
+		return errors.Wrap(err, p.HumanReadableString()+" not found in the tree")
+	}
+	err = provenance.Verify(found.GetPath())
+	if err != nil {
+		return err
+	}
+	Info(":white_check_mark:", p.HumanReadableString())
+	return nil
+}
@@ -77,6 +77,11 @@ var upgradeCmd = &cobra.Command{
 
 		Debug("Solver", LuetCfg.GetSolverOptions().String())
 
+		uses, _ := cmd.Flags().GetStringSlice("use")
+		if err := LuetCfg.GetUseFlags().Add(uses...); err != nil {
+			Fatal("Error: " + err.Error())
+		}
+
 		// Load config protect configs
 		installer.LoadConfigProtectConfs(LuetCfg)
 
@@ -120,6 +125,7 @@ func init() {
 	upgradeCmd.Flags().Bool("sync", false, "Upgrade packages with new revisions (experimental)")
 	upgradeCmd.Flags().Bool("solver-concurrent", false, "Use concurrent solver (experimental)")
 	upgradeCmd.Flags().BoolP("yes", "y", false, "Don't ask questions")
+	upgradeCmd.Flags().StringSlice("use", []string{}, "Use flags to enable, or disable with -flag, for all packages or for one with category/name:flag")
 
 	RootCmd.AddCommand(upgradeCmd)
 }
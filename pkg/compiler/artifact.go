@@ -26,14 +26,14 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 
 	system "github.com/docker/docker/pkg/system"
-	"github.com/klauspost/compress/zstd"
-	gzip "github.com/klauspost/pgzip"
 
 	//"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	bus "github.com/mudler/luet/pkg/bus"
 	. "github.com/mudler/luet/pkg/config"
@@ -51,6 +51,8 @@ const (
 	None      CompressionImplementation = "none" // e.g. tar for standard packages
 	GZip      CompressionImplementation = "gzip"
 	Zstandard CompressionImplementation = "zstd"
+	XZ        CompressionImplementation = "xz"
+	LZ4       CompressionImplementation = "lz4"
 )
 
 type ArtifactIndex []Artifact
@@ -68,12 +70,53 @@ func (i ArtifactIndex) CleanPath() ArtifactIndex {
 			CompressionType: art.CompressionType,
 			Checksums:       art.Checksums,
 			Files:           art.Files,
+			Provenance:      art.Provenance,
+			SourceHash:      art.SourceHash,
+			BuildLog:        art.BuildLog,
 		})
 	}
 	return newIndex
 	//Update if exists, otherwise just create
 }
 
+// Arches returns the sorted architectures the artifacts of the index are built for
+func (i ArtifactIndex) Arches() []string {
+	arches := map[string]bool{}
+	for _, a := range i {
+		if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+			continue
+		}
+		if arch := a.GetCompileSpec().GetPackage().GetArch(); arch != "" {
+			arches[arch] = true
+		}
+	}
+	ans := []string{}
+	for arch := range arches {
+		ans = append(ans, arch)
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+// Variants returns the sorted build variants of the artifacts of the index
+func (i ArtifactIndex) Variants() []string {
+	variants := map[string]bool{}
+	for _, a := range i {
+		if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+			continue
+		}
+		if variant := a.GetCompileSpec().GetPackage().GetVariant(); variant != "" {
+			variants[variant] = true
+		}
+	}
+	ans := []string{}
+	for variant := range variants {
+		ans = append(ans, variant)
+	}
+	sort.Strings(ans)
+	return ans
+}
+
 //  When compiling, we write also a fingerprint.metadata.yaml file with PackageArtifact. In this way we can have another command to create the repository
 // which will consist in just of an repository.yaml which is just the repository structure with the list of package artifact.
 // In this way a generic client can fetch the packages and, after unpacking the tree, performing queries to install packages.
@@ -86,6 +129,14 @@ type PackageArtifact struct {
 	SourceAssertion solver.PackagesAssertions `json:"-"`
 	CompressionType CompressionImplementation `json:"compressiontype"`
 	Files           []string                  `json:"files"`
+	Provenance      *ProvenanceReference      `json:"provenance,omitempty"`
+	// SourceHash identifies the sources the artifact was built from
+	SourceHash string `json:"source_hash,omitempty"`
+	// BuildLog is the path of the build output, relative to the artifact
+	BuildLog string `json:"build_log,omitempty"`
+
+	// reproducible is the epoch the mtimes of reproducible archives are clamped to
+	reproducible *time.Time
 }
 
 func NewPackageArtifact(path string) Artifact {
@@ -104,7 +155,7 @@ func NewPackageArtifactFromYaml(data []byte) (Artifact, error) {
 
 func LoadArtifactFromYaml(spec CompilationSpec) (Artifact, error) {
 
-	metaFile := spec.GetPackage().GetFingerPrint() + ".metadata.yaml"
+	metaFile := spec.GetPackage().GetArtifactFingerPrint() + ".metadata.yaml"
 	dat, err := ioutil.ReadFile(spec.Rel(metaFile))
 	if err != nil {
 		return nil, errors.Wrap(err, "Error reading file "+metaFile)
@@ -113,8 +164,8 @@ func LoadArtifactFromYaml(spec CompilationSpec) (Artifact, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Error writing file "+metaFile)
 	}
-	// It is relative, set it back to abs
-	art.SetPath(spec.Rel(art.GetPath()))
+	// The artifact is next to its metadata, set it back to abs
+	art.SetPath(spec.Rel(path.Base(art.GetPath())))
 	return art, nil
 }
 
@@ -122,6 +173,10 @@ func (a *PackageArtifact) SetCompressionType(t CompressionImplementation) {
 	a.CompressionType = t
 }
 
+func (a *PackageArtifact) GetCompressionType() CompressionImplementation {
+	return a.CompressionType
+}
+
 func (a *PackageArtifact) GetChecksums() Checksums {
 	return a.Checksums
 }
@@ -138,6 +193,44 @@ func (a *PackageArtifact) GetFiles() []string {
 	return a.Files
 }
 
+func (a *PackageArtifact) GetProvenance() *ProvenanceReference {
+	return a.Provenance
+}
+
+func (a *PackageArtifact) SetProvenance(p *ProvenanceReference) {
+	a.Provenance = p
+}
+
+func (a *PackageArtifact) GetSourceHash() string {
+	return a.SourceHash
+}
+
+func (a *PackageArtifact) SetSourceHash(h string) {
+	a.SourceHash = h
+}
+
+func (a *PackageArtifact) GetBuildLog() string {
+	return a.BuildLog
+}
+
+func (a *PackageArtifact) SetBuildLog(l string) {
+	a.BuildLog = l
+}
+
+// SetReproducible makes Compress generate archives depending only on the
+// content, with mtimes clamped to epoch.
+func (a *PackageArtifact) SetReproducible(epoch time.Time) {
+	a.reproducible = &epoch
+}
+
+// tar archives src into the artifact path
+func (a *PackageArtifact) tar(src string) error {
+	if a.reproducible != nil {
+		return helpers.TarReproducible(src, a.Path, *a.reproducible)
+	}
+	return helpers.Tar(src, a.Path)
+}
+
 func (a *PackageArtifact) Hash() error {
 	return a.Checksums.Generate(a)
 }
@@ -191,7 +284,7 @@ func (a *PackageArtifact) WriteYaml(dst string) error {
 		return errors.Wrap(err, "While marshalling for PackageArtifact YAML")
 	}
 
-	err = ioutil.WriteFile(filepath.Join(dst, a.GetCompileSpec().GetPackage().GetFingerPrint()+".metadata.yaml"), data, os.ModePerm)
+	err = ioutil.WriteFile(filepath.Join(dst, a.GetCompileSpec().GetPackage().GetArtifactFingerPrint()+".metadata.yaml"), data, os.ModePerm)
 	if err != nil {
 		return errors.Wrap(err, "While writing PackageArtifact YAML")
 	}
@@ -241,87 +334,55 @@ func (a *PackageArtifact) SetPath(p string) {
 	a.Path = p
 }
 
-// Compress Archives and compress (TODO) to the artifact path
+// Compress archives src into the artifact path, and compresses it with the
+// compression type of the artifact
 func (a *PackageArtifact) Compress(src string, concurrency int) error {
-	switch a.CompressionType {
-
-	case Zstandard:
-		err := helpers.Tar(src, a.Path)
-		if err != nil {
-			return err
-		}
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return err
-		}
-		defer original.Close()
-
-		zstdFile := a.Path + ".zstd"
-		bufferedReader := bufio.NewReader(original)
-
-		// Open a file for writing.
-		dst, err := os.Create(zstdFile)
-		if err != nil {
-			return err
-		}
-
-		enc, err := zstd.NewWriter(dst)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(enc, bufferedReader)
-		if err != nil {
-			enc.Close()
-			return err
-		}
-		if err := enc.Close(); err != nil {
-			return err
-		}
+	err := a.tar(src)
+	if err != nil {
+		return err
+	}
 
-		os.RemoveAll(a.Path) // Remove original
-		a.Path = zstdFile
+	// Defaults to tar only (covers when "none" is supplied)
+	ext := a.CompressionType.Extension()
+	if ext == "" {
 		return nil
-	case GZip:
-		err := helpers.Tar(src, a.Path)
-		if err != nil {
-			return err
-		}
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return err
-		}
-		defer original.Close()
+	}
 
-		gzipfile := a.Path + ".gz"
-		bufferedReader := bufio.NewReader(original)
+	original, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer original.Close()
 
-		// Open a file for writing.
-		dst, err := os.Create(gzipfile)
-		if err != nil {
-			return err
-		}
-		// Create gzip writer.
-		w := gzip.NewWriter(dst)
-		w.SetConcurrency(concurrency, 10)
-		defer w.Close()
-		defer dst.Close()
-		_, err = io.Copy(w, bufferedReader)
-		if err != nil {
-			return err
-		}
-		w.Close()
-		os.RemoveAll(a.Path) // Remove original
-		//	a.CompressedPath = gzipfile
-		a.Path = gzipfile
-		return nil
-		//a.Path = gzipfile
+	compressedFile := a.Path + ext
+	bufferedReader := bufio.NewReader(original)
 
-	// Defaults to tar only (covers when "none" is supplied)
-	default:
-		return helpers.Tar(src, a.Path)
+	// Open a file for writing.
+	dst, err := os.Create(compressedFile)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
 
+	w, err := a.compressor(dst, concurrency)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bufferedReader)
+	if err != nil {
+		w.Close()
+		return err
 	}
-	return errors.New("Compression type must be supplied")
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	os.RemoveAll(a.Path) // Remove original
+	a.Path = compressedFile
+	return nil
 }
 
 func tarModifierWrapperFunc(dst, path string, header *tar.Header, content io.Reader) (*tar.Header, []byte, error) {
@@ -397,7 +458,9 @@ func (a *PackageArtifact) GetProtectFiles() []string {
 	return ans
 }
 
-// Unpack Untar and decompress (TODO) to the given path
+// Unpack decompresses and untars the artifact to the given path. The
+// archive is decompressed while extracted, so no uncompressed copy of it
+// is written on disk.
 func (a *PackageArtifact) Unpack(dst string, keepPerms bool) error {
 
 	// Create
@@ -405,140 +468,23 @@ func (a *PackageArtifact) Unpack(dst string, keepPerms bool) error {
 
 	tarModifier := helpers.NewTarModifierWrapper(dst, tarModifierWrapperFunc)
 
-	switch a.CompressionType {
-	case Zstandard:
-		// Create the uncompressed archive
-		archive, err := os.Create(a.GetPath() + ".uncompressed")
-		if err != nil {
-			return err
-		}
-		defer os.RemoveAll(a.GetPath() + ".uncompressed")
-		defer archive.Close()
-
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return errors.Wrap(err, "Cannot open "+a.Path)
-		}
-		defer original.Close()
-
-		bufferedReader := bufio.NewReader(original)
-
-		d, err := zstd.NewReader(bufferedReader)
-		if err != nil {
-			return err
-		}
-		defer d.Close()
-
-		_, err = io.Copy(archive, d)
-		if err != nil {
-			return errors.Wrap(err, "Cannot copy to "+a.GetPath()+".uncompressed")
-		}
-
-		err = helpers.UntarProtect(a.GetPath()+".uncompressed", dst,
-			LuetCfg.GetGeneral().SameOwner, protectedFiles, tarModifier)
-		if err != nil {
-			return err
-		}
-		return nil
-	case GZip:
-		// Create the uncompressed archive
-		archive, err := os.Create(a.GetPath() + ".uncompressed")
-		if err != nil {
-			return err
-		}
-		defer os.RemoveAll(a.GetPath() + ".uncompressed")
-		defer archive.Close()
-
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return errors.Wrap(err, "Cannot open "+a.Path)
-		}
-		defer original.Close()
-
-		bufferedReader := bufio.NewReader(original)
-		r, err := gzip.NewReader(bufferedReader)
-		if err != nil {
-			return err
-		}
-		defer r.Close()
-
-		_, err = io.Copy(archive, r)
-		if err != nil {
-			return errors.Wrap(err, "Cannot copy to "+a.GetPath()+".uncompressed")
-		}
-
-		err = helpers.UntarProtect(a.GetPath()+".uncompressed", dst,
-			LuetCfg.GetGeneral().SameOwner, protectedFiles, tarModifier)
-		if err != nil {
-			return err
-		}
-		return nil
-	// Defaults to tar only (covers when "none" is supplied)
-	default:
-		return helpers.UntarProtect(a.GetPath(), dst, LuetCfg.GetGeneral().SameOwner,
-			protectedFiles, tarModifier)
+	r, err := a.reader()
+	if err != nil {
+		return err
 	}
-	return errors.New("Compression type must be supplied")
+	defer r.Close()
+
+	return helpers.UntarProtectReader(r, dst, LuetCfg.GetGeneral().SameOwner, protectedFiles, tarModifier)
 }
 
 // FileList generates the list of file of a package from the local archive
 func (a *PackageArtifact) FileList() ([]string, error) {
-	var tr *tar.Reader
-	switch a.CompressionType {
-	case Zstandard:
-		archive, err := os.Create(a.GetPath() + ".uncompressed")
-		if err != nil {
-			return []string{}, err
-		}
-		defer os.RemoveAll(a.GetPath() + ".uncompressed")
-		defer archive.Close()
-
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return []string{}, errors.Wrap(err, "Cannot open "+a.Path)
-		}
-		defer original.Close()
-
-		bufferedReader := bufio.NewReader(original)
-		r, err := zstd.NewReader(bufferedReader)
-		if err != nil {
-			return []string{}, err
-		}
-		defer r.Close()
-		tr = tar.NewReader(r)
-	case GZip:
-		// Create the uncompressed archive
-		archive, err := os.Create(a.GetPath() + ".uncompressed")
-		if err != nil {
-			return []string{}, err
-		}
-		defer os.RemoveAll(a.GetPath() + ".uncompressed")
-		defer archive.Close()
-
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return []string{}, errors.Wrap(err, "Cannot open "+a.Path)
-		}
-		defer original.Close()
-
-		bufferedReader := bufio.NewReader(original)
-		r, err := gzip.NewReader(bufferedReader)
-		if err != nil {
-			return []string{}, err
-		}
-		defer r.Close()
-		tr = tar.NewReader(r)
-
-	// Defaults to tar only (covers when "none" is supplied)
-	default:
-		tarFile, err := os.Open(a.GetPath())
-		if err != nil {
-			return []string{}, errors.Wrap(err, "Could not open package archive")
-		}
-		defer tarFile.Close()
-		tr = tar.NewReader(tarFile)
-
+	r, err := a.reader()
+	if err != nil {
+		return []string{}, errors.Wrap(err, "Could not open package archive")
 	}
+	defer r.Close()
+	tr := tar.NewReader(r)
 
 	var files []string
 	// untar each segment
@@ -615,6 +561,13 @@ func worker(i int, wg *sync.WaitGroup, s <-chan CopyJob) {
 
 // ExtractArtifactFromDelta extracts deltas from ArtifactLayer from an image in tar format
 func ExtractArtifactFromDelta(src, dst string, layers []ArtifactLayer, concurrency int, keepPerms bool, includes []string, excludes []string, t CompressionImplementation) (Artifact, error) {
+	a := NewPackageArtifact(dst)
+	a.SetCompressionType(t)
+	return extractArtifactFromDelta(src, a, layers, concurrency, keepPerms, includes, excludes)
+}
+
+// extractArtifactFromDelta compresses the deltas into the given artifact
+func extractArtifactFromDelta(src string, artifact Artifact, layers []ArtifactLayer, concurrency int, keepPerms bool, includes []string, excludes []string) (Artifact, error) {
 
 	archive, err := LuetCfg.GetSystem().TempDir("archive")
 	if err != nil {
@@ -768,13 +721,11 @@ func ExtractArtifactFromDelta(src, dst string, layers []ArtifactLayer, concurren
 	close(toCopy)
 	wg.Wait()
 
-	a := NewPackageArtifact(dst)
-	a.SetCompressionType(t)
-	err = a.Compress(archive, concurrency)
+	err = artifact.Compress(archive, concurrency)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error met while creating package archive")
 	}
-	return a, nil
+	return artifact, nil
 }
 
 func ComputeArtifactLayerSummary(diffs []ArtifactLayer) ArtifactLayersSummary {
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	. "github.com/mudler/luet/pkg/compiler/backend"
 	"github.com/mudler/luet/pkg/solver"
@@ -160,4 +161,59 @@ RUN echo bar > /test2`))
 		})
 
 	})
+
+	Context("Compression", func() {
+		It("Unpacks the archives without writing them uncompressed", func() {
+			for _, t := range []CompressionImplementation{None, GZip, Zstandard, XZ, LZ4} {
+				tmpdir, err := ioutil.TempDir("", "compression")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(tmpdir)
+
+				content := filepath.Join(tmpdir, "content")
+				Expect(os.MkdirAll(filepath.Join(content, "usr", "bin"), os.ModePerm)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(content, "usr", "bin", "foo"), []byte("foo"), os.ModePerm)).ToNot(HaveOccurred())
+
+				a := NewPackageArtifact(filepath.Join(tmpdir, "foo.package.tar"))
+				a.SetCompressionType(t)
+				Expect(a.Compress(content, 4)).ToNot(HaveOccurred())
+				Expect(helpers.Exists(a.GetPath())).To(BeTrue())
+
+				files, err := a.FileList()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(Equal([]string{"usr/bin/foo"}))
+
+				out := filepath.Join(tmpdir, "out")
+				Expect(a.Unpack(out, false)).ToNot(HaveOccurred())
+				data, err := helpers.Read(filepath.Join(out, "usr", "bin", "foo"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal("foo"))
+				Expect(helpers.Exists(a.GetPath() + ".uncompressed")).To(BeFalse())
+			}
+		})
+	})
+
+	Context("Reproducible archives", func() {
+		It("Generates the same checksums from the same content", func() {
+			for _, t := range []CompressionImplementation{None, GZip, Zstandard, XZ, LZ4} {
+				var sums []Checksums
+				for i := 0; i < 2; i++ {
+					tmpdir, err := ioutil.TempDir("", "reproducible")
+					Expect(err).ToNot(HaveOccurred())
+					defer os.RemoveAll(tmpdir)
+
+					content := filepath.Join(tmpdir, "content")
+					Expect(os.MkdirAll(filepath.Join(content, "usr", "bin"), os.ModePerm)).ToNot(HaveOccurred())
+					Expect(ioutil.WriteFile(filepath.Join(content, "usr", "bin", "foo"), []byte("foo"), os.ModePerm)).ToNot(HaveOccurred())
+
+					a := NewPackageArtifact(filepath.Join(tmpdir, "foo.package.tar"))
+					a.SetCompressionType(t)
+					a.SetReproducible(time.Unix(0, 0))
+					Expect(a.Compress(content, 2)).ToNot(HaveOccurred())
+					Expect(a.Hash()).ToNot(HaveOccurred())
+					sums = append(sums, a.GetChecksums())
+				}
+				Expect(sums[0]).To(Equal(sums[1]))
+			}
+		})
+	})
 })
@@ -47,12 +47,19 @@ func (*SimpleDocker) BuildImage(opts compiler.CompilerBackendOptions) error {
 	path := opts.SourcePath
 	dockerfileName := opts.DockerFileName
 
-	buildarg := []string{"build", "-f", dockerfileName, "-t", name, "."}
+	buildarg := []string{"build", "-f", dockerfileName, "-t", name}
+	if opts.Platform != "" {
+		buildarg = append(buildarg, "--platform", opts.Platform)
+	}
+	if opts.NoCache {
+		buildarg = append(buildarg, "--no-cache")
+	}
+	buildarg = append(buildarg, ".")
 
 	Debug(":whale2: Building image " + name)
 	cmd := exec.Command("docker", buildarg...)
 	cmd.Dir = path
-	out, err := cmd.CombinedOutput()
+	out, err := helpers.RunLogged(cmd, opts.LogFile)
 	if err != nil {
 		return errors.Wrap(err, "Failed building image: "+string(out))
 	}
@@ -119,6 +126,15 @@ func (*SimpleDocker) ImageExists(imagename string) bool {
 	return true
 }
 
+func (*SimpleDocker) ImageDigest(imagename string) (string, error) {
+	buildarg := []string{"inspect", "--type=image", "--format", "{{.Id}}", imagename}
+	out, err := exec.Command("docker", buildarg...).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrap(err, "Failed inspecting image: "+string(out))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 func (*SimpleDocker) ImageAvailable(imagename string) bool {
 	return imageAvailable(imagename)
 }
@@ -18,8 +18,10 @@ package backend
 import (
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/helpers"
 	. "github.com/mudler/luet/pkg/logger"
 
 	"github.com/pkg/errors"
@@ -37,13 +39,20 @@ func (*SimpleImg) BuildImage(opts compiler.CompilerBackendOptions) error {
 	path := opts.SourcePath
 	dockerfileName := opts.DockerFileName
 
-	buildarg := []string{"build", "-f", dockerfileName, "-t", name, "."}
+	buildarg := []string{"build", "-f", dockerfileName, "-t", name}
+	if opts.Platform != "" {
+		buildarg = append(buildarg, "--platform", opts.Platform)
+	}
+	if opts.NoCache {
+		buildarg = append(buildarg, "--no-cache")
+	}
+	buildarg = append(buildarg, ".")
 	Spinner(22)
 	defer SpinnerStop()
 	Debug(":tea: Building image " + name)
 	cmd := exec.Command("img", buildarg...)
 	cmd.Dir = path
-	out, err := cmd.CombinedOutput()
+	out, err := helpers.RunLogged(cmd, opts.LogFile)
 
 	if err != nil {
 		return errors.Wrap(err, "Failed building image: "+string(out))
@@ -108,6 +117,24 @@ func (*SimpleImg) ImageExists(imagename string) bool {
 	return false
 }
 
+// ImageDigest looks up the digest of the image in the output of img ls
+func (*SimpleImg) ImageDigest(imagename string) (string, error) {
+	out, err := exec.Command("img", "ls").CombinedOutput()
+	if err != nil {
+		return "", errors.Wrap(err, "Failed listing images: "+string(out))
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[0] == imagename || strings.HasSuffix(fields[0], "/"+imagename) {
+			return fields[len(fields)-1], nil
+		}
+	}
+	return "", errors.New("Image " + imagename + " not found")
+}
+
 func (s *SimpleImg) ImageDefinitionToTar(opts compiler.CompilerBackendOptions) error {
 	if err := s.BuildImage(opts); err != nil {
 		return errors.Wrap(err, "Failed building image")
@@ -0,0 +1,206 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/pkg/errors"
+)
+
+// ArtifactCache provides artifacts already built elsewhere, e.g. in a
+// repository, given their source hash.
+type ArtifactCache interface {
+	// GetArtifact places in the output path of the spec the artifact
+	// with the given source hash, and returns it. It returns nil if there
+	// is no such artifact.
+	GetArtifact(p CompilationSpec, sourceHash string) (Artifact, error)
+}
+
+// specSource are the fields of the rendered spec which affect the build
+type specSource struct {
+	Steps           []string `json:"steps"`
+	Env             []string `json:"env"`
+	Prelude         []string `json:"prelude"`
+	Test            []string `json:"test,omitempty"`
+	Image           string   `json:"image"`
+	PackageDir      string   `json:"package_dir"`
+	Retrieve        []string `json:"retrieve"`
+	Sources         []Source `json:"sources,omitempty"`
+	Unpack          bool     `json:"unpack"`
+	Includes        []string `json:"includes"`
+	Excludes        []string `json:"excludes"`
+	SourceDateEpoch int64    `json:"source_date_epoch"`
+
+	Subpackages []Subpackage `json:"subpackages,omitempty"`
+	UseFlags    []string     `json:"use_flags,omitempty"`
+}
+
+// specHash returns the hash of the sources of the spec: the definition
+// folder, the rendered build specs, the use flags and the retrieved files.
+func specHash(p CompilationSpec) (string, error) {
+	h := sha256.New()
+
+	definition, err := hashDefinition(p.GetPackage().GetPath())
+	if err != nil {
+		return "", err
+	}
+	for _, f := range definition {
+		fmt.Fprintf(h, "%s %s\n", f.Path, f.SHA256)
+	}
+
+	spec := specSource{
+		Image:      p.GetImage(),
+		PackageDir: p.GetPackageDir(),
+		Retrieve:   p.GetRetrieve(),
+		Sources:    p.GetSources(),
+		Unpack:     p.ImageUnpack(),
+		Includes:   p.GetIncludes(),
+		Excludes:   p.GetExcludes(),
+		Prelude:    p.GetPreBuildSteps(),
+		Steps:      p.BuildSteps(),
+		Test:       p.GetTestSteps(),
+
+		SourceDateEpoch: p.GetSourceDateEpoch(),
+		Subpackages:     p.GetSubpackages(),
+	}
+	if uses := p.GetPackage().GetUses(); len(uses) > 0 {
+		spec.UseFlags = append([]string{}, uses...)
+		sort.Strings(spec.UseFlags)
+	}
+	if s, ok := p.(*LuetCompilationSpec); ok {
+		spec.Env = s.Env
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+
+	// Retrieves not matching local files are urls, already part of the spec
+	for _, r := range p.GetRetrieve() {
+		matches, err := filepath.Glob(p.Rel(r))
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			files, err := hashDefinition(m)
+			if err != nil {
+				return "", err
+			}
+			for _, f := range files {
+				fmt.Fprintf(h, "%s %s %s\n", r, f.Path, f.SHA256)
+			}
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// SourceHashes returns the source hash of the packages in the dependency
+// tree of the spec, by fingerprint. As each package is built on top of the
+// ones preceding it, its source hash covers the sources of all of them,
+// along with the solver hashes, the target architecture, the variant and the
+// compression.
+func (cs *LuetCompiler) SourceHashes(p CompilationSpec) (map[string]string, error) {
+	ans := map[string]string{}
+	chain := sha256.New()
+	for _, assertion := range p.GetSourceAssertion() {
+		if !assertion.Value {
+			continue
+		}
+		spec := p
+		if !assertion.Package.Matches(p.GetPackage()) {
+			var err error
+			spec, err = cs.FromPackage(assertion.Package)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error while generating compilespec for "+assertion.Package.HumanReadableString())
+			}
+		}
+		own, err := specHash(spec)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed hashing sources of "+assertion.Package.HumanReadableString())
+		}
+		fmt.Fprintf(chain, "%s\n", own)
+
+		h := sha256.New()
+		h.Write(chain.Sum(nil))
+		fmt.Fprintf(h, "%s %s %s %s", assertion.Hash.PackageHash, assertion.Hash.BuildHash, cs.Options.Arch(), cs.CompressionType)
+		if cs.Options.Variant != "" {
+			fmt.Fprintf(h, " %s", cs.Options.Variant)
+		}
+		ans[assertion.Package.GetFingerPrint()] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return ans, nil
+}
+
+// reuseArtifact returns the artifact of the spec built from the same
+// sources, if any, either from the output folder or from the cache.
+// If image is given, the artifact is reused only if its package image is
+// also available, as further builds in the tree depend on it.
+func (cs *LuetCompiler) reuseArtifact(p CompilationSpec, sourceHash, image string) Artifact {
+	if cs.Options.Rebuild || sourceHash == "" {
+		return nil
+	}
+	if image != "" && !cs.Backend.ImageExists(image) && !(cs.Options.PullFirst && cs.Backend.ImageAvailable(image)) {
+		return nil
+	}
+
+	// The subpackages are split from the build of the package, so it is
+	// rebuilt unless all of them are available as well
+	subpackages, err := cs.subpackageSpecs(p)
+	if err != nil {
+		Warning("Failed loading subpackages of", p.GetPackage().HumanReadableString(), ":", err.Error())
+		return nil
+	}
+	for _, s := range subpackages {
+		if cs.reuseArtifact(s, sourceHash, "") == nil {
+			return nil
+		}
+	}
+
+	pkgTag := ":package: " + p.GetPackage().HumanReadableString()
+	if art, err := LoadArtifactFromYaml(p); err == nil && art.GetSourceHash() == sourceHash && helpers.Exists(art.GetPath()) {
+		if err := art.Verify(); err == nil {
+			Info(pkgTag, ":recycle: Sources unchanged, reusing", art.GetPath())
+			return art
+		}
+	}
+
+	if cs.Cache != nil {
+		art, err := cs.Cache.GetArtifact(p, sourceHash)
+		if err != nil {
+			Warning(pkgTag, "Failed getting artifact from cache:", err.Error())
+			return nil
+		}
+		if art != nil {
+			Info(pkgTag, ":recycle: Sources unchanged, reusing", art.GetPath(), "from cache")
+			return art
+		}
+	}
+	return nil
+}
+
+func (cs *LuetCompiler) SetArtifactCache(c ArtifactCache) {
+	cs.Cache = c
+}
@@ -0,0 +1,77 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	helpers "github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+	"github.com/mudler/luet/pkg/tree"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Build cache", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(helpers.CopyDir("../../tests/fixtures/buildable", filepath.Join(tmpdir, "tree"))).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	sourceHashes := func() map[string]string {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).ToNot(HaveOccurred())
+
+		compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+		spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = compiler.ComputeDepTree(spec)
+		Expect(err).ToNot(HaveOccurred())
+
+		hashes, err := compiler.(*LuetCompiler).SourceHashes(spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(hashes)).To(Equal(3))
+		return hashes
+	}
+
+	It("Is stable for the same sources", func() {
+		Expect(sourceHashes()).To(Equal(sourceHashes()))
+	})
+
+	It("Changes for the package and the ones built on top of it", func() {
+		before := sourceHashes()
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "tree", "cat", "cat2", "a", "extra"), []byte("foo"), os.ModePerm)).ToNot(HaveOccurred())
+		after := sourceHashes()
+
+		Expect(after["b-test-1.0"]).To(Equal(before["b-test-1.0"]))
+		Expect(after["a-test-1.0"]).ToNot(Equal(before["a-test-1.0"]))
+		Expect(after["c-test-1.0"]).ToNot(Equal(before["c-test-1.0"]))
+	})
+})
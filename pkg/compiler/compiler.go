@@ -23,8 +23,8 @@ import (
 	"path/filepath"
 
 	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	bus "github.com/mudler/luet/pkg/bus"
@@ -52,6 +52,9 @@ type LuetCompiler struct {
 	CompressionType           CompressionImplementation
 	Options                   CompilerOptions
 	SolverOptions             solver.Options
+	Cache                     ArtifactCache
+
+	report BuildReport
 }
 
 func NewLuetCompiler(backend CompilerBackend, db pkg.PackageDatabase, opt *CompilerOptions, solvopts solver.Options) Compiler {
@@ -80,21 +83,6 @@ func (cs *LuetCompiler) SetCompressionType(t CompressionImplementation) {
 	cs.CompressionType = t
 }
 
-func (cs *LuetCompiler) compilerWorker(i int, wg *sync.WaitGroup, cspecs chan CompilationSpec, a *[]Artifact, m *sync.Mutex, concurrency int, keepPermissions bool, errors chan error) {
-	defer wg.Done()
-
-	for s := range cspecs {
-		ar, err := cs.compile(concurrency, keepPermissions, s)
-		if err != nil {
-			errors <- err
-		}
-
-		m.Lock()
-		*a = append(*a, ar)
-		m.Unlock()
-	}
-}
-
 func (cs *LuetCompiler) CompileWithReverseDeps(keepPermissions bool, ps CompilationSpecs) ([]Artifact, []error) {
 	artifacts, err := cs.CompileParallel(keepPermissions, ps)
 	if len(err) != 0 {
@@ -148,39 +136,32 @@ func (cs *LuetCompiler) CompileWithReverseDeps(keepPermissions bool, ps Compilat
 	return append(artifacts, artifacts2...), err
 }
 
+// CompileParallel builds the specs along with their dependencies. Dependencies
+// shared by the specs are built once, and independent ones concurrently.
 func (cs *LuetCompiler) CompileParallel(keepPermissions bool, ps CompilationSpecs) ([]Artifact, []error) {
 	Spinner(22)
 	defer SpinnerStop()
-	all := make(chan CompilationSpec)
-	artifacts := []Artifact{}
-	mutex := &sync.Mutex{}
-	errors := make(chan error, ps.Len())
-	var wg = new(sync.WaitGroup)
-	for i := 0; i < cs.Concurrency; i++ {
-		wg.Add(1)
-		go cs.compilerWorker(i, wg, all, &artifacts, mutex, cs.Concurrency, keepPermissions, errors)
-	}
 
+	var allErrors []error
+	specs := []CompilationSpec{}
 	for _, p := range ps.All() {
 		asserts, err := cs.ComputeDepTree(p)
 		if err != nil {
-			panic(err)
+			cs.report.add(p.GetPackage(), BuildStatusFailed, 0, nil, err)
+			allErrors = append(allErrors, err)
+			continue
 		}
 		p.SetSourceAssertion(asserts)
-		all <- p
+		specs = append(specs, p)
 	}
 
-	close(all)
-	wg.Wait()
-	close(errors)
-
-	var allErrors []error
-
-	for e := range errors {
-		allErrors = append(allErrors, e)
-	}
+	artifacts, errs := cs.schedule(keepPermissions, specs, len(allErrors))
+	return artifacts, append(allErrors, errs...)
+}
 
-	return artifacts, allErrors
+// GetBuildReport returns the outcome of the builds run by the compiler
+func (cs *LuetCompiler) GetBuildReport() *BuildReport {
+	return &cs.report
 }
 
 func (cs *LuetCompiler) stripFromRootfs(includes []string, rootfs string, include bool) error {
@@ -237,6 +218,31 @@ func (cs *LuetCompiler) stripFromRootfs(includes []string, rootfs string, includ
 	return nil
 }
 
+// newArtifact returns the artifact of the package of the spec, to be compressed
+func (cs *LuetCompiler) newArtifact(p CompilationSpec) Artifact {
+	artifact := NewPackageArtifact(p.Rel(p.GetPackage().GetArtifactFingerPrint() + ".package.tar"))
+	artifact.SetCompressionType(cs.CompressionType)
+	if cs.Options.Reproducible {
+		artifact.SetReproducible(sourceDateEpoch(p))
+	}
+	return artifact
+}
+
+// sourceDateEpoch returns the time the mtimes of reproducible archives are
+// clamped to: the one of the spec, $SOURCE_DATE_EPOCH, or the unix epoch.
+func sourceDateEpoch(p CompilationSpec) time.Time {
+	if p.GetSourceDateEpoch() != 0 {
+		return time.Unix(p.GetSourceDateEpoch(), 0)
+	}
+	if env := os.Getenv("SOURCE_DATE_EPOCH"); env != "" {
+		if epoch, err := strconv.ParseInt(env, 10, 64); err == nil {
+			return time.Unix(epoch, 0)
+		}
+		Warning("Invalid SOURCE_DATE_EPOCH", env)
+	}
+	return time.Unix(0, 0)
+}
+
 func (cs *LuetCompiler) unpackFs(rootfs string, concurrency int, p CompilationSpec) (Artifact, error) {
 	if p.GetPackageDir() != "" {
 		Info(":tophat: Packing from output dir", p.GetPackageDir())
@@ -251,9 +257,7 @@ func (cs *LuetCompiler) unpackFs(rootfs string, concurrency int, p CompilationSp
 		// strip from includes
 		cs.stripFromRootfs(p.GetExcludes(), rootfs, false)
 	}
-	artifact := NewPackageArtifact(p.Rel(p.GetPackage().GetFingerPrint() + ".package.tar"))
-	artifact.SetCompressionType(cs.CompressionType)
-
+	artifact := cs.newArtifact(p)
 	if err := artifact.Compress(rootfs, concurrency); err != nil {
 		return nil, errors.Wrap(err, "Error met while creating package archive")
 	}
@@ -262,7 +266,10 @@ func (cs *LuetCompiler) unpackFs(rootfs string, concurrency int, p CompilationSp
 	return artifact, nil
 }
 
-func (cs *LuetCompiler) unpackDelta(rootfs string, concurrency int, keepPermissions bool, p CompilationSpec, builderOpts, runnerOpts CompilerBackendOptions) (Artifact, error) {
+// unpackDelta generates an artifact for each of the specs, with the files
+// added by the package image matching their includes and excludes
+func (cs *LuetCompiler) unpackDelta(rootfs string, concurrency int, keepPermissions bool, specs []CompilationSpec, builderOpts, runnerOpts CompilerBackendOptions) ([]Artifact, error) {
+	p := specs[0]
 	pkgTag := ":package: " + p.GetPackage().HumanReadableString()
 	if cs.Options.PullFirst && !cs.Backend.ImageExists(builderOpts.ImageName) && cs.Backend.ImageAvailable(builderOpts.ImageName) {
 		err := cs.Backend.DownloadImage(builderOpts)
@@ -283,13 +290,16 @@ func (cs *LuetCompiler) unpackDelta(rootfs string, concurrency int, keepPermissi
 	if err != nil {
 		return nil, errors.Wrap(err, "Could not generate changes from layers")
 	}
-	artifact, err := ExtractArtifactFromDelta(rootfs, p.Rel(p.GetPackage().GetFingerPrint()+".package.tar"), diffs, concurrency, keepPermissions, p.GetIncludes(), p.GetExcludes(), cs.CompressionType)
-	if err != nil {
-		return nil, errors.Wrap(err, "Could not generate deltas")
+	artifacts := []Artifact{}
+	for _, spec := range specs {
+		artifact, err := extractArtifactFromDelta(rootfs, cs.newArtifact(spec), diffs, concurrency, keepPermissions, spec.GetIncludes(), spec.GetExcludes())
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not generate deltas")
+		}
+		artifact.SetCompileSpec(spec)
+		artifacts = append(artifacts, artifact)
 	}
-
-	artifact.SetCompileSpec(p)
-	return artifact, nil
+	return artifacts, nil
 }
 
 func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImage string,
@@ -348,6 +358,10 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		}
 	}
 
+	if err := cs.placeSources(p, buildDir); err != nil {
+		return builderOpts, runnerOpts, err
+	}
+
 	// First we create the builder image
 	if err := p.WriteBuildImageDefinition(filepath.Join(buildDir, p.GetPackage().GetFingerPrint()+"-builder.dockerfile")); err != nil {
 		return builderOpts, runnerOpts, errors.Wrap(err, "Could not generate image definition")
@@ -362,51 +376,75 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		return builderOpts, runnerOpts, errors.Wrap(err, "Could not generate image definition")
 	}
 
+	// The output of the builds of the package is collected in its log, which
+	// is truncated at every new build
+	logFile := p.Rel(buildLog(p))
+	if err := os.MkdirAll(filepath.Dir(logFile), os.ModePerm); err != nil {
+		return builderOpts, runnerOpts, errors.Wrap(err, "Error met while creating logs dir")
+	}
+	header := time.Now().Format(time.RFC3339) + " Building " + p.GetPackage().HumanReadableString() + " from " + image + "\n"
+	if err := ioutil.WriteFile(logFile, []byte(header), 0644); err != nil {
+		return builderOpts, runnerOpts, errors.Wrap(err, "Error met while creating build log")
+	}
+
 	builderOpts = CompilerBackendOptions{
 		ImageName:      buildertaggedImage,
 		SourcePath:     buildDir,
 		DockerFileName: p.GetPackage().GetFingerPrint() + "-builder.dockerfile",
-		Destination:    p.Rel(p.GetPackage().GetFingerPrint() + "-builder.image.tar"),
+		Destination:    p.Rel(p.GetPackage().GetArtifactFingerPrint() + "-builder.image.tar"),
+		Platform:       cs.Options.Platform,
+		NoCache:        cs.Options.NoCache,
+		LogFile:        logFile,
 	}
 	runnerOpts = CompilerBackendOptions{
 		ImageName:      packageImage,
 		SourcePath:     buildDir,
 		DockerFileName: p.GetPackage().GetFingerPrint() + ".dockerfile",
-		Destination:    p.Rel(p.GetPackage().GetFingerPrint() + ".image.tar"),
+		Destination:    p.Rel(p.GetPackage().GetArtifactFingerPrint() + ".image.tar"),
+		Platform:       cs.Options.Platform,
+		NoCache:        cs.Options.NoCache,
+		LogFile:        logFile,
 	}
 
-	buildAndPush := func(opts CompilerBackendOptions) error {
-		buildImage := true
+	// buildImage builds the image, unless it can be pulled, and returns true
+	// if it was built
+	buildImage := func(opts CompilerBackendOptions) (bool, error) {
 		if cs.Options.PullFirst {
 			bus.Manager.Publish(bus.EventImagePrePull, opts)
 			err := cs.Backend.DownloadImage(opts)
+			bus.Manager.Publish(bus.EventImagePostPull, opts)
 			if err == nil {
-				buildImage = false
-			} else {
-				Warning("Failed to download '" + opts.ImageName + "'. Will keep going and build the image unless you use --fatal")
-				Warning(err.Error())
+				return false, nil
 			}
-			bus.Manager.Publish(bus.EventImagePostPull, opts)
+			Warning("Failed to download '" + opts.ImageName + "'. Will keep going and build the image unless you use --fatal")
+			Warning(err.Error())
 		}
-		if buildImage {
-			bus.Manager.Publish(bus.EventImagePreBuild, opts)
-			if err := cs.Backend.BuildImage(opts); err != nil {
-				return errors.Wrap(err, "Could not build image: "+image+" "+opts.DockerFileName)
-			}
-			bus.Manager.Publish(bus.EventImagePostBuild, opts)
-			if cs.Options.Push {
-				bus.Manager.Publish(bus.EventImagePrePush, opts)
-				if err = cs.Backend.Push(opts); err != nil {
-					return errors.Wrap(err, "Could not push image: "+image+" "+opts.DockerFileName)
-				}
-				bus.Manager.Publish(bus.EventImagePostPush, opts)
-			}
+		bus.Manager.Publish(bus.EventImagePreBuild, opts)
+		if err := cs.Backend.BuildImage(opts); err != nil {
+			return false, errors.Wrap(err, "Could not build image: "+image+" "+opts.DockerFileName)
 		}
+		bus.Manager.Publish(bus.EventImagePostBuild, opts)
+		return true, nil
+	}
+	pushImage := func(opts CompilerBackendOptions) error {
+		if !cs.Options.Push {
+			return nil
+		}
+		bus.Manager.Publish(bus.EventImagePrePush, opts)
+		if err := cs.Backend.Push(opts); err != nil {
+			return errors.Wrap(err, "Could not push image: "+image+" "+opts.DockerFileName)
+		}
+		bus.Manager.Publish(bus.EventImagePostPush, opts)
 		return nil
 	}
+
 	if len(p.GetPreBuildSteps()) != 0 {
 		Info(pkgTag, ":whale: Generating 'builder' image from", image, "as", buildertaggedImage, "with prelude steps")
-		if err := buildAndPush(builderOpts); err != nil {
+		built, err := buildImage(builderOpts)
+		if err == nil && built {
+			err = pushImage(builderOpts)
+		}
+		if err != nil {
 			return builderOpts, runnerOpts, errors.Wrap(err, "Could not push image: "+image+" "+builderOpts.DockerFileName)
 		}
 	}
@@ -414,17 +452,52 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 	// Even if we might not have any steps to build, we do that so we can tag the image used in this moment and use that to cache it in a registry, or in the system.
 	// acting as a docker tag.
 	Info(pkgTag, ":whale: Generating 'package' image from", buildertaggedImage, "as", packageImage, "with build steps")
-	if err := buildAndPush(runnerOpts); err != nil {
+	built, err := buildImage(runnerOpts)
+	if err != nil {
 		return builderOpts, runnerOpts, errors.Wrap(err, "Could not push image: "+image+" "+builderOpts.DockerFileName)
 	}
 
+	// Tests run on top of the package image, and their layer is thrown away.
+	// The image is pushed only once they pass, so untested images are never
+	// reused by other builds.
+	if len(p.GetTestSteps()) != 0 {
+		testOpts := CompilerBackendOptions{
+			ImageName:      cs.ImageRepository + ":test-" + fp,
+			SourcePath:     buildDir,
+			DockerFileName: p.GetPackage().GetFingerPrint() + "-test.dockerfile",
+			Platform:       cs.Options.Platform,
+			NoCache:        true,
+			LogFile:        logFile,
+		}
+		if err := p.WriteTestImageDefinition(packageImage, filepath.Join(buildDir, testOpts.DockerFileName)); err != nil {
+			return builderOpts, runnerOpts, errors.Wrap(err, "Could not generate image definition")
+		}
+
+		Info(pkgTag, ":test_tube: Running tests on", packageImage)
+		if err := cs.Backend.BuildImage(testOpts); err != nil {
+			return builderOpts, runnerOpts, errors.Wrap(err, "Tests failed for "+p.GetPackage().HumanReadableString())
+		}
+		if err := cs.Backend.RemoveImage(testOpts); err != nil {
+			Warning("Could not remove image ", testOpts.ImageName)
+		}
+		Info(pkgTag, ":white_check_mark: Tests passed")
+	}
+
+	if built {
+		if err := pushImage(runnerOpts); err != nil {
+			return builderOpts, runnerOpts, errors.Wrap(err, "Could not push image: "+image+" "+builderOpts.DockerFileName)
+		}
+	}
+
 	return builderOpts, runnerOpts, nil
 }
 
-func (cs *LuetCompiler) genArtifact(p CompilationSpec, builderOpts, runnerOpts CompilerBackendOptions, concurrency int, keepPermissions bool) (Artifact, error) {
+// genArtifact generates the artifact of the package from its package image,
+// along with the ones of its subpackages, and returns the former.
+func (cs *LuetCompiler) genArtifact(p CompilationSpec, builderOpts, runnerOpts CompilerBackendOptions, hash solver.PackageHash, sourceHash string, started time.Time, concurrency int, keepPermissions bool) (Artifact, error) {
 
 	// generate Artifact
-	var artifact Artifact
+	var artifacts []Artifact
 	var rootfs string
 	var err error
 	unpack := p.ImageUnpack()
@@ -437,7 +510,7 @@ func (cs *LuetCompiler) genArtifact(p CompilationSpec, builderOpts, runnerOpts C
 	}
 
 	if len(p.BuildSteps()) == 0 && len(p.GetPreBuildSteps()) == 0 && !unpack {
-		fakePackage := p.Rel(p.GetPackage().GetFingerPrint() + ".package.tar")
+		fakePackage := p.Rel(p.GetPackage().GetArtifactFingerPrint() + ".package.tar")
 		// We can't generate delta in this case. It implies the package is a virtual, and nothing has to be done really
 
 		file, err := os.Create(fakePackage)
@@ -476,35 +549,89 @@ func (cs *LuetCompiler) genArtifact(p CompilationSpec, builderOpts, runnerOpts C
 		return nil, errors.Wrap(err, "Could not extract rootfs")
 	}
 
+	specs := []CompilationSpec{p}
+	subpackages, err := cs.subpackageSpecs(p)
+	if err != nil {
+		return nil, err
+	}
+	specs = append(specs, subpackages...)
+
 	if unpack {
 		// Take content of container as a base for our package files
-		artifact, err = cs.unpackFs(rootfs, concurrency, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Error met while extracting image")
+		for i, spec := range specs {
+			// Includes and excludes are applied stripping the rootfs,
+			// so each subpackage gets its own copy
+			src := rootfs
+			if i < len(specs)-1 {
+				src, err = ioutil.TempDir(p.GetOutputPath(), "rootfs")
+				if err != nil {
+					return nil, errors.Wrap(err, "Could not create tempdir")
+				}
+				defer os.RemoveAll(src) // clean up
+				if err := helpers.CopyDir(rootfs, src); err != nil {
+					return nil, errors.Wrap(err, "Could not copy rootfs")
+				}
+			}
+			artifact, err := cs.unpackFs(src, concurrency, spec)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error met while extracting image")
+			}
+			artifacts = append(artifacts, artifact)
 		}
 	} else {
 		// Generate delta between the two images
-		artifact, err = cs.unpackDelta(rootfs, concurrency, keepPermissions, p, builderOpts, runnerOpts)
+		artifacts, err = cs.unpackDelta(rootfs, concurrency, keepPermissions, specs, builderOpts, runnerOpts)
 		if err != nil {
 			return nil, errors.Wrap(err, "Error met while generating delta")
 		}
 	}
 
-	filelist, err := artifact.FileList()
-	if err != nil {
-		return artifact, errors.Wrap(err, "Failed getting package list")
-	}
+	for _, artifact := range artifacts {
+		spec := artifact.GetCompileSpec()
+		filelist, err := artifact.FileList()
+		if err != nil {
+			return artifact, errors.Wrap(err, "Failed getting package list")
+		}
 
-	artifact.SetFiles(filelist)
-	artifact.GetCompileSpec().GetPackage().SetBuildTimestamp(time.Now().String())
+		artifact.SetFiles(filelist)
+		artifact.GetCompileSpec().GetPackage().SetBuildTimestamp(time.Now().String())
 
-	err = artifact.WriteYaml(p.GetOutputPath())
-	if err != nil {
-		return artifact, errors.Wrap(err, "Failed while writing metadata file")
+		provenance, err := cs.newProvenance(spec, builderOpts, runnerOpts, hash, started)
+		if err != nil {
+			return artifact, errors.Wrap(err, "Failed generating provenance")
+		}
+		ref, err := provenance.Write(spec.Rel(spec.GetPackage().GetArtifactFingerPrint() + ".provenance.json"))
+		if err != nil {
+			return artifact, err
+		}
+		artifact.SetProvenance(ref)
+		// Subpackages share the sources and the build log of the package
+		artifact.SetSourceHash(sourceHash)
+		artifact.SetBuildLog(buildLog(p))
+
+		err = artifact.WriteYaml(spec.GetOutputPath())
+		if err != nil {
+			return artifact, errors.Wrap(err, "Failed while writing metadata file")
+		}
 	}
 	Info(pkgTag, "   :white_check_mark: Done")
 
-	return artifact, nil
+	return artifacts[0], nil
+}
+
+// buildLog returns the path of the build log of the package, relative to the
+// output folder. The variant and the architecture are appended, if any, so
+// that their builds don't overwrite each other's log
+func buildLog(p CompilationSpec) string {
+	pack := p.GetPackage()
+	name := pack.GetCategory() + "-" + pack.GetName() + "-" + pack.GetVersion()
+	if pack.GetVariant() != "" {
+		name += "-" + pack.GetVariant()
+	}
+	if pack.GetArch() != "" {
+		name += "-" + pack.GetArch()
+	}
+	return filepath.Join("logs", name+".log")
 }
 
 func (cs *LuetCompiler) waitForImage(image string) {
@@ -520,9 +647,11 @@ func (cs *LuetCompiler) waitForImage(image string) {
 }
 
 func (cs *LuetCompiler) compileWithImage(image, buildertaggedImage, packageImage string,
+	hash solver.PackageHash, sourceHash string,
 	concurrency int,
 	keepPermissions, keepImg bool,
 	p CompilationSpec, generateArtifact bool) (Artifact, error) {
+	started := time.Now()
 
 	if !generateArtifact {
 		exists := cs.Backend.ImageExists(packageImage)
@@ -538,7 +667,7 @@ func (cs *LuetCompiler) compileWithImage(image, buildertaggedImage, packageImage
 
 	builderOpts, runnerOpts, err := cs.buildPackageImage(image, buildertaggedImage, packageImage, concurrency, keepPermissions, p)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed building package image")
+		return nil, errors.Wrap(err, "failed building package image, see the build log "+p.Rel(buildLog(p)))
 	}
 
 	if !keepImg {
@@ -557,7 +686,7 @@ func (cs *LuetCompiler) compileWithImage(image, buildertaggedImage, packageImage
 		return &PackageArtifact{}, nil
 	}
 
-	return cs.genArtifact(p, builderOpts, runnerOpts, concurrency, keepPermissions)
+	return cs.genArtifact(p, builderOpts, runnerOpts, hash, sourceHash, started, concurrency, keepPermissions)
 }
 
 func (cs *LuetCompiler) FromDatabase(db pkg.PackageDatabase, minimum bool, dst string) ([]CompilationSpec, error) {
@@ -643,139 +772,54 @@ func (cs *LuetCompiler) Compile(keepPermissions bool, p CompilationSpec) (Artifa
 		panic(err)
 	}
 	p.SetSourceAssertion(asserts)
-	return cs.compile(cs.Concurrency, keepPermissions, p)
-}
 
-func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, p CompilationSpec) (Artifact, error) {
-	Info(":package: Compiling", p.GetPackage().HumanReadableString(), ".... :coffee:")
-
-	if len(p.GetPackage().GetRequires()) == 0 && p.GetImage() == "" {
-		Error("Package with no deps and no seed image supplied, bailing out")
-		return nil, errors.New("Package " + p.GetPackage().GetFingerPrint() +
-			" with no deps and no seed image supplied, bailing out")
+	artifacts, errs := cs.schedule(keepPermissions, []CompilationSpec{p}, 0)
+	if len(errs) != 0 {
+		return nil, errs[0]
 	}
-
-	targetAssertion := p.GetSourceAssertion().Search(p.GetPackage().GetFingerPrint())
-	targetPackageHash := cs.ImageRepository + ":" + targetAssertion.Hash.PackageHash
-
-	bus.Manager.Publish(bus.EventPackagePreBuild, struct {
-		CompileSpec CompilationSpec
-		Assert      solver.PackageAssert
-	}{
-		CompileSpec: p,
-		Assert:      *targetAssertion,
-	})
-
-	// - If image is set we just generate a plain dockerfile
-	// Treat last case (easier) first. The image is provided and we just compute a plain dockerfile with the images listed as above
-	if p.GetImage() != "" {
-		return cs.compileWithImage(p.GetImage(), "", targetPackageHash, concurrency, keepPermissions, cs.KeepImg, p, true)
+	if len(artifacts) == 0 {
+		return nil, errors.New("No artifact generated for " + p.GetPackage().HumanReadableString())
 	}
+	return artifacts[0], nil
+}
 
-	// - If image is not set, we read a base_image. Then we will build one image from it to kick-off our build based
-	// on how we compute the resolvable tree.
-	// This means to recursively build all the build-images needed to reach that tree part.
-	// - We later on compute an hash used to identify the image, so each similar deptree keeps the same build image.
-
-	dependencies := p.GetSourceAssertion().Drop(p.GetPackage()) // at this point we should have a flattened list of deps to build, including all of them (with all constraints propagated already)
-	departifacts := []Artifact{}                                // TODO: Return this somehow
-	var lastHash string
-	depsN := 0
-	currentN := 0
-
-	packageDeps := !cs.Options.PackageTargetOnly
-	if !cs.Options.NoDeps {
-		Info(":deciduous_tree: Build dependencies for " + p.GetPackage().HumanReadableString())
-		for _, assertion := range dependencies { //highly dependent on the order
-			depsN++
-			Info(" :arrow_right_hook:", assertion.Package.HumanReadableString(), ":leaves:")
-		}
+// imageName returns the image used to cache the build step with the given hash.
+// Images of different platforms are kept apart.
+func (cs *LuetCompiler) imageName(hash string) string {
+	tag := hash
+	if cs.Options.Variant != "" {
+		tag += "-" + cs.Options.Variant
+	}
+	if arch := cs.Options.Arch(); arch != "" {
+		tag += "-" + arch
+	}
+	return cs.ImageRepository + ":" + tag
+}
 
-		for _, assertion := range dependencies { //highly dependent on the order
-			currentN++
-			pkgTag := fmt.Sprintf(":package: %d/%d %s ⤑ :hammer: build %s", currentN, depsN, p.GetPackage().HumanReadableString(), assertion.Package.HumanReadableString())
-			Info(pkgTag, " starts")
-			compileSpec, err := cs.FromPackage(assertion.Package)
-			if err != nil {
-				return nil, errors.Wrap(err, "Error while generating compilespec for "+assertion.Package.GetName())
-			}
-			compileSpec.SetOutputPath(p.GetOutputPath())
-
-			buildImageHash := cs.ImageRepository + ":" + assertion.Hash.BuildHash
-			currentPackageImageHash := cs.ImageRepository + ":" + assertion.Hash.PackageHash
-			Debug(pkgTag, "    :arrow_right_hook: :whale: Builder image from", buildImageHash)
-			Debug(pkgTag, "    :arrow_right_hook: :whale: Package image name", currentPackageImageHash)
-
-			bus.Manager.Publish(bus.EventPackagePreBuild, struct {
-				CompileSpec CompilationSpec
-				Assert      solver.PackageAssert
-			}{
-				CompileSpec: compileSpec,
-				Assert:      assertion,
-			})
-
-			lastHash = currentPackageImageHash
-			if compileSpec.GetImage() != "" {
-				Debug(pkgTag, " :wrench: Compiling "+compileSpec.GetPackage().HumanReadableString()+" from image")
-				artifact, err := cs.compileWithImage(compileSpec.GetImage(), buildImageHash, currentPackageImageHash, concurrency, keepPermissions, cs.KeepImg, compileSpec, packageDeps)
-				if err != nil {
-					return nil, errors.Wrap(err, "Failed compiling "+compileSpec.GetPackage().HumanReadableString())
-				}
-				departifacts = append(departifacts, artifact)
-				Info(pkgTag, ":white_check_mark: Done")
-				continue
-			}
+type templatedata map[string]interface{}
 
-			Debug(pkgTag, " :wrench: Compiling "+compileSpec.GetPackage().HumanReadableString()+" from tree")
-			artifact, err := cs.compileWithImage(buildImageHash, "", currentPackageImageHash, concurrency, keepPermissions, cs.KeepImg, compileSpec, packageDeps)
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed compiling "+compileSpec.GetPackage().HumanReadableString())
-				//	deperrs = append(deperrs, err)
-				//		break // stop at first error
+// mergeValues merges the values file into the template values of the package.
+// The use entries of the values file are defaults, the flags enabled on the
+// package take precedence over them.
+func mergeValues(d, values map[string]interface{}) {
+	for k, v := range values {
+		if k != "use" {
+			d[k] = v
+			continue
+		}
+		uses, ok := v.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		enabled := d["use"].(map[string]interface{})
+		for flag, value := range uses {
+			if _, ok := enabled[fmt.Sprint(flag)]; !ok {
+				enabled[fmt.Sprint(flag)] = value
 			}
-
-			bus.Manager.Publish(bus.EventPackagePostBuild, struct {
-				CompileSpec CompilationSpec
-				Artifact    Artifact
-			}{
-				CompileSpec: compileSpec,
-				Artifact:    artifact,
-			})
-
-			departifacts = append(departifacts, artifact)
-			Info(pkgTag, ":white_check_mark: Done")
-		}
-
-	} else if len(dependencies) > 0 {
-		lastHash = cs.ImageRepository + ":" + dependencies[len(dependencies)-1].Hash.PackageHash
-	}
-
-	if !cs.Options.OnlyDeps {
-		Info(":rocket: All dependencies are satisfied, building package requested by the user", p.GetPackage().HumanReadableString())
-		Info(":package:", p.GetPackage().HumanReadableString(), " Using image: ", lastHash)
-		artifact, err := cs.compileWithImage(lastHash, "", targetPackageHash, concurrency, keepPermissions, cs.KeepImg, p, true)
-		if err != nil {
-			return artifact, err
 		}
-		artifact.SetDependencies(departifacts)
-		artifact.SetSourceAssertion(p.GetSourceAssertion())
-
-		bus.Manager.Publish(bus.EventPackagePostBuild, struct {
-			CompileSpec CompilationSpec
-			Artifact    Artifact
-		}{
-			CompileSpec: p,
-			Artifact:    artifact,
-		})
-
-		return artifact, err
-	} else {
-		return departifacts[len(departifacts)-1], nil
 	}
 }
 
-type templatedata map[string]interface{}
-
 func (cs *LuetCompiler) FromPackage(p pkg.Package) (CompilationSpec, error) {
 
 	pack, err := cs.Database.FindPackageCandidate(p)
@@ -785,6 +829,19 @@ func (cs *LuetCompiler) FromPackage(p pkg.Package) (CompilationSpec, error) {
 
 	var dataresult []byte
 
+	d := pkg.UseValues(pack)
+	if len(cs.Options.BuildValuesFile) > 0 {
+		defBuild, err := ioutil.ReadFile(cs.Options.BuildValuesFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering file "+cs.Options.BuildValuesFile)
+		}
+		values := map[string]interface{}{}
+		err = yaml.Unmarshal(defBuild, &values)
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering file "+cs.Options.BuildValuesFile)
+		}
+		mergeValues(d, values)
+	}
 	val := pack.Rel(DefinitionFile)
 	if _, err := os.Stat(pack.Rel(CollectionFile)); err == nil {
 		val = pack.Rel(CollectionFile)
@@ -802,32 +859,30 @@ func (cs *LuetCompiler) FromPackage(p pkg.Package) (CompilationSpec, error) {
 
 		raw := packsRaw.Find(pack.GetName(), pack.GetCategory(), pack.GetVersion())
 
-		d := map[string]interface{}{}
-		if len(cs.Options.BuildValuesFile) > 0 {
-			defBuild, err := ioutil.ReadFile(cs.Options.BuildValuesFile)
-			if err != nil {
-				return nil, errors.Wrap(err, "rendering file "+val)
-			}
-			err = yaml.Unmarshal(defBuild, &d)
-			if err != nil {
-				return nil, errors.Wrap(err, "rendering file "+val)
-			}
-		}
-
 		dat, err := helpers.RenderHelm(string(dataBuild), raw, d)
 		if err != nil {
 			return nil, errors.Wrap(err, "rendering file "+pack.Rel(BuildFile))
 		}
 		dataresult = []byte(dat)
 	} else {
-		out, err := helpers.RenderFiles(pack.Rel(BuildFile), val, cs.Options.BuildValuesFile)
+		out, err := helpers.RenderFilesWithDefaults(pack.Rel(BuildFile), val, d)
 		if err != nil {
 			return nil, errors.Wrap(err, "rendering file "+pack.Rel(BuildFile))
 		}
 		dataresult = []byte(out)
 	}
 
-	return NewLuetCompilationSpec(dataresult, pack)
+	spec, err := NewLuetCompilationSpec(dataresult, pack)
+	if err != nil {
+		return nil, err
+	}
+	if arch := cs.Options.Arch(); arch != "" {
+		spec.GetPackage().SetArch(arch)
+	}
+	if cs.Options.Variant != "" {
+		spec.GetPackage().SetVariant(cs.Options.Variant)
+	}
+	return spec, nil
 }
 
 func (cs *LuetCompiler) GetBackend() CompilerBackend {
@@ -868,6 +868,99 @@ var _ = Describe("Compiler", func() {
 		})
 	})
 
+	Context("Test steps", func() {
+		It("Run on the package image without being part of the artifact", func() {
+			generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			tmpdir, err := ioutil.TempDir("", "package")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			err = generalRecipe.Load("../../tests/fixtures/buildtest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(generalRecipe.GetDatabase().GetPackages())).To(Equal(2))
+
+			compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+
+			spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "pass", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			spec.SetOutputPath(tmpdir)
+			compiler.SetConcurrency(1)
+
+			artifacts, errs := compiler.CompileParallel(false, NewLuetCompilationspecs(spec))
+			Expect(errs).To(BeNil())
+			Expect(len(artifacts)).To(Equal(1))
+			Expect(artifacts[0].GetFiles()).To(ContainElement("artifact"))
+			Expect(artifacts[0].GetFiles()).ToNot(ContainElement("tested"))
+		})
+
+		It("Fail the build when failing", func() {
+			generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			tmpdir, err := ioutil.TempDir("", "package")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			err = generalRecipe.Load("../../tests/fixtures/buildtest")
+			Expect(err).ToNot(HaveOccurred())
+
+			compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+
+			spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "fail", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			spec.SetOutputPath(tmpdir)
+			compiler.SetConcurrency(1)
+
+			_, errs := compiler.CompileParallel(false, NewLuetCompilationspecs(spec))
+			Expect(len(errs)).To(Equal(1))
+			Expect(errs[0].Error()).To(ContainSubstring("Tests failed"))
+			Expect(helpers.Exists(spec.Rel("fail-test-1.0.package.tar"))).To(BeFalse())
+
+			log, err := helpers.Read(spec.Rel("logs/test-fail-1.0.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(log).To(ContainSubstring("test -f /missing"))
+		})
+	})
+
+	Context("Subpackages", func() {
+		It("Are split from the build of their parent", func() {
+			generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			tmpdir, err := ioutil.TempDir("", "package")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			err = generalRecipe.Load("../../tests/fixtures/subpackages")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(generalRecipe.GetDatabase().GetPackages())).To(Equal(4))
+
+			compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+
+			spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "bar", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			spec.SetOutputPath(tmpdir)
+			compiler.SetConcurrency(1)
+
+			artifacts, errs := compiler.CompileParallel(false, NewLuetCompilationspecs(spec))
+			Expect(errs).To(BeNil())
+			Expect(len(artifacts)).To(Equal(1))
+			Expect(artifacts[0].GetFiles()).To(ContainElement("usr/bin/bar"))
+
+			files := map[string][]string{}
+			for _, name := range []string{"foo", "foo-dev", "foo-doc"} {
+				spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: name, Category: "test", Version: "1.0"})
+				Expect(err).ToNot(HaveOccurred())
+				spec.SetOutputPath(tmpdir)
+				artifact, err := LoadArtifactFromYaml(spec)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(helpers.Exists(artifact.GetPath())).To(BeTrue())
+				files[name] = artifact.GetFiles()
+			}
+			Expect(files["foo"]).To(ContainElement("usr/bin/foo"))
+			Expect(files["foo"]).ToNot(ContainElement("usr/include/foo.h"))
+			Expect(files["foo-dev"]).To(ContainElement("usr/include/foo.h"))
+			Expect(files["foo-dev"]).ToNot(ContainElement("usr/bin/foo"))
+			Expect(files["foo-doc"]).To(ContainElement("usr/share/doc/foo/README"))
+		})
+	})
+
 	Context("Compilation of whole tree", func() {
 		It("doesn't include dependencies that would be compiled anyway", func() {
 			// As some specs are dependent from each other, don't pull it in if they would
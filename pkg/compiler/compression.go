@@ -0,0 +1,141 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// gzipBlockSize is the size of the blocks compressed in parallel by gzip
+const gzipBlockSize = 1 << 20
+
+// Extension returns the suffix of the archives with the compression, which
+// is empty for plain tarballs
+func (c CompressionImplementation) Extension() string {
+	switch c {
+	case Zstandard:
+		return ".zstd"
+	case GZip:
+		return ".gz"
+	case XZ:
+		return ".xz"
+	case LZ4:
+		return ".lz4"
+	default:
+		return ""
+	}
+}
+
+// compressor returns a writer compressing into w, using up to concurrency
+// goroutines where the algorithm supports it. Reproducible artifacts are
+// compressed with settings yielding the same output on each run.
+func (a *PackageArtifact) compressor(w io.Writer, concurrency int) (io.WriteCloser, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	switch a.CompressionType {
+	case Zstandard:
+		var opts []zstd.EOption
+		if a.reproducible != nil {
+			// The output of concurrent encoders might vary across runs
+			opts = append(opts, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		}
+		return zstd.NewWriter(w, opts...)
+	case GZip:
+		// Blocks are compressed independently, so the output only depends
+		// on their size
+		gw := gzip.NewWriter(w)
+		if err := gw.SetConcurrency(gzipBlockSize, concurrency); err != nil {
+			return nil, err
+		}
+		return gw, nil
+	case XZ:
+		return xz.NewWriter(w)
+	case LZ4:
+		lw := lz4.NewWriter(w)
+		if err := lw.Apply(lz4.ConcurrencyOption(concurrency)); err != nil {
+			return nil, err
+		}
+		return lw, nil
+	}
+	return nil, errors.New("Unsupported compression type " + string(a.CompressionType))
+}
+
+// artifactReader reads the tar stream of an artifact, decompressing it
+// on the fly
+type artifactReader struct {
+	io.Reader
+	file  *os.File
+	close func()
+}
+
+func (r *artifactReader) Close() error {
+	if r.close != nil {
+		r.close()
+	}
+	return r.file.Close()
+}
+
+// reader returns the uncompressed tar stream of the artifact, which is
+// decompressed while read, without writing it on disk
+func (a *PackageArtifact) reader() (io.ReadCloser, error) {
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open "+a.Path)
+	}
+	r := &artifactReader{file: file}
+	bufferedReader := bufio.NewReader(file)
+
+	switch a.CompressionType {
+	case Zstandard:
+		d, err := zstd.NewReader(bufferedReader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.Reader, r.close = d, d.Close
+	case GZip:
+		// Blocks are read ahead and decompressed in the background
+		d, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.Reader, r.close = d, func() { d.Close() }
+	case XZ:
+		d, err := xz.NewReader(bufferedReader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.Reader = d
+	case LZ4:
+		r.Reader = lz4.NewReader(bufferedReader)
+	// Defaults to tar only (covers when "none" is supplied)
+	default:
+		r.Reader = file
+	}
+	return r, nil
+}
@@ -17,6 +17,8 @@ package compiler
 
 import (
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/mudler/luet/pkg/config"
 	pkg "github.com/mudler/luet/pkg/package"
@@ -35,6 +37,8 @@ type Compiler interface {
 	SetBackend(CompilerBackend)
 	GetBackend() CompilerBackend
 	SetCompressionType(t CompressionImplementation)
+	SetArtifactCache(ArtifactCache)
+	GetBuildReport() *BuildReport
 }
 
 type CompilerBackendOptions struct {
@@ -42,6 +46,13 @@ type CompilerBackendOptions struct {
 	SourcePath     string
 	DockerFileName string
 	Destination    string
+
+	// Platform is the target platform of the build, e.g. linux/arm64
+	Platform string
+
+	NoCache bool
+	// LogFile is the file the build output is appended to, if set
+	LogFile string
 }
 
 type CompilerOptions struct {
@@ -56,8 +67,49 @@ type CompilerOptions struct {
 	NoDeps          bool
 	SolverOptions   config.LuetSolverOptions
 	BuildValuesFile string
+	// Variant is the name of the build variant of the values file, if any.
+	// Artifacts and images are tagged with it.
+	Variant string
 
 	PackageTargetOnly bool
+
+	// Platform is the target platform of the build, e.g. linux/arm64.
+	// Artifacts are tagged with its architecture.
+	Platform string
+
+	// BackendType is the name of the backend, recorded in the provenance
+	BackendType string
+
+	// Reproducible generates archives depending only on the package content.
+	// Mtimes are clamped to the source_date_epoch of the package, or to
+	// $SOURCE_DATE_EPOCH.
+	Reproducible bool
+	// NoCache builds the images without using the backend cache
+	NoCache bool
+	// Rebuild builds the packages even if an artifact built from the same
+	// sources is available
+	Rebuild bool
+	// KeepGoing keeps building after a failure, skipping only the packages
+	// depending on the failed ones. Otherwise no package is built after the
+	// first failure, even if independent from the failed one.
+	KeepGoing bool
+
+	// SourceCachePath is where the sources of the specs are cached
+	SourceCachePath string
+	// Offline builds using only the sources already in the cache
+	Offline bool
+}
+
+// Arch returns the architecture of the target platform, if any
+func (opts CompilerOptions) Arch() string {
+	if opts.Platform == "" {
+		return ""
+	}
+	parts := strings.Split(opts.Platform, "/")
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return parts[1]
 }
 
 func NewDefaultCompilerOptions() *CompilerOptions {
@@ -88,6 +140,8 @@ type CompilerBackend interface {
 	ImageAvailable(string) bool
 
 	ImageExists(string) bool
+	// ImageDigest returns the digest of a local image
+	ImageDigest(string) (string, error)
 }
 
 type Artifact interface {
@@ -104,6 +158,7 @@ type Artifact interface {
 	Unpack(dst string, keepPerms bool) error
 	Compress(src string, concurrency int) error
 	SetCompressionType(t CompressionImplementation)
+	GetCompressionType() CompressionImplementation
 	FileList() ([]string, error)
 	Hash() error
 	Verify() error
@@ -113,6 +168,17 @@ type Artifact interface {
 
 	GetChecksums() Checksums
 	SetChecksums(c Checksums)
+
+	GetProvenance() *ProvenanceReference
+	SetProvenance(*ProvenanceReference)
+
+	SetReproducible(epoch time.Time)
+
+	GetSourceHash() string
+	SetSourceHash(string)
+
+	GetBuildLog() string
+	SetBuildLog(string)
 }
 
 type ArtifactNode struct {
@@ -155,6 +221,9 @@ type CompilationSpec interface {
 	RenderStepImage(image string) (string, error)
 	WriteStepImageDefinition(fromimage, path string) error
 
+	RenderTestImage(image string) (string, error)
+	WriteTestImageDefinition(fromimage, path string) error
+
 	GetPackage() pkg.Package
 	BuildSteps() []string
 
@@ -169,6 +238,7 @@ type CompilationSpec interface {
 	Rel(string) string
 
 	GetPreBuildSteps() []string
+	GetTestSteps() []string
 
 	GetSourceAssertion() solver.PackagesAssertions
 	SetSourceAssertion(as solver.PackagesAssertions)
@@ -176,8 +246,13 @@ type CompilationSpec interface {
 	GetRetrieve() []string
 	CopyRetrieves(dest string) error
 
+	GetSources() []Source
+	GetSubpackages() []Subpackage
+
 	SetPackageDir(string)
 	GetPackageDir() string
+
+	GetSourceDateEpoch() int64
 }
 
 type CompilationSpecs interface {
@@ -0,0 +1,111 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/mudler/luet/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// MatrixFile declares the variants a tree is built in, at the root of the tree
+const MatrixFile = "matrix.yaml"
+
+// variantName are the names allowed for variants, which are part of image
+// tags and artifact names
+var variantName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.]*$`)
+
+// Variant is a build of the tree with its own values file. The artifacts
+// and images of a named variant are tagged with its name, so the variants of
+// a tree can be built in the same destination and repository.
+type Variant struct {
+	Name   string `json:"name"`
+	Values string `json:"values"`
+}
+
+// BuildMatrix is the content of a matrix file
+type BuildMatrix struct {
+	Variants []Variant `json:"variants"`
+}
+
+// NewBuildMatrix returns the variants the trees are built in. If more than
+// one values file is given, there is a variant for each of them, named after
+// the file. A single values file is built without variant. Otherwise, the
+// variants are the ones declared in the matrix files of the trees, if any.
+func NewBuildMatrix(values []string, trees []string) ([]Variant, error) {
+	variants := []Variant{}
+	switch {
+	case len(values) == 1:
+		return []Variant{{Values: values[0]}}, nil
+	case len(values) > 1:
+		for _, v := range values {
+			name := strings.TrimSuffix(filepath.Base(v), filepath.Ext(v))
+			variants = append(variants, Variant{Name: name, Values: v})
+		}
+	default:
+		for _, t := range trees {
+			matrix, err := LoadBuildMatrix(filepath.Join(t, MatrixFile))
+			if err != nil {
+				return nil, err
+			}
+			variants = append(variants, matrix...)
+		}
+		if len(variants) == 0 {
+			return []Variant{{}}, nil
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, v := range variants {
+		if !variantName.MatchString(v.Name) {
+			return nil, errors.New("Invalid variant name '" + v.Name + "'")
+		}
+		if seen[v.Name] {
+			return nil, errors.New("Variant " + v.Name + " is declared twice")
+		}
+		seen[v.Name] = true
+	}
+	return variants, nil
+}
+
+// LoadBuildMatrix returns the variants declared in the given matrix file,
+// with the values files relative to it. It returns no variants if the file
+// doesn't exist.
+func LoadBuildMatrix(path string) ([]Variant, error) {
+	if !helpers.Exists(path) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading file "+path)
+	}
+	var matrix BuildMatrix
+	if err := yaml.Unmarshal(data, &matrix); err != nil {
+		return nil, errors.Wrap(err, "Error reading matrix "+path)
+	}
+
+	for i, v := range matrix.Variants {
+		if v.Values != "" && !filepath.IsAbs(v.Values) {
+			matrix.Variants[i].Values = filepath.Join(filepath.Dir(path), v.Values)
+		}
+	}
+	return matrix.Variants, nil
+}
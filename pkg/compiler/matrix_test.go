@@ -0,0 +1,102 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+	"github.com/mudler/luet/pkg/tree"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Build matrix", func() {
+	fixture := "../../tests/fixtures/matrix"
+
+	Context("Variants", func() {
+		It("Reads the variants declared by the tree", func() {
+			variants, err := NewBuildMatrix(nil, []string{fixture})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variants).To(Equal([]Variant{
+				{Name: "gcc", Values: filepath.Join(fixture, "values", "gcc.yaml")},
+				{Name: "clang", Values: filepath.Join(fixture, "values", "clang.yaml")},
+			}))
+		})
+
+		It("Builds trees without matrix once", func() {
+			variants, err := NewBuildMatrix(nil, []string{"../../tests/fixtures/buildable"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variants).To(Equal([]Variant{{}}))
+		})
+
+		It("Names a variant after each values file", func() {
+			variants, err := NewBuildMatrix([]string{"a/gcc.yaml", "b/clang.yml"}, []string{fixture})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variants).To(Equal([]Variant{
+				{Name: "gcc", Values: "a/gcc.yaml"},
+				{Name: "clang", Values: "b/clang.yml"},
+			}))
+
+			variants, err = NewBuildMatrix([]string{"a/gcc.yaml"}, []string{fixture})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(variants).To(Equal([]Variant{{Values: "a/gcc.yaml"}}))
+		})
+
+		It("Fails on duplicated or invalid names", func() {
+			_, err := NewBuildMatrix([]string{"a/gcc.yaml", "b/gcc.yaml"}, nil)
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewBuildMatrix([]string{"a/-gcc.yaml", "b/clang.yaml"}, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Compilation", func() {
+		It("Builds each variant with its own values", func() {
+			variants, err := NewBuildMatrix(nil, []string{fixture})
+			Expect(err).ToNot(HaveOccurred())
+
+			hashes := map[string]bool{}
+			for _, v := range variants {
+				generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+				Expect(generalRecipe.Load(fixture)).ToNot(HaveOccurred())
+
+				opts := NewDefaultCompilerOptions()
+				opts.BuildValuesFile = v.Values
+				opts.Variant = v.Name
+				compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), opts, solver.Options{Type: solver.SingleCoreSimple})
+
+				spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "foo", Category: "test", Version: "1.0"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(spec.BuildSteps()).To(Equal([]string{"echo " + v.Name + " > /toolchain"}))
+				Expect(spec.GetPackage().GetVariant()).To(Equal(v.Name))
+				Expect(spec.GetPackage().GetArtifactFingerPrint()).To(Equal("foo-test-1.0-" + v.Name))
+
+				_, err = compiler.ComputeDepTree(spec)
+				Expect(err).ToNot(HaveOccurred())
+				h, err := compiler.(*LuetCompiler).SourceHashes(spec)
+				Expect(err).ToNot(HaveOccurred())
+				hashes[h["foo-test-1.0"]] = true
+			}
+			Expect(len(hashes)).To(Equal(2))
+		})
+	})
+})
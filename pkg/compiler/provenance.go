@@ -0,0 +1,245 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mudler/luet/pkg/helpers"
+	"github.com/mudler/luet/pkg/solver"
+
+	"github.com/pkg/errors"
+)
+
+// Provenance records how an artifact was produced: the images, the solver
+// hashes, the definition files and the steps of the build.
+type Provenance struct {
+	Package  string   `json:"package"`
+	Backend  string   `json:"backend,omitempty"`
+	Platform string   `json:"platform,omitempty"`
+	Variant  string   `json:"variant,omitempty"`
+	UseFlags []string `json:"use_flags,omitempty"`
+
+	SeedImage    ProvenanceImage `json:"seed_image"`
+	BuilderImage ProvenanceImage `json:"builder_image"`
+	PackageImage ProvenanceImage `json:"package_image"`
+
+	PackageHash string `json:"package_hash"`
+	BuildHash   string `json:"build_hash"`
+
+	BuildValues *ProvenanceFile  `json:"build_values,omitempty"`
+	Definition  []ProvenanceFile `json:"definition"`
+
+	Env     []string `json:"env,omitempty"`
+	Prelude []string `json:"prelude,omitempty"`
+	Steps   []string `json:"steps,omitempty"`
+	Test    []string `json:"test,omitempty"`
+	Sources []Source `json:"sources,omitempty"`
+
+	StartedOn  time.Time `json:"started_on"`
+	FinishedOn time.Time `json:"finished_on"`
+}
+
+type ProvenanceImage struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest,omitempty"`
+}
+
+type ProvenanceFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// ProvenanceReference links the provenance document from the artifact metadata
+type ProvenanceReference struct {
+	Path      string    `json:"path"`
+	Checksums Checksums `json:"checksums"`
+}
+
+// LoadProvenance reads a provenance document
+func LoadProvenance(path string) (*Provenance, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading file "+path)
+	}
+	p := &Provenance{}
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading provenance "+path)
+	}
+	return p, nil
+}
+
+// Write writes the provenance document to path, and returns the reference
+// to be stored in the artifact metadata.
+func (p *Provenance) Write(path string) (*ProvenanceReference, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "While marshalling provenance")
+	}
+	err = ioutil.WriteFile(path, data, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "While writing provenance")
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ProvenanceReference{Path: filepath.Base(path), Checksums: Checksums{string(SHA256): sum}}, nil
+}
+
+// Verify checks that the definition files in dir are the ones the artifact
+// was built from.
+func (p *Provenance) Verify(dir string) error {
+	files, err := hashDefinition(dir)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]string{}
+	for _, f := range files {
+		current[f.Path] = f.SHA256
+	}
+
+	var mismatches []string
+	for _, f := range p.Definition {
+		sum, ok := current[f.Path]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, f.Path+" is missing")
+		case sum != f.SHA256:
+			mismatches = append(mismatches, f.Path+" was modified")
+		}
+		delete(current, f.Path)
+	}
+	for f := range current {
+		mismatches = append(mismatches, f+" was added")
+	}
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return fmt.Errorf("definition of %s doesn't match: %v", p.Package, mismatches)
+	}
+	return nil
+}
+
+// Verify checks that the provenance document at path is the one referenced
+func (r *ProvenanceReference) Verify(path string) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	return Checksums{string(SHA256): sum}.Compare(r.Checksums)
+}
+
+// newProvenance collects the provenance of the build of the spec
+func (cs *LuetCompiler) newProvenance(p CompilationSpec, builderOpts, runnerOpts CompilerBackendOptions, hash solver.PackageHash, started time.Time) (*Provenance, error) {
+	definition, err := hashDefinition(p.GetPackage().GetPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed hashing definition of "+p.GetPackage().HumanReadableString())
+	}
+
+	prov := &Provenance{
+		Package:      p.GetPackage().HumanReadableString(),
+		Backend:      cs.Options.BackendType,
+		Platform:     cs.Options.Platform,
+		Variant:      cs.Options.Variant,
+		UseFlags:     p.GetPackage().GetUses(),
+		SeedImage:    cs.provenanceImage(p.GetSeedImage()),
+		BuilderImage: cs.provenanceImage(builderOpts.ImageName),
+		PackageImage: cs.provenanceImage(runnerOpts.ImageName),
+		PackageHash:  hash.PackageHash,
+		BuildHash:    hash.BuildHash,
+		Definition:   definition,
+		StartedOn:    started.UTC(),
+		FinishedOn:   time.Now().UTC(),
+	}
+	if spec, ok := p.(*LuetCompilationSpec); ok {
+		prov.Env = spec.Env
+		prov.Prelude = spec.Prelude
+		prov.Steps = spec.Steps
+		prov.Test = spec.Test
+		prov.Sources = spec.Sources
+	}
+
+	if cs.Options.BuildValuesFile != "" {
+		sum, err := fileSHA256(cs.Options.BuildValuesFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed hashing build values file")
+		}
+		prov.BuildValues = &ProvenanceFile{Path: cs.Options.BuildValuesFile, SHA256: sum}
+	}
+	return prov, nil
+}
+
+func (cs *LuetCompiler) provenanceImage(name string) ProvenanceImage {
+	img := ProvenanceImage{Name: name}
+	if name == "" {
+		return img
+	}
+	digest, err := cs.Backend.ImageDigest(name)
+	if err == nil {
+		img.Digest = digest
+	}
+	return img
+}
+
+// hashDefinition returns the files of the definition folder with their sha256
+func hashDefinition(dir string) ([]ProvenanceFile, error) {
+	var files []ProvenanceFile
+	if dir == "" || !helpers.Exists(dir) {
+		return files, nil
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, ProvenanceFile{Path: rel, SHA256: sum})
+		return nil
+	})
+	return files, err
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,82 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/compiler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Provenance", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "provenance")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "definition.yaml"), []byte("name: foo"), os.ModePerm)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	provenance := func() *Provenance {
+		return &Provenance{
+			Package:     "test/foo-1.0",
+			PackageHash: "abc",
+			BuildHash:   "def",
+			Definition: []ProvenanceFile{
+				{Path: "definition.yaml", SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte("name: foo")))},
+			},
+			Steps: []string{"echo foo > /foo"},
+		}
+	}
+
+	It("is written and read back", func() {
+		ref, err := provenance().Write(filepath.Join(tmpdir, "foo.provenance.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ref.Path).To(Equal("foo.provenance.json"))
+		Expect(ref.Checksums).To(HaveKey("sha256"))
+		Expect(ref.Verify(filepath.Join(tmpdir, "foo.provenance.json"))).ToNot(HaveOccurred())
+
+		p, err := LoadProvenance(filepath.Join(tmpdir, "foo.provenance.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(provenance()))
+
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "foo.provenance.json"), []byte("{}"), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ref.Verify(filepath.Join(tmpdir, "foo.provenance.json"))).To(HaveOccurred())
+	})
+
+	It("verifies the definition files", func() {
+		Expect(provenance().Verify(tmpdir)).ToNot(HaveOccurred())
+
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "build.yaml"), []byte("steps: []"), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(provenance().Verify(tmpdir)).To(HaveOccurred())
+
+		Expect(os.Remove(filepath.Join(tmpdir, "build.yaml"))).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "definition.yaml"), []byte("name: bar"), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(provenance().Verify(tmpdir)).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,183 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	pkg "github.com/mudler/luet/pkg/package"
+
+	"github.com/pkg/errors"
+)
+
+// BuildStatus is the outcome of the build of a package
+type BuildStatus string
+
+const (
+	BuildStatusBuilt BuildStatus = "built"
+	// BuildStatusReused is the status of packages whose artifact was built
+	// from the same sources
+	BuildStatusReused BuildStatus = "reused"
+	// BuildStatusSkipped is the status of packages not built because one of
+	// their dependencies failed
+	BuildStatusSkipped BuildStatus = "skipped"
+	BuildStatusFailed  BuildStatus = "failed"
+)
+
+// errorExcerptLines is the number of lines of the error kept in the report
+const errorExcerptLines = 20
+
+// PackageBuildReport is the outcome of the build of a single package
+type PackageBuildReport struct {
+	Package  string      `json:"package"`
+	Variant  string      `json:"variant,omitempty"`
+	Status   BuildStatus `json:"status"`
+	Duration float64     `json:"duration"`
+	Artifact string      `json:"artifact,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// BuildReport lists the packages handled by the compiler, along with the
+// outcome of their build
+type BuildReport struct {
+	StartedOn  time.Time            `json:"started_on"`
+	FinishedOn time.Time            `json:"finished_on"`
+	Packages   []PackageBuildReport `json:"packages"`
+}
+
+func (r *BuildReport) add(p pkg.Package, status BuildStatus, duration time.Duration, a Artifact, err error) {
+	report := PackageBuildReport{
+		Package:  p.HumanReadableString(),
+		Variant:  p.GetVariant(),
+		Status:   status,
+		Duration: duration.Seconds(),
+	}
+	if a != nil {
+		report.Artifact = a.GetPath()
+	}
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+		if len(lines) > errorExcerptLines {
+			lines = lines[len(lines)-errorExcerptLines:]
+		}
+		report.Error = strings.Join(lines, "\n")
+	}
+	r.Packages = append(r.Packages, report)
+}
+
+// Merge adds the packages of another report, as the builds of the variants
+// of a tree are reported together
+func (r *BuildReport) Merge(o *BuildReport) {
+	if r.StartedOn.IsZero() || (!o.StartedOn.IsZero() && o.StartedOn.Before(r.StartedOn)) {
+		r.StartedOn = o.StartedOn
+	}
+	if o.FinishedOn.After(r.FinishedOn) {
+		r.FinishedOn = o.FinishedOn
+	}
+	r.Packages = append(r.Packages, o.Packages...)
+}
+
+// Count returns the number of packages with the given status
+func (r *BuildReport) Count(status BuildStatus) int {
+	n := 0
+	for _, p := range r.Packages {
+		if p.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteJSON writes the report as JSON to the given path
+func (r *BuildReport) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "While marshalling build report")
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report in the JUnit XML format to the given path,
+// with a test case for each package
+func (r *BuildReport) WriteJUnit(path string) error {
+	suite := junitTestSuite{
+		Name:      "luet build",
+		Tests:     len(r.Packages),
+		Failures:  r.Count(BuildStatusFailed),
+		Skipped:   r.Count(BuildStatusSkipped),
+		Time:      fmt.Sprintf("%.3f", r.FinishedOn.Sub(r.StartedOn).Seconds()),
+		Timestamp: r.StartedOn.UTC().Format(time.RFC3339),
+	}
+	for _, p := range r.Packages {
+		c := junitTestCase{
+			Name:      p.Package,
+			ClassName: "luet.build",
+			Time:      fmt.Sprintf("%.3f", p.Duration),
+		}
+		if p.Variant != "" {
+			c.ClassName += "." + p.Variant
+		}
+		switch p.Status {
+		case BuildStatusFailed:
+			c.Failure = &junitMessage{Message: "build failed", Text: p.Error}
+		case BuildStatusSkipped:
+			c.Skipped = &junitMessage{Message: p.Error}
+		default:
+			c.SystemOut = string(p.Status) + " " + p.Artifact
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "While marshalling build report")
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), data...), 0644)
+}
@@ -0,0 +1,402 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bus "github.com/mudler/luet/pkg/bus"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/license"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+
+	"github.com/pkg/errors"
+)
+
+// buildNode is a package image of the build graph. Nodes are keyed by the
+// image name, which depends on the dependency tree up to the package, so the
+// same node is shared by all the targets with the same tree.
+type buildNode struct {
+	spec       CompilationSpec
+	assertion  solver.PackageAssert
+	sourceHash string
+
+	// image is the package image, built from the seed one. builder is the
+	// tag of the intermediate image with the prelude steps, if fixed.
+	image, seed, builder string
+	// parent is the node building the seed image, if any
+	parent *buildNode
+	// deps are the nodes of all the dependencies of a target, which can be
+	// built on top of other images than the parent one
+	deps     []*buildNode
+	children int
+	// artifact is true if the artifact of the package has to be generated
+	artifact bool
+	// split is true if the package is a subpackage of the parent node, whose
+	// build generates its artifact and package image
+	split bool
+
+	done     chan struct{}
+	result   Artifact
+	err      error
+	status   BuildStatus
+	duration time.Duration
+}
+
+// buildTarget is a package requested to be built
+type buildTarget struct {
+	spec CompilationSpec
+	// node builds the package, it is nil if only the dependencies are built
+	node *buildNode
+	deps []*buildNode
+	// reused is the artifact of the package if it doesn't need to be built
+	reused Artifact
+}
+
+// planTarget adds to the graph the nodes needed to build the spec
+func (cs *LuetCompiler) planTarget(p CompilationSpec, nodes map[string]*buildNode, order *[]*buildNode) (*buildTarget, error) {
+	Info(":package: Compiling", p.GetPackage().HumanReadableString(), ".... :coffee:")
+
+	if len(p.GetPackage().GetRequires()) == 0 && p.GetImage() == "" {
+		Error("Package with no deps and no seed image supplied, bailing out")
+		return nil, errors.New("Package " + p.GetPackage().GetFingerPrint() +
+			" with no deps and no seed image supplied, bailing out")
+	}
+
+	// Refuse to build packages (or their dependencies) not allowed by the license policy
+	packs := pkg.Packages{p.GetPackage()}
+	for _, assertion := range p.GetSourceAssertion() {
+		if assertion.Value && !assertion.Package.Matches(p.GetPackage()) {
+			packs = append(packs, assertion.Package)
+		}
+	}
+	if err := license.NewPolicy(config.LuetCfg.GetLicensePolicy()).Enforce(packs); err != nil {
+		return nil, errors.Wrap(err, "License policy check failed for "+p.GetPackage().HumanReadableString())
+	}
+
+	if subpackageOf(p) != "" {
+		return cs.planSubpackage(p, nodes, order)
+	}
+
+	targetAssertion := p.GetSourceAssertion().Search(p.GetPackage().GetFingerPrint())
+	sourceHashes, err := cs.SourceHashes(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed computing source hashes for "+p.GetPackage().HumanReadableString())
+	}
+
+	t := &buildTarget{spec: p}
+	if !cs.Options.OnlyDeps {
+		if artifact := cs.reuseArtifact(p, sourceHashes[p.GetPackage().GetFingerPrint()], ""); artifact != nil {
+			artifact.SetSourceAssertion(p.GetSourceAssertion())
+			t.reused = artifact
+			return t, nil
+		}
+	}
+
+	// - If image is set we just generate a plain dockerfile.
+	// - If image is not set, the package is built on top of the image of the
+	// last of its dependencies, each built on top of the previous one.
+	var last *buildNode
+	var lastImage string
+	if p.GetImage() == "" {
+		// at this point we should have a flattened list of deps to build, including all of them (with all constraints propagated already)
+		dependencies := p.GetSourceAssertion().Drop(p.GetPackage())
+		if cs.Options.NoDeps {
+			if len(dependencies) > 0 {
+				lastImage = cs.imageName(dependencies[len(dependencies)-1].Hash.PackageHash)
+			}
+		} else {
+			Info(":deciduous_tree: Build dependencies for " + p.GetPackage().HumanReadableString())
+			planned := map[string]*buildNode{}
+			for _, assertion := range dependencies { //highly dependent on the order
+				Info(" :arrow_right_hook:", assertion.Package.HumanReadableString(), ":leaves:")
+
+				image := cs.imageName(assertion.Hash.PackageHash)
+				n, ok := nodes[image]
+				if !ok {
+					spec, err := cs.FromPackage(assertion.Package)
+					if err != nil {
+						return nil, errors.Wrap(err, "Error while generating compilespec for "+assertion.Package.GetName())
+					}
+					spec.SetOutputPath(p.GetOutputPath())
+
+					if parent := subpackageOf(spec); parent != "" {
+						// Subpackages depend on the package they are split from
+						if _, ok := planned[parent]; !ok {
+							return nil, errors.New("Package " + parent + " not found in the dependencies of " + assertion.Package.HumanReadableString())
+						}
+						n = cs.subpackageNode(spec, assertion, planned[parent], nodes, order)
+					} else {
+						n = &buildNode{
+							spec:       spec,
+							assertion:  assertion,
+							sourceHash: sourceHashes[assertion.Package.GetFingerPrint()],
+							image:      image,
+							done:       make(chan struct{}),
+						}
+						if spec.GetImage() != "" {
+							n.seed = spec.GetImage()
+							n.builder = cs.imageName(assertion.Hash.BuildHash)
+						} else {
+							n.seed = cs.imageName(assertion.Hash.BuildHash)
+							n.parent = nodes[n.seed]
+						}
+						nodes[image] = n
+						*order = append(*order, n)
+					}
+				}
+				n.artifact = n.artifact || !cs.Options.PackageTargetOnly
+				if n.split {
+					n.parent.artifact = n.parent.artifact || n.artifact
+				}
+				planned[assertion.Package.GetFingerPrint()] = n
+				t.deps = append(t.deps, n)
+				last = n
+				lastImage = image
+			}
+		}
+	}
+
+	if cs.Options.OnlyDeps {
+		return t, nil
+	}
+
+	image := cs.imageName(targetAssertion.Hash.PackageHash)
+	n, ok := nodes[image]
+	if !ok {
+		n = &buildNode{
+			spec:       p,
+			assertion:  *targetAssertion,
+			sourceHash: sourceHashes[p.GetPackage().GetFingerPrint()],
+			image:      image,
+			done:       make(chan struct{}),
+		}
+		if p.GetImage() != "" {
+			n.seed = p.GetImage()
+		} else {
+			Info(":package:", p.GetPackage().HumanReadableString(), " Using image: ", lastImage)
+			n.seed = lastImage
+			n.parent = last
+		}
+		nodes[image] = n
+		*order = append(*order, n)
+	}
+	for _, d := range t.deps {
+		if !containsNode(n.deps, d) {
+			n.deps = append(n.deps, d)
+		}
+	}
+	n.artifact = true
+	t.node = n
+	return t, nil
+}
+
+func containsNode(nodes []*buildNode, n *buildNode) bool {
+	for _, m := range nodes {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// buildNode builds the package image of the node, and its artifact if required
+func (cs *LuetCompiler) buildNode(n *buildNode, keepPermissions bool) (Artifact, error) {
+	if n.split {
+		return cs.splitNode(n)
+	}
+
+	pkgTag := ":package: " + n.spec.GetPackage().HumanReadableString()
+
+	bus.Manager.Publish(bus.EventPackagePreBuild, struct {
+		CompileSpec CompilationSpec
+		Assert      solver.PackageAssert
+	}{
+		CompileSpec: n.spec,
+		Assert:      n.assertion,
+	})
+
+	if n.artifact {
+		// The image is needed only if other packages are built on top of it
+		image := n.image
+		if n.children == 0 {
+			image = ""
+		}
+		if artifact := cs.reuseArtifact(n.spec, n.sourceHash, image); artifact != nil {
+			n.status = BuildStatusReused
+			return artifact, nil
+		}
+	}
+
+	n.status = BuildStatusBuilt
+	Info(pkgTag, ":hammer: build starts, from", n.seed)
+	Debug(pkgTag, "    :arrow_right_hook: :whale: Package image name", n.image)
+	artifact, err := cs.compileWithImage(n.seed, n.builder, n.image, n.assertion.Hash, n.sourceHash, cs.Concurrency, keepPermissions, cs.KeepImg, n.spec, n.artifact)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed compiling "+n.spec.GetPackage().HumanReadableString())
+	}
+
+	bus.Manager.Publish(bus.EventPackagePostBuild, struct {
+		CompileSpec CompilationSpec
+		Artifact    Artifact
+	}{
+		CompileSpec: n.spec,
+		Artifact:    artifact,
+	})
+	Info(pkgTag, ":white_check_mark: Done")
+	return artifact, nil
+}
+
+// splitNode provides the artifact and the package image of a subpackage,
+// once the package it is split from is built
+func (cs *LuetCompiler) splitNode(n *buildNode) (Artifact, error) {
+	n.status = n.parent.status
+	if n.children > 0 {
+		if err := cs.Backend.CopyImage(n.seed, n.image); err != nil {
+			return nil, errors.Wrap(err, "Failed tagging the image of "+n.spec.GetPackage().HumanReadableString())
+		}
+	}
+	if !n.artifact {
+		return &PackageArtifact{}, nil
+	}
+
+	artifact, err := LoadArtifactFromYaml(n.spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "No artifact generated for subpackage "+n.spec.GetPackage().HumanReadableString())
+	}
+	return artifact, nil
+}
+
+// schedule merges the dependency trees of the specs in a single graph, and
+// builds each node of it once. Nodes are built as soon as the image they are
+// built on top of is ready, running at most Concurrency builds at once.
+// Unless KeepGoing is set, no build is started after the first failure.
+func (cs *LuetCompiler) schedule(keepPermissions bool, ps []CompilationSpec, failures int) ([]Artifact, []error) {
+	var allErrors []error
+
+	if cs.report.StartedOn.IsZero() {
+		cs.report.StartedOn = time.Now()
+	}
+	defer func() { cs.report.FinishedOn = time.Now() }()
+
+	nodes := map[string]*buildNode{}
+	order := []*buildNode{}
+	targets := []*buildTarget{}
+	for _, p := range ps {
+		t, err := cs.planTarget(p, nodes, &order)
+		if err != nil {
+			cs.report.add(p.GetPackage(), BuildStatusFailed, 0, nil, err)
+			allErrors = append(allErrors, err)
+			continue
+		}
+		if t.reused != nil {
+			cs.report.add(p.GetPackage(), BuildStatusReused, 0, t.reused, nil)
+		}
+		targets = append(targets, t)
+	}
+	for _, n := range order {
+		if n.parent != nil {
+			n.parent.children++
+		}
+	}
+
+	failed := int32(failures + len(allErrors))
+	concurrency := cs.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, n := range order {
+		wg.Add(1)
+		go func(n *buildNode) {
+			defer wg.Done()
+			defer close(n.done)
+
+			deps := n.deps
+			if n.parent != nil {
+				deps = append([]*buildNode{n.parent}, deps...)
+			}
+			for _, d := range deps {
+				<-d.done
+				if d.err != nil {
+					n.status = BuildStatusSkipped
+					n.err = errors.New("Skipped " + n.spec.GetPackage().HumanReadableString() + ", " +
+						d.spec.GetPackage().HumanReadableString() + " failed")
+					return
+				}
+			}
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if !cs.Options.KeepGoing && atomic.LoadInt32(&failed) > 0 {
+				n.status = BuildStatusSkipped
+				n.err = errors.New("Skipped " + n.spec.GetPackage().HumanReadableString() + ", build aborted after a failure")
+				return
+			}
+
+			started := time.Now()
+			n.result, n.err = cs.buildNode(n, keepPermissions)
+			n.duration = time.Since(started)
+			if n.err != nil {
+				n.status = BuildStatusFailed
+				atomic.AddInt32(&failed, 1)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	for _, n := range order {
+		cs.report.add(n.spec.GetPackage(), n.status, n.duration, n.result, n.err)
+		if n.status == BuildStatusFailed {
+			allErrors = append(allErrors, n.err)
+		}
+	}
+
+	artifacts := []Artifact{}
+	for _, t := range targets {
+		if t.reused != nil {
+			artifacts = append(artifacts, t.reused)
+			continue
+		}
+
+		departifacts := []Artifact{}
+		for _, d := range t.deps {
+			if d.result != nil {
+				departifacts = append(departifacts, d.result)
+			}
+		}
+
+		if t.node == nil {
+			if len(departifacts) > 0 {
+				artifacts = append(artifacts, departifacts[len(departifacts)-1])
+			}
+			continue
+		}
+		if t.node.err != nil {
+			continue
+		}
+		t.node.result.SetDependencies(departifacts)
+		t.node.result.SetSourceAssertion(t.spec.GetSourceAssertion())
+		artifacts = append(artifacts, t.node.result)
+	}
+
+	return artifacts, allErrors
+}
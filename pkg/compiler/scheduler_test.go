@@ -0,0 +1,221 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	helpers "github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+	"github.com/mudler/luet/pkg/tree"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingBackend records the images it is asked to build, and fails them
+type recordingBackend struct {
+	*sd.SimpleDocker
+	sync.Mutex
+	built []string
+}
+
+func (b *recordingBackend) BuildImage(opts CompilerBackendOptions) error {
+	b.Lock()
+	defer b.Unlock()
+	b.built = append(b.built, opts.DockerFileName)
+	return errors.New("build disabled")
+}
+
+func (b *recordingBackend) ImageExists(string) bool { return true }
+
+// recordingCache serves an artifact only for the given packages
+type recordingCache struct {
+	sync.Mutex
+	cached    map[string]bool
+	requested []string
+}
+
+func (c *recordingCache) GetArtifact(p CompilationSpec, sourceHash string) (Artifact, error) {
+	c.Lock()
+	defer c.Unlock()
+	fp := p.GetPackage().GetFingerPrint()
+	c.requested = append(c.requested, fp)
+	if !c.cached[fp] {
+		return nil, nil
+	}
+	a := NewPackageArtifact(p.Rel(p.GetPackage().GetFingerPrint() + ".package.tar"))
+	a.SetCompileSpec(p)
+	return a, nil
+}
+
+var _ = Describe("Scheduler", func() {
+	var tmpdir string
+	var backend *recordingBackend
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(helpers.CopyDir("../../tests/fixtures/buildableseed", filepath.Join(tmpdir, "tree"))).ToNot(HaveOccurred())
+		backend = &recordingBackend{SimpleDocker: &sd.SimpleDocker{}}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	compile := func(cache ArtifactCache, opts *CompilerOptions, names ...string) (Compiler, []Artifact, []error) {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).ToNot(HaveOccurred())
+
+		compiler := NewLuetCompiler(backend, generalRecipe.GetDatabase(), opts, solver.Options{Type: solver.SingleCoreSimple})
+		compiler.SetConcurrency(4)
+		compiler.SetArtifactCache(cache)
+
+		specs := NewLuetCompilationspecs()
+		for _, name := range names {
+			spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: name, Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			spec.SetOutputPath(tmpdir)
+			specs.Add(spec)
+		}
+
+		artifacts, errs := compiler.CompileParallel(false, specs)
+		return compiler, artifacts, errs
+	}
+
+	It("Builds the dependencies shared by the targets once", func() {
+		cache := &recordingCache{cached: map[string]bool{"b-test-1.0": true}}
+		_, artifacts, errs := compile(cache, NewDefaultCompilerOptions(), "d", "c")
+		Expect(len(errs)).To(Equal(1))
+		Expect(errs[0].Error()).To(ContainSubstring("build disabled"))
+		Expect(len(artifacts)).To(Equal(0))
+
+		// The failure points to the build log of the package
+		logFile := filepath.Join(tmpdir, "logs", "test-c-1.0.log")
+		Expect(errs[0].Error()).To(ContainSubstring(logFile))
+		Expect(helpers.Exists(logFile)).To(BeTrue())
+
+		// c is built once for both targets, and d waits for it
+		Expect(backend.built).To(Equal([]string{"c-test-1.0-builder.dockerfile"}))
+		Expect(cache.requested).To(ConsistOf("d-test-1.0", "c-test-1.0", "b-test-1.0", "c-test-1.0"))
+	})
+
+	It("Writes the build logs of variants apart", func() {
+		opts := NewDefaultCompilerOptions()
+		opts.Variant = "gcc"
+		_, _, errs := compile(nil, opts, "b")
+		Expect(len(errs)).To(Equal(1))
+
+		logFile := filepath.Join(tmpdir, "logs", "test-b-1.0-gcc.log")
+		Expect(errs[0].Error()).To(ContainSubstring(logFile))
+		Expect(helpers.Exists(logFile)).To(BeTrue())
+	})
+
+	It("Reports the outcome of each package", func() {
+		opts := NewDefaultCompilerOptions()
+		opts.KeepGoing = true
+		cache := &recordingCache{cached: map[string]bool{"a-test-1.0": true, "b-test-1.0": true}}
+		compiler, artifacts, errs := compile(cache, opts, "d", "c", "a")
+		Expect(len(errs)).To(Equal(1))
+		Expect(len(artifacts)).To(Equal(1))
+
+		report := compiler.GetBuildReport()
+		statuses := map[string]BuildStatus{}
+		for _, p := range report.Packages {
+			statuses[p.Package] = p.Status
+		}
+		Expect(statuses).To(Equal(map[string]BuildStatus{
+			"test/a-1.0": BuildStatusReused,
+			"test/b-1.0": BuildStatusReused,
+			"test/c-1.0": BuildStatusFailed,
+			"test/d-1.0": BuildStatusSkipped,
+		}))
+
+		Expect(report.WriteJSON(filepath.Join(tmpdir, "report.json"))).ToNot(HaveOccurred())
+		data, err := ioutil.ReadFile(filepath.Join(tmpdir, "report.json"))
+		Expect(err).ToNot(HaveOccurred())
+		loaded := &BuildReport{}
+		Expect(json.Unmarshal(data, loaded)).ToNot(HaveOccurred())
+		Expect(loaded.Count(BuildStatusFailed)).To(Equal(1))
+
+		Expect(report.WriteJUnit(filepath.Join(tmpdir, "report.xml"))).ToNot(HaveOccurred())
+		data, err = ioutil.ReadFile(filepath.Join(tmpdir, "report.xml"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`<testsuite name="luet build" tests="4" failures="1" skipped="1"`))
+		Expect(string(data)).To(ContainSubstring("build disabled"))
+	})
+
+	It("Skips the targets whose dependencies failed behind a seed image", func() {
+		buildFile := filepath.Join(tmpdir, "tree", "c", "build.yaml")
+		dat, err := ioutil.ReadFile(buildFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(buildFile, append([]byte("image: \"alpine\"\n"), dat...), 0644)).ToNot(HaveOccurred())
+
+		opts := NewDefaultCompilerOptions()
+		opts.KeepGoing = true
+		cache := &recordingCache{cached: map[string]bool{"c-test-1.0": true}}
+		compiler, artifacts, errs := compile(cache, opts, "d")
+		Expect(len(errs)).To(Equal(1))
+		Expect(len(artifacts)).To(Equal(0))
+
+		// c is built from its own image, d is still skipped as b failed
+		Expect(backend.built).To(Equal([]string{"b-test-1.0-builder.dockerfile"}))
+		statuses := map[string]BuildStatus{}
+		for _, p := range compiler.GetBuildReport().Packages {
+			statuses[p.Package] = p.Status
+		}
+		Expect(statuses).To(Equal(map[string]BuildStatus{
+			"test/b-1.0": BuildStatusFailed,
+			"test/c-1.0": BuildStatusReused,
+			"test/d-1.0": BuildStatusSkipped,
+		}))
+	})
+
+	It("Builds subpackages with the package they are split from", func() {
+		Expect(os.RemoveAll(filepath.Join(tmpdir, "tree"))).ToNot(HaveOccurred())
+		Expect(helpers.CopyDir("../../tests/fixtures/subpackages", filepath.Join(tmpdir, "tree"))).ToNot(HaveOccurred())
+
+		opts := NewDefaultCompilerOptions()
+		opts.KeepGoing = true
+		compiler, artifacts, errs := compile(nil, opts, "bar", "foo-doc")
+		Expect(len(errs)).To(Equal(1))
+		Expect(len(artifacts)).To(Equal(0))
+
+		// foo is built once, for both the targets
+		Expect(backend.built).To(Equal([]string{"foo-test-1.0.dockerfile"}))
+
+		statuses := map[string]BuildStatus{}
+		for _, p := range compiler.GetBuildReport().Packages {
+			statuses[p.Package] = p.Status
+		}
+		Expect(statuses).To(Equal(map[string]BuildStatus{
+			"test/foo-1.0":     BuildStatusFailed,
+			"test/foo-dev-1.0": BuildStatusSkipped,
+			"test/foo-doc-1.0": BuildStatusSkipped,
+			"test/bar-1.0":     BuildStatusSkipped,
+		}))
+	})
+})
@@ -0,0 +1,237 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/pkg/errors"
+)
+
+// Source is a file needed by the build, verified against its checksums
+// before being placed in the build context
+type Source struct {
+	// URL is either a http(s) URL or a path relative to the package definition
+	URL    string `json:"url" yaml:"url"`
+	SHA256 string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	SHA512 string `json:"sha512,omitempty" yaml:"sha512,omitempty"`
+	// Extract unpacks the source, which must be a (compressed) tarball
+	Extract bool `json:"extract,omitempty" yaml:"extract,omitempty"`
+	// Rename is the name of the file in the build context, or the folder the
+	// source is extracted to. It defaults to the file name of the URL.
+	Rename string `json:"rename,omitempty" yaml:"rename,omitempty"`
+}
+
+func (s Source) remote() bool {
+	return strings.HasPrefix(s.URL, "http://") || strings.HasPrefix(s.URL, "https://")
+}
+
+// Name returns the name of the source in the build context
+func (s Source) Name() string {
+	if s.Rename != "" {
+		return s.Rename
+	}
+	if u, err := url.Parse(s.URL); err == nil && s.remote() {
+		return path.Base(u.Path)
+	}
+	return filepath.Base(s.URL)
+}
+
+// key returns the algorithm and the checksum the source is stored with
+func (s Source) key() (string, string, error) {
+	switch {
+	case s.SHA256 != "":
+		return "sha256", strings.ToLower(s.SHA256), nil
+	case s.SHA512 != "":
+		return "sha512", strings.ToLower(s.SHA512), nil
+	}
+	return "", "", errors.New("Source " + s.URL + " has no sha256 or sha512 checksum")
+}
+
+// Verify checks the file against the checksums of the source
+func (s Source) Verify(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h256, h512 := sha256.New(), sha512.New()
+	if _, err := io.Copy(io.MultiWriter(h256, h512), f); err != nil {
+		return errors.Wrap(err, "While hashing "+file)
+	}
+	for _, c := range []struct {
+		algo, expected string
+		h              hash.Hash
+	}{{"sha256", s.SHA256, h256}, {"sha512", s.SHA512, h512}} {
+		if c.expected == "" {
+			continue
+		}
+		if got := hex.EncodeToString(c.h.Sum(nil)); got != strings.ToLower(c.expected) {
+			return fmt.Errorf("%s mismatch for %s: expected %s, got %s", c.algo, s.URL, c.expected, got)
+		}
+	}
+	return nil
+}
+
+// SourceCache is a content addressed store of sources, keyed by checksum
+type SourceCache struct {
+	Path string
+	// Offline disables downloads, only the sources in the cache can be used
+	Offline bool
+}
+
+func NewSourceCache(path string, offline bool) *SourceCache {
+	return &SourceCache{Path: path, Offline: offline}
+}
+
+// Fetch returns the path in the cache of the verified source. Sources missing
+// from the cache are downloaded, or copied from the definition dir.
+func (c *SourceCache) Fetch(s Source, definitionDir string) (string, error) {
+	algo, sum, err := s.key()
+	if err != nil {
+		return "", err
+	}
+	cached := filepath.Join(c.Path, algo, sum)
+
+	if helpers.Exists(cached) {
+		if err := s.Verify(cached); err == nil {
+			return cached, nil
+		}
+		Warning("Cached source", cached, "is corrupted, fetching it again")
+	}
+
+	if s.remote() && c.Offline {
+		return "", errors.New("Source " + s.URL + " is not in the cache, and downloads are disabled (offline)")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cached), os.ModePerm); err != nil {
+		return "", errors.Wrap(err, "While creating sources cache")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cached), sum+".")
+	if err != nil {
+		return "", errors.Wrap(err, "While creating sources cache")
+	}
+	defer os.Remove(tmp.Name())
+
+	if s.remote() {
+		Info(":arrow_down: Downloading", s.URL)
+		err = download(s.URL, tmp)
+	} else {
+		err = copyFile(filepath.Join(definitionDir, s.URL), tmp)
+	}
+	tmp.Close()
+	if err != nil {
+		return "", errors.Wrap(err, "Failed fetching source "+s.URL)
+	}
+
+	if err := s.Verify(tmp.Name()); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return "", errors.Wrap(err, "While storing source "+s.URL)
+	}
+	return cached, nil
+}
+
+// Place copies the verified source into dir, extracting it if requested
+func (c *SourceCache) Place(s Source, definitionDir, dir string) error {
+	cached, err := c.Fetch(s, definitionDir)
+	if err != nil {
+		return err
+	}
+
+	if !s.Extract {
+		return helpers.CopyFile(cached, filepath.Join(dir, s.Name()))
+	}
+
+	dest := dir
+	if s.Rename != "" {
+		dest = filepath.Join(dir, s.Rename)
+		if err := os.MkdirAll(dest, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	in, err := os.Open(cached)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Compression is detected from the content
+	if err := archive.Untar(in, dest, &archive.TarOptions{NoLchown: true}); err != nil {
+		return errors.Wrap(err, "Failed extracting source "+s.URL)
+	}
+	return nil
+}
+
+// placeSources fetches the sources of the spec into the build context
+func (cs *LuetCompiler) placeSources(p CompilationSpec, buildDir string) error {
+	if len(p.GetSources()) == 0 {
+		return nil
+	}
+
+	cachePath := cs.Options.SourceCachePath
+	if cachePath == "" {
+		cachePath = config.LuetCfg.GetSystem().GetSystemSourcesCacheDirPath()
+	}
+	cache := NewSourceCache(cachePath, cs.Options.Offline)
+	for _, s := range p.GetSources() {
+		if err := cache.Place(s, p.GetPackage().GetPath(), buildDir); err != nil {
+			return errors.Wrap(err, "Failed placing sources of "+p.GetPackage().HumanReadableString())
+		}
+	}
+	return nil
+}
+
+func download(u string, w io.Writer) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func copyFile(src string, w io.Writer) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/compiler"
+	helpers "github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sources", func() {
+	var tmpdir, tarball, sum string
+	var server *httptest.Server
+	var requests int
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "sources")
+		Expect(err).ToNot(HaveOccurred())
+
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		content := []byte("hello")
+		Expect(tw.WriteHeader(&tar.Header{Name: "src/hello", Mode: 0644, Size: int64(len(content))})).ToNot(HaveOccurred())
+		_, err = tw.Write(content)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tw.Close()).ToNot(HaveOccurred())
+		Expect(gz.Close()).ToNot(HaveOccurred())
+		tarball = buf.String()
+		h := sha256.Sum256(buf.Bytes())
+		sum = hex.EncodeToString(h[:])
+
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(tarball))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(tmpdir)
+	})
+
+	It("Are parsed from the build spec", func() {
+		spec, err := NewLuetCompilationSpec([]byte(`
+sources:
+- url: https://example.com/foo-1.0.tar.gz
+  sha256: abcd
+  extract: true
+  rename: foo
+`), &pkg.DefaultPackage{Name: "foo", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.GetSources()).To(Equal([]Source{
+			{URL: "https://example.com/foo-1.0.tar.gz", SHA256: "abcd", Extract: true, Rename: "foo"},
+		}))
+		Expect(spec.GetSources()[0].Name()).To(Equal("foo"))
+	})
+
+	It("Are downloaded once, verified and cached", func() {
+		cache := NewSourceCache(filepath.Join(tmpdir, "cache"), false)
+		source := Source{URL: server.URL + "/foo-1.0.tar.gz", SHA256: sum}
+
+		path, err := cache.Fetch(source, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(path).To(Equal(filepath.Join(tmpdir, "cache", "sha256", sum)))
+		Expect(requests).To(Equal(1))
+
+		// Offline builds can use the cached sources
+		cache = NewSourceCache(filepath.Join(tmpdir, "cache"), true)
+		Expect(cache.Place(source, "", tmpdir)).ToNot(HaveOccurred())
+		Expect(requests).To(Equal(1))
+		Expect(helpers.Exists(filepath.Join(tmpdir, "foo-1.0.tar.gz"))).To(BeTrue())
+	})
+
+	It("Are not downloaded offline", func() {
+		cache := NewSourceCache(filepath.Join(tmpdir, "cache"), true)
+		_, err := cache.Fetch(Source{URL: server.URL + "/foo-1.0.tar.gz", SHA256: sum}, "")
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(0))
+	})
+
+	It("Are rejected when the checksum doesn't match", func() {
+		cache := NewSourceCache(filepath.Join(tmpdir, "cache"), false)
+		_, err := cache.Fetch(Source{URL: server.URL + "/foo-1.0.tar.gz", SHA256: "0000"}, "")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("sha256 mismatch"))
+		Expect(helpers.Exists(filepath.Join(tmpdir, "cache", "sha256", "0000"))).To(BeFalse())
+
+		_, err = cache.Fetch(Source{URL: server.URL + "/foo-1.0.tar.gz"}, "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Are extracted from local paths", func() {
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "foo.tar.gz"), []byte(tarball), 0644)).ToNot(HaveOccurred())
+		build := filepath.Join(tmpdir, "build")
+		Expect(os.MkdirAll(build, os.ModePerm)).ToNot(HaveOccurred())
+
+		cache := NewSourceCache(filepath.Join(tmpdir, "cache"), true)
+		source := Source{URL: "foo.tar.gz", SHA256: sum, Extract: true, Rename: "foo"}
+		Expect(cache.Place(source, tmpdir, build)).ToNot(HaveOccurred())
+
+		content, err := helpers.Read(filepath.Join(build, "foo", "src", "hello"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal("hello"))
+	})
+})
@@ -91,6 +91,7 @@ type LuetCompilationSpec struct {
 	Steps           []string                  `json:"steps"` // Are run inside a container and the result layer diff is saved
 	Env             []string                  `json:"env"`
 	Prelude         []string                  `json:"prelude"` // Are run inside the image which will be our builder
+	Test            []string                  `json:"test"`    // Are run inside a container from the package image, and the result layer is discarded
 	Image           string                    `json:"image"`
 	Seed            string                    `json:"seed"`
 	Package         *pkg.DefaultPackage       `json:"package"`
@@ -98,11 +99,30 @@ type LuetCompilationSpec struct {
 	PackageDir      string                    `json:"package_dir" yaml:"package_dir"`
 
 	Retrieve []string `json:"retrieve"`
+	// Sources are fetched into the build context, and verified by checksum
+	Sources []Source `json:"sources"`
 
 	OutputPath string   `json:"-"` // Where the build processfiles go
 	Unpack     bool     `json:"unpack"`
 	Includes   []string `json:"includes"`
 	Excludes   []string `json:"excludes"`
+
+	// SourceDateEpoch overrides $SOURCE_DATE_EPOCH for reproducible builds
+	SourceDateEpoch int64 `json:"source_date_epoch" yaml:"source_date_epoch"`
+
+	// Subpackages are split from the files of the package build
+	Subpackages []Subpackage `json:"subpackages"`
+}
+
+// Subpackage is a package whose artifact is generated from the same build
+// of another one, with its own includes and excludes. Category and version
+// default to the ones of the package built.
+type Subpackage struct {
+	Name     string   `json:"name"`
+	Category string   `json:"category"`
+	Version  string   `json:"version"`
+	Includes []string `json:"includes"`
+	Excludes []string `json:"excludes"`
 }
 
 func NewLuetCompilationSpec(b []byte, p pkg.Package) (CompilationSpec, error) {
@@ -125,6 +145,10 @@ func (cs *LuetCompilationSpec) GetPackage() pkg.Package {
 	return cs.Package
 }
 
+func (cs *LuetCompilationSpec) GetSourceDateEpoch() int64 {
+	return cs.SourceDateEpoch
+}
+
 func (cs *LuetCompilationSpec) GetPackageDir() string {
 	return cs.PackageDir
 }
@@ -137,6 +161,10 @@ func (cs *LuetCompilationSpec) BuildSteps() []string {
 	return cs.Steps
 }
 
+func (cs *LuetCompilationSpec) GetTestSteps() []string {
+	return cs.Test
+}
+
 func (cs *LuetCompilationSpec) ImageUnpack() bool {
 	return cs.Unpack
 }
@@ -185,6 +213,14 @@ func (cs *LuetCompilationSpec) SetSeedImage(s string) {
 	cs.Seed = s
 }
 
+func (cs *LuetCompilationSpec) GetSources() []Source {
+	return cs.Sources
+}
+
+func (cs *LuetCompilationSpec) GetSubpackages() []Subpackage {
+	return cs.Subpackages
+}
+
 func (cs *LuetCompilationSpec) CopyRetrieves(dest string) error {
 	var err error
 	if len(cs.Retrieve) > 0 {
@@ -248,6 +284,11 @@ func (cs *LuetCompilationSpec) RenderStepImage(image string) (string, error) {
 	return cs.genDockerfile(image, cs.BuildSteps()), nil
 }
 
+// RenderTestImage renders the dockerfile running the tests on top of the package image
+func (cs *LuetCompilationSpec) RenderTestImage(image string) (string, error) {
+	return cs.genDockerfile(image, cs.GetTestSteps()), nil
+}
+
 func (cs *LuetCompilationSpec) WriteBuildImageDefinition(path string) error {
 	data, err := cs.RenderBuildImage()
 	if err != nil {
@@ -263,3 +304,11 @@ func (cs *LuetCompilationSpec) WriteStepImageDefinition(fromimage, path string)
 	}
 	return ioutil.WriteFile(path, []byte(data), 0644)
 }
+
+func (cs *LuetCompilationSpec) WriteTestImageDefinition(fromimage, path string) error {
+	data, err := cs.RenderTestImage(fromimage)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(data), 0644)
+}
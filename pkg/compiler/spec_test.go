@@ -109,6 +109,53 @@ RUN echo bar > /test2`))
 
 	})
 
+	It("Renders test steps", func() {
+		generalRecipe := tree.NewGeneralRecipe(pkg.NewInMemoryDatabase(false))
+
+		err := generalRecipe.Load("../../tests/fixtures/buildtest")
+		Expect(err).ToNot(HaveOccurred())
+
+		compiler := NewLuetCompiler(nil, generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+		spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "pass", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.GetTestSteps()).To(Equal([]string{"test -f /artifact", "echo tested > /tested"}))
+
+		tmpdir, err := ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(tmpdir) // clean up
+
+		err = spec.WriteTestImageDefinition("luet/cache:package", filepath.Join(tmpdir, "Dockerfile"))
+		Expect(err).ToNot(HaveOccurred())
+		dockerfile, err := helpers.Read(filepath.Join(tmpdir, "Dockerfile"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dockerfile).To(Equal(`
+FROM luet/cache:package
+COPY . /luetbuild
+WORKDIR /luetbuild
+ENV PACKAGE_NAME=pass
+ENV PACKAGE_VERSION=1.0
+ENV PACKAGE_CATEGORY=test
+RUN test -f /artifact
+RUN echo tested > /tested`))
+	})
+
+	It("Renders subpackages", func() {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+
+		err := generalRecipe.Load("../../tests/fixtures/subpackages")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(generalRecipe.GetDatabase().GetPackages())).To(Equal(4))
+
+		compiler := NewLuetCompiler(nil, generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+		spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "foo", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.GetExcludes()).To(Equal([]string{"usr/include", "usr/share/doc"}))
+		Expect(spec.GetSubpackages()).To(Equal([]Subpackage{
+			{Name: "foo-dev", Includes: []string{"usr/include"}},
+			{Name: "foo-doc", Includes: []string{"usr/share/doc"}},
+		}))
+	})
+
 	It("Renders retrieve and env fields", func() {
 		generalRecipe := tree.NewGeneralRecipe(pkg.NewInMemoryDatabase(false))
 
@@ -0,0 +1,137 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+
+	"github.com/pkg/errors"
+)
+
+// subpackageSpecs returns the specs of the subpackages split from the build
+// of the spec. They share the build of the spec, with their own includes and
+// excludes.
+func (cs *LuetCompiler) subpackageSpecs(p CompilationSpec) ([]CompilationSpec, error) {
+	parent, ok := p.(*LuetCompilationSpec)
+	if !ok || len(parent.Subpackages) == 0 {
+		return nil, nil
+	}
+
+	specs := []CompilationSpec{}
+	for _, sub := range parent.Subpackages {
+		query := &pkg.DefaultPackage{
+			Name:     sub.Name,
+			Category: sub.Category,
+			Version:  sub.Version,
+		}
+		if query.Category == "" {
+			query.Category = p.GetPackage().GetCategory()
+		}
+		if query.Version == "" {
+			query.Version = p.GetPackage().GetVersion()
+		}
+		pack, err := cs.Database.FindPackage(query)
+		if err != nil {
+			return nil, errors.Wrap(err, "Subpackage "+query.HumanReadableString()+" of "+p.GetPackage().HumanReadableString()+" not found")
+		}
+
+		spec := *parent
+		spec.Package = pack.(*pkg.DefaultPackage)
+		spec.Includes = sub.Includes
+		spec.Excludes = sub.Excludes
+		spec.Subpackages = nil
+		if arch := cs.Options.Arch(); arch != "" {
+			spec.GetPackage().SetArch(arch)
+		}
+		if cs.Options.Variant != "" {
+			spec.GetPackage().SetVariant(cs.Options.Variant)
+		}
+		specs = append(specs, &spec)
+	}
+	return specs, nil
+}
+
+// subpackageOf returns the fingerprint of the package the one of the spec is
+// split from, if it is a subpackage
+func subpackageOf(p CompilationSpec) string {
+	return p.GetPackage().GetAnnotations()[string(pkg.SubpackageAnnotation)]
+}
+
+// planSubpackage plans the build of the package the spec is split from, and
+// adds to the graph the node providing the subpackage artifact from it.
+func (cs *LuetCompiler) planSubpackage(p CompilationSpec, nodes map[string]*buildNode, order *[]*buildNode) (*buildTarget, error) {
+	parentAssertion := p.GetSourceAssertion().Search(subpackageOf(p))
+	if parentAssertion == nil {
+		return nil, errors.New("Package " + subpackageOf(p) + " not found in the dependencies of " + p.GetPackage().HumanReadableString())
+	}
+
+	spec, err := cs.FromPackage(parentAssertion.Package)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while generating compilespec for "+parentAssertion.Package.HumanReadableString())
+	}
+	spec.SetOutputPath(p.GetOutputPath())
+	assertions, err := cs.ComputeDepTree(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed computing the dependency tree of "+parentAssertion.Package.HumanReadableString())
+	}
+	spec.SetSourceAssertion(assertions)
+
+	parent, err := cs.planTarget(spec, nodes, order)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &buildTarget{spec: p, deps: parent.deps}
+	if parent.reused != nil {
+		artifact, err := LoadArtifactFromYaml(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed loading the artifact of "+p.GetPackage().HumanReadableString())
+		}
+		artifact.SetSourceAssertion(p.GetSourceAssertion())
+		t.reused = artifact
+		return t, nil
+	}
+	if parent.node == nil {
+		return t, nil
+	}
+
+	t.deps = append(t.deps, parent.node)
+	t.node = cs.subpackageNode(p, *p.GetSourceAssertion().Search(p.GetPackage().GetFingerPrint()), parent.node, nodes, order)
+	t.node.artifact = true
+	return t, nil
+}
+
+// subpackageNode returns the node of the subpackage split from the build of
+// the parent node. Its package image is the one of the parent.
+func (cs *LuetCompiler) subpackageNode(p CompilationSpec, assertion solver.PackageAssert, parent *buildNode, nodes map[string]*buildNode, order *[]*buildNode) *buildNode {
+	image := cs.imageName(assertion.Hash.PackageHash)
+	n, ok := nodes[image]
+	if !ok {
+		n = &buildNode{
+			spec:      p,
+			assertion: assertion,
+			image:     image,
+			seed:      parent.image,
+			parent:    parent,
+			split:     true,
+			done:      make(chan struct{}),
+		}
+		nodes[image] = n
+		*order = append(*order, n)
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+	"github.com/mudler/luet/pkg/tree"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Use flags", func() {
+	compile := func(uses *pkg.UseFlags) (CompilationSpec, map[string]string) {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/useflags")).ToNot(HaveOccurred())
+		Expect(uses.ApplyDatabase(generalRecipe.GetDatabase())).ToNot(HaveOccurred())
+
+		compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), NewDefaultCompilerOptions(), solver.Options{Type: solver.SingleCoreSimple})
+		spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "curl", Category: "net", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		assertions, err := compiler.ComputeDepTree(spec)
+		Expect(err).ToNot(HaveOccurred())
+		spec.SetSourceAssertion(assertions)
+
+		hashes, err := compiler.(*LuetCompiler).SourceHashes(spec)
+		Expect(err).ToNot(HaveOccurred())
+		return spec, hashes
+	}
+
+	It("Builds with the flags enabled by default", func() {
+		spec, hashes := compile(&pkg.UseFlags{})
+		Expect(spec.GetPackage().GetUses()).To(Equal([]string{"http2"}))
+		Expect(spec.BuildSteps()).To(Equal([]string{"echo nossl > /curl"}))
+		Expect(len(hashes)).To(Equal(1))
+	})
+
+	It("Builds with the flags selected", func() {
+		_, before := compile(&pkg.UseFlags{})
+
+		spec, hashes := compile(&pkg.UseFlags{Global: []string{"ssl", "-http2"}})
+		Expect(spec.GetPackage().GetUses()).To(Equal([]string{"ssl"}))
+		Expect(spec.BuildSteps()).To(Equal([]string{"echo ssl > /curl"}))
+		Expect(len(hashes)).To(Equal(2))
+		Expect(hashes["curl-net-1.0"]).ToNot(Equal(before["curl-net-1.0"]))
+	})
+
+	It("Keeps the flags of the package over the ones of the values file", func() {
+		tmpdir, err := ioutil.TempDir("", "values")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(tmpdir)
+		values := filepath.Join(tmpdir, "values.yaml")
+		Expect(ioutil.WriteFile(values, []byte("use:\n  ssl: false\n  static: true\n"), 0644)).ToNot(HaveOccurred())
+
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/useflags")).ToNot(HaveOccurred())
+		Expect((&pkg.UseFlags{Global: []string{"ssl"}}).ApplyDatabase(generalRecipe.GetDatabase())).ToNot(HaveOccurred())
+
+		opts := NewDefaultCompilerOptions()
+		opts.BuildValuesFile = values
+		compiler := NewLuetCompiler(sd.NewSimpleDockerBackend(), generalRecipe.GetDatabase(), opts, solver.Options{Type: solver.SingleCoreSimple})
+		spec, err := compiler.FromPackage(&pkg.DefaultPackage{Name: "curl", Category: "net", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.BuildSteps()).To(Equal([]string{"echo ssl > /curl"}))
+	})
+})
@@ -99,12 +99,39 @@ func (opts *LuetSolverOptions) CompactString() string {
 		opts.Type, opts.LearnRate, opts.Discount, opts.MaxAttempts, 999999)
 }
 
+// LuetLicensePolicy lists the licenses packages can be distributed or
+// installed with
+type LuetLicensePolicy struct {
+	// Allowed and denied license identifiers, globs like GPL-* are supported.
+	// If no license is allowed explicitly, all the ones not denied are.
+	Allowed []string `yaml:"allowed,omitempty" mapstructure:"allowed"`
+	Denied  []string `yaml:"denied,omitempty" mapstructure:"denied"`
+	// RequireLicense reports packages not declaring a license
+	RequireLicense bool `yaml:"require_license,omitempty" mapstructure:"require_license"`
+	// Mode is either warn, to report the violations, or fail
+	Mode string `yaml:"mode,omitempty" mapstructure:"mode"`
+}
+
 type LuetSystemConfig struct {
 	DatabaseEngine string `yaml:"database_engine" mapstructure:"database_engine"`
 	DatabasePath   string `yaml:"database_path" mapstructure:"database_path"`
 	Rootfs         string `yaml:"rootfs" mapstructure:"rootfs"`
 	PkgsCachePath  string `yaml:"pkgs_cache_path" mapstructure:"pkgs_cache_path"`
 	TmpDirBase     string `yaml:"tmpdir_base" mapstructure:"tmpdir_base"`
+	Arch           string `yaml:"arch,omitempty" mapstructure:"arch"`
+	Variant        string `yaml:"variant,omitempty" mapstructure:"variant"`
+
+	// SourcesCachePath is where the sources fetched by the builds are cached
+	SourcesCachePath string `yaml:"sources_cache_path" mapstructure:"sources_cache_path"`
+}
+
+// GetArch returns the architecture packages are installed for, defaulting
+// to the host one.
+func (sc *LuetSystemConfig) GetArch() string {
+	if sc.Arch == "" {
+		return runtime.GOARCH
+	}
+	return sc.Arch
 }
 
 func (sc *LuetSystemConfig) GetRepoDatabaseDirPath(name string) string {
@@ -145,22 +172,32 @@ func (sc *LuetSystemConfig) GetSystemPkgsCacheDirPath() (ans string) {
 	return
 }
 
+// GetSystemSourcesCacheDirPath returns the path of the cache of the sources
+// fetched by the builds. Relative paths are relative to the database path.
+func (sc *LuetSystemConfig) GetSystemSourcesCacheDirPath() string {
+	if filepath.IsAbs(sc.SourcesCachePath) {
+		return sc.SourcesCachePath
+	}
+	return filepath.Join(sc.GetSystemRepoDatabaseDirPath(), sc.SourcesCachePath)
+}
+
 func (sc *LuetSystemConfig) GetRootFsAbs() (string, error) {
 	return filepath.Abs(sc.Rootfs)
 }
 
 type LuetRepository struct {
-	Name           string            `json:"name" yaml:"name" mapstructure:"name"`
-	Description    string            `json:"description,omitempty" yaml:"description,omitempty" mapstructure:"description"`
-	Urls           []string          `json:"urls" yaml:"urls" mapstructure:"urls"`
-	Type           string            `json:"type" yaml:"type" mapstructure:"type"`
-	Mode           string            `json:"mode,omitempty" yaml:"mode,omitempty" mapstructure:"mode,omitempty"`
-	Priority       int               `json:"priority,omitempty" yaml:"priority,omitempty" mapstructure:"priority"`
-	Enable         bool              `json:"enable" yaml:"enable" mapstructure:"enable"`
-	Cached         bool              `json:"cached,omitempty" yaml:"cached,omitempty" mapstructure:"cached,omitempty"`
-	Authentication map[string]string `json:"auth,omitempty" yaml:"auth,omitempty" mapstructure:"auth,omitempty"`
-	TreePath       string            `json:"tree_path,omitempty" yaml:"tree_path,omitempty" mapstructure:"tree_path"`
-	MetaPath       string            `json:"meta_path,omitempty" yaml:"meta_path,omitempty" mapstructure:"meta_path"`
+	Name           string             `json:"name" yaml:"name" mapstructure:"name"`
+	Description    string             `json:"description,omitempty" yaml:"description,omitempty" mapstructure:"description"`
+	Urls           []string           `json:"urls" yaml:"urls" mapstructure:"urls"`
+	Type           string             `json:"type" yaml:"type" mapstructure:"type"`
+	Mode           string             `json:"mode,omitempty" yaml:"mode,omitempty" mapstructure:"mode,omitempty"`
+	Priority       int                `json:"priority,omitempty" yaml:"priority,omitempty" mapstructure:"priority"`
+	Enable         bool               `json:"enable" yaml:"enable" mapstructure:"enable"`
+	Cached         bool               `json:"cached,omitempty" yaml:"cached,omitempty" mapstructure:"cached,omitempty"`
+	Authentication map[string]string  `json:"auth,omitempty" yaml:"auth,omitempty" mapstructure:"auth,omitempty"`
+	TreePath       string             `json:"tree_path,omitempty" yaml:"tree_path,omitempty" mapstructure:"tree_path"`
+	MetaPath       string             `json:"meta_path,omitempty" yaml:"meta_path,omitempty" mapstructure:"meta_path"`
+	Http           LuetRepositoryHttp `json:"http,omitempty" yaml:"http,omitempty" mapstructure:"http,omitempty"`
 
 	// Serialized options not used in repository configuration
 
@@ -170,6 +207,23 @@ type LuetRepository struct {
 	LastUpdate string `json:"last_update,omitempty" yaml:"-,omitempty" mapstructure:"-,omitempty"`
 }
 
+// LuetRepositoryHttp holds the transport settings of http repositories
+type LuetRepositoryHttp struct {
+	// CACert is a PEM bundle of the certificate authorities trusted, along
+	// with the system ones
+	CACert     string `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty" mapstructure:"ca_cert"`
+	ClientCert string `json:"client_cert,omitempty" yaml:"client_cert,omitempty" mapstructure:"client_cert"`
+	ClientKey  string `json:"client_key,omitempty" yaml:"client_key,omitempty" mapstructure:"client_key"`
+	Insecure   bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty" mapstructure:"insecure_skip_verify"`
+
+	// Proxy overrides the proxy from the environment (HTTP_PROXY, HTTPS_PROXY, NO_PROXY)
+	Proxy string `json:"proxy,omitempty" yaml:"proxy,omitempty" mapstructure:"proxy"`
+
+	// Timeouts in seconds, 0 means no timeout
+	ConnectTimeout int `json:"connect_timeout,omitempty" yaml:"connect_timeout,omitempty" mapstructure:"connect_timeout"`
+	Timeout        int `json:"timeout,omitempty" yaml:"timeout,omitempty" mapstructure:"timeout"`
+}
+
 func NewLuetRepository(name, t, descr string, urls []string, priority int, enable, cached bool) *LuetRepository {
 	return &LuetRepository{
 		Name:        name,
@@ -214,6 +268,9 @@ type LuetConfig struct {
 	General LuetGeneralConfig `mapstructure:"general"`
 	System  LuetSystemConfig  `mapstructure:"system"`
 	Solver  LuetSolverOptions `mapstructure:"solver"`
+	License LuetLicensePolicy `mapstructure:"license"`
+	// UseFlags are the use flags packages are built and installed with
+	UseFlags pkg.UseFlags `mapstructure:"use_flags"`
 
 	RepositoriesConfDir  []string         `mapstructure:"repos_confdir"`
 	ConfigProtectConfDir []string         `mapstructure:"config_protect_confdir"`
@@ -262,6 +319,9 @@ func GenDefault(viper *v.Viper) {
 	viper.SetDefault("system.rootfs", "/")
 	viper.SetDefault("system.tmpdir_base", filepath.Join(os.TempDir(), "tmpluet"))
 	viper.SetDefault("system.pkgs_cache_path", "packages")
+	viper.SetDefault("system.sources_cache_path", "sources")
+
+	viper.SetDefault("license.mode", "warn")
 
 	viper.SetDefault("repos_confdir", []string{"/etc/luet/repos.conf.d"})
 	viper.SetDefault("config_protect_confdir", []string{"/etc/luet/config.protect.d"})
@@ -303,6 +363,14 @@ func (c *LuetConfig) GetSystem() *LuetSystemConfig {
 	return &c.System
 }
 
+func (c *LuetConfig) GetLicensePolicy() *LuetLicensePolicy {
+	return &c.License
+}
+
+func (c *LuetConfig) GetUseFlags() *pkg.UseFlags {
+	return &c.UseFlags
+}
+
 func (c *LuetConfig) GetSolverOptions() *LuetSolverOptions {
 	return &c.Solver
 }
@@ -395,9 +463,10 @@ system:
   database_engine: %s
   database_path: %s
   pkgs_cache_path: %s
+  sources_cache_path: %s
   tmpdir_base: %s
   rootfs: %s`,
-		c.DatabaseEngine, c.DatabasePath, c.PkgsCachePath,
+		c.DatabaseEngine, c.DatabasePath, c.PkgsCachePath, c.SourcesCachePath,
 		c.TmpDirBase, c.Rootfs)
 
 	return ans
@@ -19,10 +19,14 @@ import (
 	"archive/tar"
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/system"
 )
 
 func Tar(src, dest string) error {
@@ -50,6 +54,95 @@ func Tar(src, dest string) error {
 	return err
 }
 
+// TarReproducible archives the content of src into dest, so that the same
+// content always generates the same archive: entries are sorted by name, keep
+// their numeric owner with no user and group names, and their mtimes are
+// clamped to epoch.
+func TarReproducible(src, dest string, epoch time.Time) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	tw := tar.NewWriter(out)
+	hardlinks := map[uint64]string{}
+
+	// Walk visits the entries in lexical order
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.ModTime = info.ModTime().Truncate(time.Second)
+		if hdr.ModTime.After(epoch) {
+			hdr.ModTime = epoch
+		}
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		hdr.Format = tar.FormatPAX
+
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && st.Nlink > 1 {
+			if first, ok := hardlinks[st.Ino]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				hardlinks[st.Ino] = hdr.Name
+			}
+		}
+
+		if capability, _ := system.Lgetxattr(path, "security.capability"); capability != nil {
+			hdr.PAXRecords = map[string]string{"SCHILY.xattr.security.capability": string(capability)}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
 type TarModifierWrapperFunc func(path, dst string, header *tar.Header, content io.Reader) (*tar.Header, []byte, error)
 type TarModifierWrapper struct {
 	DestinationPath string
@@ -70,18 +163,24 @@ func (m *TarModifierWrapper) GetModifier() archive.TarModifierFunc {
 }
 
 func UntarProtect(src, dst string, sameOwner bool, protectedFiles []string, modifier *TarModifierWrapper) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return UntarProtectReader(in, dst, sameOwner, protectedFiles, modifier)
+}
+
+// UntarProtectReader is UntarProtect reading the tar stream from in
+func UntarProtectReader(in io.Reader, dst string, sameOwner bool, protectedFiles []string, modifier *TarModifierWrapper) error {
 	var ans error
 
 	if len(protectedFiles) <= 0 {
-		return Untar(src, dst, sameOwner)
+		return UntarReader(in, dst, sameOwner)
 	}
 
 	// POST: we have files to protect. I create a ReplaceFileTarWrapper
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
 
 	// Create modifier map
 	mods := make(map[string]archive.TarModifierFunc)
@@ -92,7 +191,7 @@ func UntarProtect(src, dst string, sameOwner bool, protectedFiles []string, modi
 	if sameOwner {
 		// PRE: i have root privileged.
 
-		replacerArchive := archive.ReplaceFileTarWrapper(in, mods)
+		replacerArchive := archive.ReplaceFileTarWrapper(ioutil.NopCloser(in), mods)
 
 		opts := &archive.TarOptions{
 			// NOTE: NoLchown boolean is used for chmod of the symlink
@@ -110,7 +209,7 @@ func UntarProtect(src, dst string, sameOwner bool, protectedFiles []string, modi
 	return ans
 }
 
-func unTarIgnoreOwner(dest string, in io.ReadCloser, mods map[string]archive.TarModifierFunc) error {
+func unTarIgnoreOwner(dest string, in io.Reader, mods map[string]archive.TarModifierFunc) error {
 	tr := tar.NewReader(in)
 	for {
 		header, err := tr.Next()
@@ -192,14 +291,19 @@ tarEof:
 
 // Untar just a wrapper around the docker functions
 func Untar(src, dest string, sameOwner bool) error {
-	var ans error
-
 	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
+	return UntarReader(in, dest, sameOwner)
+}
+
+// UntarReader is Untar reading the tar stream from in
+func UntarReader(in io.Reader, dest string, sameOwner bool) error {
+	var ans error
+
 	if sameOwner {
 		// PRE: i have root privileged.
 
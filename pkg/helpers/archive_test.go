@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/docker/docker/pkg/archive"
 	. "github.com/mudler/luet/pkg/helpers"
@@ -131,4 +132,61 @@ var _ = Describe("Helpers Archive", func() {
 			Expect(Exists(filepath.Join(targetDir, "._cfg0001_file-0"))).Should(Equal(true))
 		})
 	})
+
+	Context("Reproducible tar", func() {
+		It("Generates the same archive from the same content", func() {
+			epoch := time.Unix(1600000000, 0)
+
+			var archives [][]byte
+			for i := 0; i < 2; i++ {
+				archiveSourceDir, err := ioutil.TempDir("", "archive-source")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(archiveSourceDir)
+
+				_, err = prepareUntarSourceDirectory(5, archiveSourceDir, true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.MkdirAll(filepath.Join(archiveSourceDir, "dir"), os.ModePerm)).ToNot(HaveOccurred())
+				Expect(os.Symlink("../file-0", filepath.Join(archiveSourceDir, "dir", "link"))).ToNot(HaveOccurred())
+
+				old := epoch.Add(-time.Hour)
+				Expect(os.Chtimes(filepath.Join(archiveSourceDir, "file-1"), old, old)).ToNot(HaveOccurred())
+				if os.Getuid() == 0 {
+					Expect(os.Lchown(filepath.Join(archiveSourceDir, "file-1"), 1000, 1000)).ToNot(HaveOccurred())
+				}
+
+				dst := filepath.Join(archiveSourceDir, "..", filepath.Base(archiveSourceDir)+".tar")
+				defer os.RemoveAll(dst)
+				Expect(TarReproducible(archiveSourceDir, dst, epoch)).ToNot(HaveOccurred())
+
+				data, err := ioutil.ReadFile(dst)
+				Expect(err).ToNot(HaveOccurred())
+				archives = append(archives, data)
+			}
+			Expect(archives[0]).To(Equal(archives[1]))
+
+			headers := map[string]*tar.Header{}
+			tr := tar.NewReader(bytes.NewReader(archives[0]))
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ToNot(HaveOccurred())
+				headers[hdr.Name] = hdr
+			}
+
+			Expect(headers).To(HaveKey("dir/"))
+			Expect(headers["dir/link"].Linkname).To(Equal("../file-0"))
+			Expect(headers["file-0"].Uid).To(Equal(os.Getuid()))
+			Expect(headers["file-0"].Uname).To(Equal(""))
+			if os.Getuid() == 0 {
+				Expect(headers["file-1"].Uid).To(Equal(1000))
+				Expect(headers["file-1"].Gid).To(Equal(1000))
+			}
+			Expect(headers["file-0"].ModTime.Unix()).To(Equal(epoch.Unix()))
+			Expect(headers["file-1"].ModTime.Unix()).To(Equal(epoch.Add(-time.Hour).Unix()))
+			Expect(headers["file-0-link"].Typeflag).To(Equal(byte(tar.TypeLink)))
+			Expect(headers["file-0-link"].Linkname).To(Equal("file-0"))
+		})
+	})
 })
@@ -0,0 +1,88 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package helpers
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimestampWriter writes to the underlying writer prefixing each line with
+// the time it was written at
+type TimestampWriter struct {
+	w    io.Writer
+	line []byte
+}
+
+func NewTimestampWriter(w io.Writer) *TimestampWriter {
+	return &TimestampWriter{w: w}
+}
+
+func (t *TimestampWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		t.line = append(t.line, b)
+		if b == '\n' {
+			if err := t.Flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the pending partial line, if any
+func (t *TimestampWriter) Flush() error {
+	if len(t.line) == 0 {
+		return nil
+	}
+	if t.line[len(t.line)-1] != '\n' {
+		t.line = append(t.line, '\n')
+	}
+	_, err := t.w.Write(append([]byte(time.Now().Format(time.RFC3339)+" "), t.line...))
+	t.line = t.line[:0]
+	return err
+}
+
+// RunLogged runs the command and returns its combined output. If logFile is
+// not empty, the output is appended to it as well, with timestamps.
+func RunLogged(cmd *exec.Cmd, logFile string) ([]byte, error) {
+	if logFile == "" {
+		return cmd.CombinedOutput()
+	}
+
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed opening log file "+logFile)
+	}
+	defer f.Close()
+
+	var out bytes.Buffer
+	log := NewTimestampWriter(f)
+	// The same writer is used for both, so writes are not concurrent
+	w := io.MultiWriter(&out, log)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Run()
+	if ferr := log.Flush(); ferr != nil && err == nil {
+		err = errors.Wrap(ferr, "Failed writing log file "+logFile)
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,63 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package helpers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/mudler/luet/pkg/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logs", func() {
+	Context("RunLogged", func() {
+		It("Appends the output to the log file with timestamps", func() {
+			tmpdir, err := ioutil.TempDir("", "logs")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+			logFile := filepath.Join(tmpdir, "build.log")
+			Expect(ioutil.WriteFile(logFile, []byte("header\n"), 0644)).ToNot(HaveOccurred())
+
+			out, err := RunLogged(exec.Command("sh", "-c", "echo foo; echo bar >&2; printf baz"), logFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(out)).To(Equal("foo\nbar\nbaz"))
+
+			data, err := ioutil.ReadFile(logFile)
+			Expect(err).ToNot(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			Expect(len(lines)).To(Equal(4))
+			Expect(lines[0]).To(Equal("header"))
+			for i, text := range []string{"foo", "bar", "baz"} {
+				fields := strings.SplitN(lines[i+1], " ", 2)
+				_, err := time.Parse(time.RFC3339, fields[0])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fields[1]).To(Equal(text))
+			}
+		})
+
+		It("Returns the output of failed commands", func() {
+			out, err := RunLogged(exec.Command("sh", "-c", "echo failed; exit 1"), "")
+			Expect(err).To(HaveOccurred())
+			Expect(string(out)).To(Equal("failed\n"))
+		})
+	})
+})
@@ -0,0 +1,238 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mudler/luet/pkg/compiler"
+	pkg "github.com/mudler/luet/pkg/package"
+	version "github.com/mudler/luet/pkg/versioner"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+const (
+	REPOSITORY_ADVISORIESFILE = "repository.advisories.yaml"
+	REPOFILE_ADVISORIES_KEY   = "advisories"
+
+	// AdvisoriesDir is the folder of a tree holding the advisories, one per file
+	AdvisoriesDir = "advisories"
+)
+
+// Advisory describes a known issue of a set of package versions
+type Advisory struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Affected are the package selectors of the vulnerable versions
+	Affected []*pkg.DefaultPackage `json:"affected"`
+	// Fixed are the first versions of the packages not affected anymore
+	Fixed []*pkg.DefaultPackage `json:"fixed,omitempty"`
+}
+
+type Advisories []*Advisory
+
+// AdvisoryMatch is an installed package affected by an advisory
+type AdvisoryMatch struct {
+	Advisory *Advisory
+	Package  pkg.Package
+
+	// Upgrade is the lowest version available in the repositories which
+	// fixes the advisory, if any.
+	Upgrade    pkg.Package
+	Repository string
+}
+
+func NewDefaultAdvisoriesRepositoryFile() LuetRepositoryFile {
+	return LuetRepositoryFile{
+		FileName:        REPOSITORY_ADVISORIESFILE + ".tar",
+		CompressionType: compiler.GZip,
+	}
+}
+
+// LoadAdvisoriesDir reads the advisories yaml files in the given directory
+func LoadAdvisoriesDir(dir string) (Advisories, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := Advisories{}
+	for _, f := range files {
+		if f.IsDir() || !(strings.HasSuffix(f.Name(), ".yaml") || strings.HasSuffix(f.Name(), ".yml")) {
+			continue
+		}
+		dat, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading file "+f.Name())
+		}
+		a := &Advisory{}
+		err = yaml.Unmarshal(dat, a)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading advisory "+f.Name())
+		}
+		if a.ID == "" {
+			return nil, errors.New("Advisory " + f.Name() + " has no id")
+		}
+		if len(a.Affected) == 0 {
+			return nil, errors.New("Advisory " + a.ID + " has no affected packages")
+		}
+		ans = append(ans, a)
+	}
+	return ans, ans.Validate()
+}
+
+func NewAdvisoriesFromFile(file string) (Advisories, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ans := Advisories{}
+	err = yaml.Unmarshal(dat, &ans)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading advisories "+file)
+	}
+	return ans, nil
+}
+
+func (a Advisories) WriteFile(file string) error {
+	data, err := yaml.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, os.ModePerm)
+}
+
+// Validate checks that advisory ids are unique
+func (a Advisories) Validate() error {
+	ids := map[string]bool{}
+	for _, adv := range a {
+		if ids[adv.ID] {
+			return errors.New("Duplicate advisory " + adv.ID)
+		}
+		ids[adv.ID] = true
+	}
+	return nil
+}
+
+// Affects returns true if the package version matches the affected selectors
+func (a *Advisory) Affects(p pkg.Package, v version.Versioner) bool {
+	return matchSelectors(a.Affected, p, v)
+}
+
+// matchSelectors returns true if the package matches any of the selectors,
+// or any of the exact versions given.
+func matchSelectors(selectors []*pkg.DefaultPackage, p pkg.Package, v version.Versioner) bool {
+	for _, s := range selectors {
+		if s.GetPackageName() != p.GetPackageName() {
+			continue
+		}
+		if !s.IsSelector() {
+			if s.GetVersion() == p.GetVersion() {
+				return true
+			}
+			continue
+		}
+		if match, _ := s.SelectorMatchVersion(p.GetVersion(), v); match {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedVersion returns the first version of the package fixing the advisory,
+// if stated.
+func (a *Advisory) fixedVersion(p pkg.Package) string {
+	for _, f := range a.Fixed {
+		if f.GetPackageName() == p.GetPackageName() {
+			return f.GetVersion()
+		}
+	}
+	return ""
+}
+
+// Audit returns the installed packages affected by the advisories, along with
+// the lowest version available in the repositories which fixes each of them.
+func (a Advisories) Audit(installed pkg.Packages, repos Repositories, v version.Versioner) []AdvisoryMatch {
+	if v == nil {
+		v = version.DefaultVersioner()
+	}
+
+	ans := []AdvisoryMatch{}
+	for _, adv := range a {
+		for _, p := range installed {
+			if !adv.Affects(p, v) {
+				continue
+			}
+			m := AdvisoryMatch{Advisory: adv, Package: p}
+			m.Upgrade, m.Repository = adv.minimalUpgrade(p, repos, v)
+			ans = append(ans, m)
+		}
+	}
+
+	sort.SliceStable(ans, func(i, j int) bool {
+		if ans[i].Advisory.ID != ans[j].Advisory.ID {
+			return ans[i].Advisory.ID < ans[j].Advisory.ID
+		}
+		return ans[i].Package.HumanReadableString() < ans[j].Package.HumanReadableString()
+	})
+	return ans
+}
+
+func (a *Advisory) minimalUpgrade(p pkg.Package, repos Repositories, v version.Versioner) (pkg.Package, string) {
+	fixed := a.fixedVersion(p)
+
+	candidates := map[string]pkg.Package{}
+	repoOf := map[string]string{}
+	for _, r := range repos {
+		versions, err := r.GetTree().GetDatabase().FindPackageVersions(p)
+		if err != nil {
+			continue
+		}
+		for _, c := range versions {
+			if a.Affects(c, v) {
+				continue
+			}
+			if fixed != "" && !v.ValidateSelector(c.GetVersion(), ">="+fixed) {
+				continue
+			}
+			if fixed == "" && !v.ValidateSelector(c.GetVersion(), ">"+p.GetVersion()) {
+				continue
+			}
+			if _, ok := candidates[c.GetVersion()]; !ok {
+				candidates[c.GetVersion()] = c
+				repoOf[c.GetVersion()] = r.GetName()
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ""
+	}
+
+	versions := []string{}
+	for ver := range candidates {
+		versions = append(versions, ver)
+	}
+	lowest := v.Sort(versions)[0]
+	return candidates[lowest], repoOf[lowest]
+}
@@ -0,0 +1,125 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const testAdvisory = `
+id: LUET-2020-0001
+severity: high
+description: Remote code execution in a
+affected:
+- category: test
+  name: a
+  version: "<1.2"
+fixed:
+- category: test
+  name: a
+  version: "1.2"
+`
+
+var _ = Describe("Advisories", func() {
+	var treeDir, repoDir string
+
+	a10 := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+	a11 := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.1"}
+	a12 := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.2"}
+	a13 := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.3"}
+	b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+
+	BeforeEach(func() {
+		var err error
+		treeDir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+
+		db := pkg.NewInMemoryDatabase(false)
+		for _, p := range []*pkg.DefaultPackage{a11, a12, a13, b} {
+			_, err := db.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(FakeArtifact(repoDir, p)).ToNot(HaveOccurred())
+		}
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(treeDir, AdvisoriesDir), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(treeDir, AdvisoriesDir, "0001.yaml"), []byte(testAdvisory), 0644)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(treeDir)
+		os.RemoveAll(repoDir)
+	})
+
+	It("Are shipped with the repository", func() {
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(repo.GetAdvisories())).To(Equal(1))
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+
+		local, err := LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(local.GetTreePath())
+		defer os.RemoveAll(local.GetMetaPath())
+		Expect(len(local.GetAdvisories())).To(Equal(1))
+		Expect(local.GetAdvisories()[0].Severity).To(Equal("high"))
+
+		r := NewSystemRepository(config.LuetRepository{
+			Name:   "advisories",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})
+		synced, err := r.Sync(false)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(synced.GetTreePath())
+		defer os.RemoveAll(synced.GetMetaPath())
+		Expect(len(synced.GetAdvisories())).To(Equal(1))
+		Expect(synced.GetAdvisories()[0].ID).To(Equal("LUET-2020-0001"))
+	})
+
+	It("Rejects duplicate advisories", func() {
+		Expect(ioutil.WriteFile(filepath.Join(treeDir, AdvisoriesDir, "0002.yaml"), []byte(testAdvisory), 0644)).ToNot(HaveOccurred())
+		_, err := LoadAdvisoriesDir(filepath.Join(treeDir, AdvisoriesDir))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Suggests the minimal upgrades for the installed packages", func() {
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+
+		matches := repo.GetAdvisories().Audit(pkg.Packages{a10, b}, Repositories{repo}, nil)
+		Expect(len(matches)).To(Equal(1))
+		Expect(matches[0].Package.GetVersion()).To(Equal("1.0"))
+		Expect(matches[0].Upgrade).ToNot(BeNil())
+		Expect(matches[0].Upgrade.GetVersion()).To(Equal("1.2"))
+		Expect(matches[0].Repository).To(Equal("test"))
+
+		Expect(len(repo.GetAdvisories().Audit(pkg.Packages{a13, b}, Repositories{repo}, nil))).To(Equal(0))
+	})
+})
@@ -0,0 +1,125 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multi-architecture repositories", func() {
+	var treeDir, repoDir, oldArch string
+
+	BeforeEach(func() {
+		var err error
+		treeDir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+		oldArch = config.LuetCfg.GetSystem().Arch
+
+		db := pkg.NewInMemoryDatabase(false)
+		for _, p := range []*pkg.DefaultPackage{
+			{Name: "a", Category: "test", Version: "1.0"},
+			{Name: "b", Category: "test", Version: "1.0"},
+			{Name: "c", Category: "test", Version: "1.0"},
+		} {
+			_, err := db.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		// a is built for both architectures, b only for arm64, c is generic
+		for _, p := range []*pkg.DefaultPackage{
+			{Name: "a", Category: "test", Version: "1.0", Arch: "amd64"},
+			{Name: "a", Category: "test", Version: "1.0", Arch: "arm64"},
+			{Name: "b", Category: "test", Version: "1.0", Arch: "arm64"},
+			{Name: "c", Category: "test", Version: "1.0"},
+		} {
+			Expect(FakeArtifact(repoDir, p)).ToNot(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		config.LuetCfg.GetSystem().Arch = oldArch
+		os.RemoveAll(treeDir)
+		os.RemoveAll(repoDir)
+	})
+
+	It("Hosts the artifacts of all the architectures", func() {
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(repo.GetIndex())).To(Equal(4))
+		Expect(repo.(*LuetSystemRepository).Arches).To(Equal([]string{"amd64", "arm64"}))
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+
+		config.LuetCfg.GetSystem().Arch = "amd64"
+		r := NewSystemRepository(config.LuetRepository{
+			Name:   "multiarch",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})
+		synced, err := r.Sync(false)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(synced.GetTreePath())
+		defer os.RemoveAll(synced.GetMetaPath())
+		Expect(synced.(*LuetSystemRepository).Arches).To(Equal([]string{"amd64", "arm64"}))
+
+		Expect(len(synced.GetIndex())).To(Equal(2))
+		for _, a := range synced.GetIndex() {
+			Expect(a.GetCompileSpec().GetPackage().MatchArch("amd64")).To(BeTrue())
+		}
+
+		db := synced.GetTree().GetDatabase()
+		_, err = db.FindPackage(&pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = db.FindPackage(&pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"})
+		Expect(err).To(HaveOccurred())
+		_, err = db.FindPackage(&pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Keeps the artifacts of all the architectures with SyncAll", func() {
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+
+		config.LuetCfg.GetSystem().Arch = "amd64"
+		r := NewSystemRepository(config.LuetRepository{
+			Name:   "multiarch",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})
+		synced, err := r.SyncAll(false)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(synced.GetTreePath())
+		defer os.RemoveAll(synced.GetMetaPath())
+
+		Expect(len(synced.GetIndex())).To(Equal(4))
+		_, err = synced.GetTree().GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,86 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+	"path"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/pkg/errors"
+)
+
+// RepositoryArtifactCache provides to the compiler the artifacts published in
+// repositories, so packages with unchanged sources are not built again.
+type RepositoryArtifactCache struct {
+	Repositories Repositories
+}
+
+func NewRepositoryArtifactCache(repos Repositories) *RepositoryArtifactCache {
+	return &RepositoryArtifactCache{Repositories: repos}
+}
+
+// GetArtifact downloads the artifact of the package built from the same
+// sources into the output folder of the spec, along with its metadata.
+func (c *RepositoryArtifactCache) GetArtifact(p compiler.CompilationSpec, sourceHash string) (compiler.Artifact, error) {
+	for _, r := range c.Repositories {
+		for _, a := range r.GetIndex() {
+			if a.GetSourceHash() != sourceHash ||
+				a.GetCompileSpec().GetPackage().GetArtifactFingerPrint() != p.GetPackage().GetArtifactFingerPrint() {
+				continue
+			}
+
+			Debug("Found", p.GetPackage().HumanReadableString(), "in repository", r.GetName())
+			downloaded, err := r.Client().DownloadArtifact(a)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error on download artifact")
+			}
+			err = downloaded.Verify()
+			if err != nil {
+				return nil, errors.Wrap(err, "Artifact integrity check failure")
+			}
+
+			dst := p.Rel(path.Base(a.GetPath()))
+			err = helpers.CopyFile(downloaded.GetPath(), dst)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error met while copying "+dst)
+			}
+			downloaded.SetPath(dst)
+
+			if ref := downloaded.GetProvenance(); ref != nil {
+				file, err := r.Client().DownloadFile(ref.Path)
+				if err != nil {
+					return nil, errors.Wrap(err, "Error on download provenance")
+				}
+				defer os.Remove(file)
+				err = helpers.CopyFile(file, p.Rel(ref.Path))
+				if err != nil {
+					return nil, errors.Wrap(err, "Error met while copying "+ref.Path)
+				}
+			}
+
+			err = downloaded.WriteYaml(p.GetOutputPath())
+			if err != nil {
+				return nil, err
+			}
+			return downloaded, nil
+		}
+	}
+	return nil, nil
+}
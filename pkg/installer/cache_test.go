@@ -0,0 +1,103 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repository artifact cache", func() {
+	var treeDir, repoDir, outDir string
+	p := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+
+	BeforeEach(func() {
+		var err error
+		treeDir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+		outDir, err = ioutil.TempDir("", "build")
+		Expect(err).ToNot(HaveOccurred())
+
+		db := pkg.NewInMemoryDatabase(false)
+		_, err = db.CreatePackage(p)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		Expect(FakeArtifact(repoDir, p)).ToNot(HaveOccurred())
+		metadata := filepath.Join(repoDir, p.GetArtifactFingerPrint()+".metadata.yaml")
+		dat, err := ioutil.ReadFile(metadata)
+		Expect(err).ToNot(HaveOccurred())
+		a, err := compiler.NewPackageArtifactFromYaml(dat)
+		Expect(err).ToNot(HaveOccurred())
+		a.SetPath(filepath.Join(repoDir, filepath.Base(a.GetPath())))
+		a.SetSourceHash("sourcehash")
+		Expect(a.WriteYaml(repoDir)).ToNot(HaveOccurred())
+
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(treeDir)
+		os.RemoveAll(repoDir)
+		os.RemoveAll(outDir)
+	})
+
+	It("Provides the artifacts built from the same sources", func() {
+		r := NewSystemRepository(config.LuetRepository{
+			Name:   "cache",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})
+		synced, err := r.Sync(false)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(synced.GetTreePath())
+		defer os.RemoveAll(synced.GetMetaPath())
+
+		cache := NewRepositoryArtifactCache(Repositories{synced})
+		spec := &compiler.LuetCompilationSpec{Package: p, OutputPath: outDir}
+
+		a, err := cache.GetArtifact(spec, "otherhash")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a).To(BeNil())
+
+		a, err = cache.GetArtifact(spec, "sourcehash")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a).ToNot(BeNil())
+		Expect(a.GetPath()).To(Equal(filepath.Join(outDir, p.GetArtifactFingerPrint()+".package.tar")))
+		Expect(a.Verify()).ToNot(HaveOccurred())
+
+		reloaded, err := compiler.LoadArtifactFromYaml(spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reloaded.GetSourceHash()).To(Equal("sourcehash"))
+		Expect(helpers.Exists(reloaded.GetPath())).To(BeTrue())
+	})
+})
@@ -17,7 +17,11 @@ package client
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"mime/multipart"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -31,10 +35,16 @@ import (
 	"github.com/mudler/luet/pkg/helpers"
 
 	"github.com/cavaliercoder/grab"
+	"github.com/pkg/errors"
 
 	"github.com/schollz/progressbar/v3"
 )
 
+const (
+	// PublishPath is the endpoint of the repository server accepting uploads
+	PublishPath = "/api/v1/publish"
+)
+
 type HttpClient struct {
 	RepoData RepoData
 }
@@ -50,15 +60,35 @@ func (c *HttpClient) PrepareReq(dst, url string) (*grab.Request, error) {
 		return nil, err
 	}
 
-	if val, ok := c.RepoData.Authentication["token"]; ok {
-		req.HTTPRequest.Header.Set("Authorization", "token "+val)
-	} else if val, ok := c.RepoData.Authentication["basic"]; ok {
-		req.HTTPRequest.Header.Set("Authorization", "Basic "+val)
+	err = c.setAuthentication(req.HTTPRequest.Header, url)
+	if err != nil {
+		return nil, err
 	}
 
 	return req, err
 }
 
+func (c *HttpClient) setAuthentication(h http.Header, url string) error {
+	auth, err := AuthorizationHeader(c.RepoData.Authentication, url)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		h.Set("Authorization", auth)
+	}
+	return nil
+}
+
+func (c *HttpClient) grabClient() (*grab.Client, error) {
+	httpClient, err := NewRepositoryHTTPClient(c.RepoData.Http)
+	if err != nil {
+		return nil, err
+	}
+	client := grab.NewClient()
+	client.HTTPClient = httpClient
+	return client, nil
+}
+
 func Round(input float64) float64 {
 	if input < 0 {
 		return math.Ceil(input - 0.5)
@@ -87,7 +117,10 @@ func (c *HttpClient) DownloadArtifact(artifact compiler.Artifact) (compiler.Arti
 		}
 		defer os.RemoveAll(temp)
 
-		client := grab.NewClient()
+		client, err := c.grabClient()
+		if err != nil {
+			return nil, err
+		}
 
 		for _, uri := range c.RepoData.Urls {
 			Debug("Downloading artifact", artifactName, "from", uri)
@@ -187,7 +220,10 @@ func (c *HttpClient) DownloadFile(name string) (string, error) {
 		return "", err
 	}
 
-	client := grab.NewClient()
+	client, err := c.grabClient()
+	if err != nil {
+		return "", err
+	}
 
 	for _, uri := range c.RepoData.Urls {
 
@@ -232,3 +268,82 @@ func (c *HttpClient) DownloadFile(name string) (string, error) {
 
 	return file.Name(), err
 }
+
+// Upload publishes an artifact, its metadata file and, if not empty, its
+// provenance document and package definition, to the repository served at the
+// first url, with the repository credentials.
+func (c *HttpClient) Upload(artifact, metadata, provenance, definition string) error {
+	if len(c.RepoData.Urls) == 0 {
+		return errors.New("No repository url")
+	}
+	u, err := url.Parse(c.RepoData.Urls[0])
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, PublishPath)
+
+	// Stream the files, artifacts can be big. The writer starts only once
+	// the request can be sent, otherwise nothing would ever read the pipe
+	r, w := io.Pipe()
+	form := multipart.NewWriter(w)
+	files := map[string]string{"artifact": artifact, "metadata": metadata}
+	if provenance != "" {
+		files["provenance"] = provenance
+	}
+	if definition != "" {
+		files["definition"] = definition
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	err = c.setAuthentication(req.Header, u.String())
+	if err != nil {
+		return err
+	}
+
+	httpClient, err := NewRepositoryHTTPClient(c.RepoData.Http)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for field, file := range files {
+			err := addFormFile(form, field, file)
+			if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+		w.CloseWithError(form.Close())
+	}()
+
+	Debug("Uploading", artifact, "to", u.String())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("Upload failed: %s: %s", resp.Status, msg))
+	}
+	return nil
+}
+
+func addFormFile(form *multipart.Writer, field, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	part, err := form.CreateFormFile(field, filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
@@ -15,7 +15,10 @@
 
 package client
 
+import "github.com/mudler/luet/pkg/config"
+
 type RepoData struct {
 	Urls           []string
 	Authentication map[string]string
+	Http           config.LuetRepositoryHttp
 }
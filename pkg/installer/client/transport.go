@@ -0,0 +1,206 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// NewRepositoryHTTPClient returns an http client honoring the TLS, proxy and timeout
+// settings of a repository.
+func NewRepositoryHTTPClient(o config.LuetRepositoryHttp) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: o.Insecure}
+
+	if o.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		ca, err := ioutil.ReadFile(o.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed reading CA bundle")
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("No valid certificate found in " + o.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if o.ClientCert != "" || o.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed loading client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid proxy "+o.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	// Start from the default transport, so clients keep HTTP/2 and the reuse
+	// of connections
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+	if o.ConnectTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   time.Duration(o.ConnectTimeout) * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = time.Duration(o.ConnectTimeout) * time.Second
+	}
+
+	return &http.Client{
+		Timeout:   time.Duration(o.Timeout) * time.Second,
+		Transport: transport,
+	}, nil
+}
+
+// AuthorizationHeader returns the Authorization header to send to the given
+// url, if any. Besides the inline "token" and "basic" values, the credentials
+// can be read from:
+//
+//	token_file, basic_file: a file holding the value
+//	token_env, basic_env: an environment variable holding the value
+//	netrc: "true" to use ~/.netrc, or the path of a netrc file
+//
+// Basic values are base64 encoded "user:password" pairs, while netrc
+// entries hold login and password of the url host.
+func AuthorizationHeader(auth map[string]string, uri string) (string, error) {
+	for _, t := range []struct{ key, header string }{{"token", "token "}, {"basic", "Basic "}} {
+		if val, ok := auth[t.key]; ok {
+			return t.header + val, nil
+		}
+		if file, ok := auth[t.key+"_file"]; ok {
+			dat, err := ioutil.ReadFile(file)
+			if err != nil {
+				return "", errors.Wrap(err, "Failed reading credentials")
+			}
+			return t.header + strings.TrimSpace(string(dat)), nil
+		}
+		if env, ok := auth[t.key+"_env"]; ok {
+			val := os.Getenv(env)
+			if val == "" {
+				return "", errors.New("Environment variable " + env + " is not set")
+			}
+			return t.header + val, nil
+		}
+	}
+
+	if netrc, ok := auth["netrc"]; ok && netrc != "false" {
+		if netrc == "true" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			netrc = filepath.Join(home, ".netrc")
+		}
+		u, err := url.Parse(uri)
+		if err != nil {
+			return "", err
+		}
+		login, password, err := netrcCredentials(netrc, u.Hostname())
+		if err != nil {
+			return "", err
+		}
+		if login != "" || password != "" {
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(login+":"+password)), nil
+		}
+	}
+
+	return "", nil
+}
+
+// netrcCredentials returns login and password of the machine in the netrc
+// file, falling back to the default entry.
+func netrcCredentials(file, host string) (string, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Failed reading netrc")
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	type entry struct{ login, password string }
+	var match, def *entry
+	var current *entry
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			current = &entry{}
+			if i+1 < len(tokens) && tokens[i+1] == host && match == nil {
+				match = current
+			}
+			i++
+		case "default":
+			current = &entry{}
+			if def == nil {
+				def = current
+			}
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				break
+			}
+			if current != nil && tokens[i] == "login" {
+				current.login = tokens[i+1]
+			} else if current != nil && tokens[i] == "password" {
+				current.password = tokens[i+1]
+			}
+			i++
+		}
+	}
+
+	if match == nil {
+		match = def
+	}
+	if match == nil {
+		return "", "", nil
+	}
+	return match.login, match.password, nil
+}
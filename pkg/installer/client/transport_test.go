@@ -0,0 +1,203 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mudler/luet/pkg/config"
+	helpers "github.com/mudler/luet/pkg/helpers"
+
+	. "github.com/mudler/luet/pkg/installer/client"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeCertificate writes a certificate and its key in dir, signed by parent
+// (self signed if nil), and returns them.
+func writeCertificate(dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).ToNot(HaveOccurred())
+	return cert, key
+}
+
+var _ = Describe("Http transport", func() {
+	var tmpdir, certs string
+	var ts *httptest.Server
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "test")
+		Expect(err).ToNot(HaveOccurred())
+		certs, err = ioutil.TempDir("", "certs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "test.txt"), []byte(`test`), os.ModePerm)).ToNot(HaveOccurred())
+
+		ts = httptest.NewUnstartedServer(http.FileServer(http.Dir(tmpdir)))
+	})
+
+	AfterEach(func() {
+		ts.Close()
+		os.RemoveAll(tmpdir)
+		os.RemoveAll(certs)
+	})
+
+	Context("With TLS", func() {
+		BeforeEach(func() {
+			ts.StartTLS()
+			Expect(ioutil.WriteFile(filepath.Join(certs, "server.pem"),
+				pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644)).ToNot(HaveOccurred())
+		})
+
+		It("Requires the server CA to be trusted", func() {
+			c := NewHttpClient(RepoData{Urls: []string{ts.URL}})
+			_, err := c.DownloadFile("test.txt")
+			Expect(err).To(HaveOccurred())
+
+			c = NewHttpClient(RepoData{Urls: []string{ts.URL}, Http: config.LuetRepositoryHttp{CACert: filepath.Join(certs, "server.pem")}})
+			path, err := c.DownloadFile("test.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Read(path)).To(Equal("test"))
+			os.RemoveAll(path)
+		})
+
+		It("Skips verification if insecure", func() {
+			c := NewHttpClient(RepoData{Urls: []string{ts.URL}, Http: config.LuetRepositoryHttp{Insecure: true}})
+			path, err := c.DownloadFile("test.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Read(path)).To(Equal("test"))
+			os.RemoveAll(path)
+		})
+	})
+
+	Context("With HTTP/2", func() {
+		BeforeEach(func() {
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+		})
+
+		It("Keeps the features of the default transport", func() {
+			httpClient, err := NewRepositoryHTTPClient(config.LuetRepositoryHttp{Insecure: true, ConnectTimeout: 5})
+			Expect(err).ToNot(HaveOccurred())
+			resp, err := httpClient.Get(ts.URL + "/test.txt")
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.ProtoMajor).To(Equal(2))
+		})
+	})
+
+	Context("With client certificates", func() {
+		It("Authenticates with the configured certificate", func() {
+			ca, caKey := writeCertificate(certs, "ca", nil, nil, x509.ExtKeyUsageClientAuth)
+			writeCertificate(certs, "client", ca, caKey, x509.ExtKeyUsageClientAuth)
+
+			pool := x509.NewCertPool()
+			pool.AddCert(ca)
+			ts.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+			ts.StartTLS()
+			Expect(ioutil.WriteFile(filepath.Join(certs, "server.pem"),
+				pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644)).ToNot(HaveOccurred())
+
+			c := NewHttpClient(RepoData{Urls: []string{ts.URL}, Http: config.LuetRepositoryHttp{CACert: filepath.Join(certs, "server.pem")}})
+			_, err := c.DownloadFile("test.txt")
+			Expect(err).To(HaveOccurred())
+
+			c = NewHttpClient(RepoData{Urls: []string{ts.URL}, Http: config.LuetRepositoryHttp{
+				CACert:     filepath.Join(certs, "server.pem"),
+				ClientCert: filepath.Join(certs, "client.pem"),
+				ClientKey:  filepath.Join(certs, "client.key"),
+			}})
+			path, err := c.DownloadFile("test.txt")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Read(path)).To(Equal("test"))
+			os.RemoveAll(path)
+		})
+	})
+
+	Context("Credentials", func() {
+		It("Reads them from files, environment and netrc", func() {
+			Expect(ioutil.WriteFile(filepath.Join(certs, "token"), []byte("secret\n"), 0600)).ToNot(HaveOccurred())
+			h, err := AuthorizationHeader(map[string]string{"token_file": filepath.Join(certs, "token")}, "https://example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(h).To(Equal("token secret"))
+
+			os.Setenv("LUET_TEST_TOKEN", "envsecret")
+			defer os.Unsetenv("LUET_TEST_TOKEN")
+			h, err = AuthorizationHeader(map[string]string{"token_env": "LUET_TEST_TOKEN"}, "https://example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(h).To(Equal("token envsecret"))
+
+			_, err = AuthorizationHeader(map[string]string{"basic_env": "LUET_TEST_NOTSET"}, "https://example.com")
+			Expect(err).To(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(certs, "netrc"), []byte(`
+machine other.com login foo password bar
+machine example.com
+  login user
+  password pass
+default login anon password none
+`), 0600)).ToNot(HaveOccurred())
+			h, err = AuthorizationHeader(map[string]string{"netrc": filepath.Join(certs, "netrc")}, "https://example.com:8080/repo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(h).To(Equal("Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))))
+
+			h, err = AuthorizationHeader(map[string]string{"netrc": filepath.Join(certs, "netrc")}, "https://unknown.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(h).To(Equal("Basic " + base64.StdEncoding.EncodeToString([]byte("anon:none"))))
+
+			h, err = AuthorizationHeader(map[string]string{}, "https://example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(h).To(BeEmpty())
+		})
+	})
+})
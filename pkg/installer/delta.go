@@ -0,0 +1,476 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+	tree "github.com/mudler/luet/pkg/tree"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+const (
+	REPOSITORY_DELTAFILE = "repository.delta.yaml"
+
+	REPOFILE_DELTA_KEY = "delta"
+)
+
+// LuetRepositoryDelta holds the changes of the tree and of the
+// repository index between a revision and the previous one.
+type LuetRepositoryDelta struct {
+	Revision   int    `json:"revision"`
+	LastUpdate string `json:"last_update,omitempty"`
+
+	// BaseRevision, BaseLastUpdate and BaseChecksums identify the revision the
+	// delta applies to. BaseChecksums are the checksums of its tree file.
+	BaseRevision   int                `json:"base_revision"`
+	BaseLastUpdate string             `json:"base_last_update,omitempty"`
+	BaseChecksums  compiler.Checksums `json:"base_checksums,omitempty"`
+
+	// Files are the tree files added or changed, indexed by their path
+	// relative to the tree root.
+	Files        map[string]string `json:"files,omitempty"`
+	RemovedFiles []string          `json:"removed_files,omitempty"`
+
+	// Index are the index entries added or changed, while RemovedIndex holds
+	// the fingerprints of the packages removed from the index.
+	Index        []*compiler.PackageArtifact `json:"index,omitempty"`
+	RemovedIndex []string                    `json:"removed_index,omitempty"`
+}
+
+// DeltaRepositoryFileKey returns the repository file key of the delta
+// which brings a repository to the given revision.
+func DeltaRepositoryFileKey(revision int) string {
+	return fmt.Sprintf("%s-%d", REPOFILE_DELTA_KEY, revision)
+}
+
+// DeltaRevisionFromKey returns the revision of the delta associated
+// to the repository file key.
+func DeltaRevisionFromKey(key string) (int, bool) {
+	if !strings.HasPrefix(key, REPOFILE_DELTA_KEY+"-") {
+		return 0, false
+	}
+	rev, err := strconv.Atoi(strings.TrimPrefix(key, REPOFILE_DELTA_KEY+"-"))
+	if err != nil {
+		return 0, false
+	}
+	return rev, true
+}
+
+func NewDefaultDeltaRepositoryFile(revision int) LuetRepositoryFile {
+	return LuetRepositoryFile{
+		FileName:        fmt.Sprintf("repository.delta-%d.yaml.tar", revision),
+		CompressionType: compiler.GZip,
+	}
+}
+
+func NewLuetRepositoryDeltaFromFile(file string) (*LuetRepositoryDelta, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := &LuetRepositoryDelta{}
+	err = yaml.Unmarshal(dat, ans)
+	if err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// NewLuetRepositoryDelta computes the changes between two unpacked trees and
+// their indexes.
+func NewLuetRepositoryDelta(revision int, oldTree, newTree string, oldIndex, newIndex compiler.ArtifactIndex) (*LuetRepositoryDelta, error) {
+	d := &LuetRepositoryDelta{Revision: revision, Files: map[string]string{}}
+
+	oldFiles, err := treeFiles(oldTree)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := treeFiles(newTree)
+	if err != nil {
+		return nil, err
+	}
+
+	for f, content := range newFiles {
+		if old, ok := oldFiles[f]; !ok || !bytes.Equal(old, content) {
+			d.Files[f] = string(content)
+		}
+	}
+	for f := range oldFiles {
+		if _, ok := newFiles[f]; !ok {
+			d.RemovedFiles = append(d.RemovedFiles, f)
+		}
+	}
+	sort.Strings(d.RemovedFiles)
+
+	oldEntries, err := indexEntries(oldIndex)
+	if err != nil {
+		return nil, err
+	}
+	newEntries, err := indexEntries(newIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range newIndex {
+		fp := a.GetCompileSpec().GetPackage().GetFingerPrint()
+		if old, ok := oldEntries[fp]; !ok || !bytes.Equal(old, newEntries[fp]) {
+			d.Index = append(d.Index, a.(*compiler.PackageArtifact))
+		}
+	}
+	for fp := range oldEntries {
+		if _, ok := newEntries[fp]; !ok {
+			d.RemovedIndex = append(d.RemovedIndex, fp)
+		}
+	}
+	sort.Strings(d.RemovedIndex)
+
+	return d, nil
+}
+
+func treeFiles(root string) (map[string][]byte, error) {
+	ans := map[string][]byte{}
+	err := filepath.Walk(root, func(currentpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, currentpath)
+		if err != nil {
+			return err
+		}
+		dat, err := ioutil.ReadFile(currentpath)
+		if err != nil {
+			return errors.Wrap(err, "Error reading file "+currentpath)
+		}
+		ans[filepath.ToSlash(rel)] = dat
+		return nil
+	})
+	return ans, err
+}
+
+func indexEntries(i compiler.ArtifactIndex) (map[string][]byte, error) {
+	ans := map[string][]byte{}
+	for _, a := range i {
+		dat, err := yaml.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		ans[a.GetCompileSpec().GetPackage().GetFingerPrint()] = dat
+	}
+	return ans, nil
+}
+
+func (d *LuetRepositoryDelta) WriteFile(path string) error {
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, os.ModePerm)
+}
+
+// Apply applies the delta to an unpacked tree and to the repository metadata.
+func (d *LuetRepositoryDelta) Apply(treePath string, meta *LuetSystemRepositoryMetadata) error {
+	var err error
+	compactFile := filepath.Join(treePath, tree.CompactTreeFile)
+	if helpers.Exists(compactFile) {
+		err = d.applyCompact(compactFile)
+	} else {
+		err = d.applyFiles(treePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, fp := range d.RemovedIndex {
+		removed[fp] = true
+	}
+	for _, a := range d.Index {
+		removed[a.GetCompileSpec().GetPackage().GetFingerPrint()] = true
+	}
+
+	index := []*compiler.PackageArtifact{}
+	for _, a := range meta.Index {
+		if !removed[a.GetCompileSpec().GetPackage().GetFingerPrint()] {
+			index = append(index, a)
+		}
+	}
+	meta.Index = append(index, d.Index...)
+
+	return nil
+}
+
+// AppliesTo returns an error if the delta was not computed from the given
+// revision. Checksums of the base tree file are compared only if given.
+func (d *LuetRepositoryDelta) AppliesTo(revision int, lastUpdate string, checksums compiler.Checksums) error {
+	if d.BaseRevision != revision || d.BaseLastUpdate == "" || d.BaseLastUpdate != lastUpdate {
+		return errors.New(fmt.Sprintf("Delta for revision %d was not computed from the local revision", d.Revision))
+	}
+	if len(checksums) != 0 && (len(d.BaseChecksums) == 0 || d.BaseChecksums.Compare(checksums) != nil) {
+		return errors.New(fmt.Sprintf("Delta for revision %d was not computed from the local tree", d.Revision))
+	}
+	return nil
+}
+
+// applyCompact applies the tree changes to a compact tree. Files of the delta
+// follow the layout of InstallerRecipe.Save.
+func (d *LuetRepositoryDelta) applyCompact(file string) error {
+	t, err := tree.NewCompactTreeFromFile(file)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range d.RemovedFiles {
+		dir, name := path.Split(f)
+		dir = path.Clean(dir)
+		switch name {
+		case tree.DefinitionFile:
+			t.RemovePackage(dir)
+		case tree.FinalizerFile:
+			delete(t.Finalizers, dir)
+		}
+	}
+	for f, content := range d.Files {
+		dir, name := path.Split(f)
+		dir = path.Clean(dir)
+		switch name {
+		case tree.DefinitionFile:
+			p, err := pkg.DefaultPackageFromYaml([]byte(content))
+			if err != nil {
+				return errors.Wrap(err, "Error reading yaml "+f)
+			}
+			t.SetPackage(dir, &p)
+		case tree.FinalizerFile:
+			t.Finalizers[dir] = content
+		}
+	}
+
+	return t.WriteFile(file)
+}
+
+func (d *LuetRepositoryDelta) applyFiles(treePath string) error {
+	for _, f := range d.RemovedFiles {
+		dst, err := deltaPath(treePath, f)
+		if err != nil {
+			return err
+		}
+		err = os.RemoveAll(dst)
+		if err != nil {
+			return err
+		}
+	}
+	for f, content := range d.Files {
+		dst, err := deltaPath(treePath, f)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(dst, []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deltaPath returns the path of a delta file inside the tree, refusing paths
+// which would escape from it.
+func deltaPath(treePath, f string) (string, error) {
+	dst := filepath.Join(treePath, filepath.FromSlash(f))
+	if !strings.HasPrefix(dst, filepath.Clean(treePath)+string(os.PathSeparator)) {
+		return "", errors.New("Invalid file path in delta: " + f)
+	}
+	return dst, nil
+}
+
+// writeDelta computes the delta between the repository previously available in dst and the
+// tree saved in treePath, and writes it in dst. Deltas older than the configured
+// number of revisions are removed.
+func (r *LuetSystemRepository) writeDelta(dst, treePath string, previous Repository) error {
+	if previous.GetRevision() != r.Revision-1 {
+		return nil
+	}
+
+	// Keep the deltas of the previous revisions still in range
+	for k, f := range previous.(*LuetSystemRepository).RepositoryFiles {
+		rev, ok := DeltaRevisionFromKey(k)
+		if !ok {
+			continue
+		}
+		if rev > r.Revision-r.DeltaRevisions {
+			r.SetRepositoryFile(k, f)
+		} else {
+			os.Remove(filepath.Join(dst, f.GetFileName()))
+		}
+	}
+
+	delta, err := NewLuetRepositoryDelta(r.Revision, previous.GetTreePath(), treePath, previous.GetIndex(), r.Index.CleanPath())
+	if err != nil {
+		return errors.Wrap(err, "Failed computing repository delta")
+	}
+	delta.LastUpdate = r.LastUpdate
+	delta.BaseRevision = previous.GetRevision()
+	delta.BaseLastUpdate = previous.GetLastUpdate()
+	if treeFile, err := previous.GetRepositoryFile(REPOFILE_TREE_KEY); err == nil {
+		delta.BaseChecksums = treeFile.GetChecksums()
+	}
+
+	deltaTmpDir, err := config.LuetCfg.GetSystem().TempDir("delta")
+	if err != nil {
+		return errors.Wrap(err, "Error met while creating tempdir for delta")
+	}
+	defer os.RemoveAll(deltaTmpDir)
+
+	err = delta.WriteFile(filepath.Join(deltaTmpDir, REPOSITORY_DELTAFILE))
+	if err != nil {
+		return err
+	}
+
+	deltaFile := NewDefaultDeltaRepositoryFile(r.Revision)
+	a := compiler.NewPackageArtifact(filepath.Join(dst, deltaFile.GetFileName()))
+	a.SetCompressionType(deltaFile.GetCompressionType())
+	err = a.Compress(deltaTmpDir, 1)
+	if err != nil {
+		return errors.Wrap(err, "Error met while archiving repository delta")
+	}
+	deltaFile.SetFileName(filepath.Base(a.GetPath()))
+	err = a.Hash()
+	if err != nil {
+		return errors.Wrap(err, "Failed generating checksums for delta")
+	}
+	deltaFile.SetChecksums(a.GetChecksums())
+	r.SetRepositoryFile(DeltaRepositoryFileKey(r.Revision), deltaFile)
+
+	return nil
+}
+
+// syncDeltas brings the unpacked tree and metadata of a cached repository from the
+// local revision to the remote one by applying the deltas advertised by the remote.
+func (r *LuetSystemRepository) syncDeltas(c Client, local, remote Repository, treefs, metafs string) error {
+	if local.GetRevision() >= remote.GetRevision() {
+		return errors.New("No deltas to apply")
+	}
+	if !helpers.Exists(treefs) || !helpers.Exists(metafs) {
+		return errors.New("No local tree available")
+	}
+
+	deltas := []LuetRepositoryFile{}
+	for rev := local.GetRevision() + 1; rev <= remote.GetRevision(); rev++ {
+		f, err := remote.GetRepositoryFile(DeltaRepositoryFileKey(rev))
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Delta for revision %d not available", rev))
+		}
+		deltas = append(deltas, f)
+	}
+
+	metaFile := filepath.Join(metafs, REPOSITORY_METAFILE)
+	meta, err := NewLuetSystemRepositoryMetadata(metaFile, false)
+	if err != nil {
+		return errors.Wrap(err, "While processing "+REPOSITORY_METAFILE)
+	}
+
+	// Apply all the deltas on a copy of the tree, so a failure leaves the cache untouched
+	newTree := treefs + ".delta"
+	os.RemoveAll(newTree)
+	err = helpers.CopyDir(treefs, newTree)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(newTree)
+
+	// Deltas must chain from the cached revision, which might come from a
+	// different history if the remote revision was reset
+	baseRevision, baseLastUpdate := local.GetRevision(), local.GetLastUpdate()
+	var baseChecksums compiler.Checksums
+	if treeFile, err := local.GetRepositoryFile(REPOFILE_TREE_KEY); err == nil {
+		baseChecksums = treeFile.GetChecksums()
+	}
+
+	for _, f := range deltas {
+		a, err := c.DownloadArtifact(compiler.NewPackageArtifact(f.GetFileName()))
+		if err != nil {
+			return errors.Wrap(err, "While downloading "+f.GetFileName())
+		}
+		defer os.Remove(a.GetPath())
+
+		a.SetChecksums(f.GetChecksums())
+		a.SetCompressionType(f.GetCompressionType())
+		err = a.Verify()
+		if err != nil {
+			return errors.Wrap(err, "Delta integrity check failure")
+		}
+
+		deltaDir, err := config.LuetCfg.GetSystem().TempDir("delta")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(deltaDir)
+
+		err = a.Unpack(deltaDir, true)
+		if err != nil {
+			return errors.Wrap(err, "Error met while unpacking delta")
+		}
+
+		delta, err := NewLuetRepositoryDeltaFromFile(filepath.Join(deltaDir, REPOSITORY_DELTAFILE))
+		if err != nil {
+			return errors.Wrap(err, "While processing "+f.GetFileName())
+		}
+
+		err = delta.AppliesTo(baseRevision, baseLastUpdate, baseChecksums)
+		if err != nil {
+			return err
+		}
+
+		err = delta.Apply(newTree, meta)
+		if err != nil {
+			return errors.Wrap(err, "While applying "+f.GetFileName())
+		}
+		baseRevision, baseLastUpdate, baseChecksums = delta.Revision, delta.LastUpdate, nil
+	}
+
+	err = os.RemoveAll(treefs)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(newTree, treefs)
+	if err != nil {
+		return err
+	}
+
+	// The metadata is written only once the tree is in place, so it never
+	// describes a revision the cached tree doesn't have
+	return meta.WriteFile(metaFile)
+}
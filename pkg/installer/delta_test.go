@@ -0,0 +1,209 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	config "github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Delta", func() {
+	Context("Repository deltas", func() {
+		var src, rootfs, oldRootfs string
+		var err error
+
+		BeforeEach(func() {
+			src, err = ioutil.TempDir("", "src")
+			Expect(err).ToNot(HaveOccurred())
+			rootfs, err = ioutil.TempDir("", "rootfs")
+			Expect(err).ToNot(HaveOccurred())
+			oldRootfs = config.LuetCfg.GetSystem().Rootfs
+			config.LuetCfg.GetSystem().Rootfs = rootfs
+		})
+
+		AfterEach(func() {
+			config.LuetCfg.GetSystem().Rootfs = oldRootfs
+			os.RemoveAll(src)
+			os.RemoveAll(rootfs)
+		})
+
+		a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+		b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+		b11 := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.1"}
+		c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+
+		It("Publishes deltas for the configured revisions", func() {
+			Expect(FakeRepository(src, 2, false, a)).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(src, "repository.delta-1.yaml.tar.gz"))).To(BeFalse())
+
+			Expect(FakeRepository(src, 2, false, a, b)).ToNot(HaveOccurred())
+			Expect(FakeRepository(src, 2, false, a, b11)).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(src, "repository.delta-2.yaml.tar.gz"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(src, "repository.delta-3.yaml.tar.gz"))).To(BeTrue())
+
+			Expect(FakeRepository(src, 2, false, a, b11, c)).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(src, "repository.delta-2.yaml.tar.gz"))).To(BeFalse())
+			Expect(helpers.Exists(filepath.Join(src, "repository.delta-4.yaml.tar.gz"))).To(BeTrue())
+
+			repo, err := LoadLocalRepository(src)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(repo.GetTreePath())
+			defer os.RemoveAll(repo.GetMetaPath())
+
+			_, err = repo.GetRepositoryFile(DeltaRepositoryFileKey(2))
+			Expect(err).To(HaveOccurred())
+			_, err = repo.GetRepositoryFile(DeltaRepositoryFileKey(3))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = repo.GetRepositoryFile(DeltaRepositoryFileKey(4))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("Syncs cached repositories with deltas", func() {
+			Expect(FakeRepository(src, 2, false, a, b)).ToNot(HaveOccurred())
+
+			r := NewSystemRepository(config.LuetRepository{
+				Name:   "deltatest",
+				Type:   "disk",
+				Urls:   []string{src},
+				Cached: true,
+				Enable: true,
+			})
+
+			repo, err := r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.GetRevision()).To(Equal(1))
+			Expect(len(repo.GetTree().GetDatabase().World())).To(Equal(2))
+
+			Expect(FakeRepository(src, 2, false, a, b11, c)).ToNot(HaveOccurred())
+			Expect(FakeRepository(src, 2, false, a, b11, c)).ToNot(HaveOccurred())
+
+			// Deltas are enough to update the repository, without the tree tarball
+			treeFile, err := repo.GetRepositoryFile(REPOFILE_TREE_KEY)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, treeFile.GetFileName()), []byte("corrupted"), 0644)).ToNot(HaveOccurred())
+
+			repo, err = r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.GetRevision()).To(Equal(3))
+			Expect(len(repo.GetIndex())).To(Equal(3))
+
+			db := repo.GetTree().GetDatabase()
+			Expect(len(db.World())).To(Equal(3))
+			_, err = db.FindPackage(b)
+			Expect(err).To(HaveOccurred())
+			_, err = db.FindPackage(b11)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = db.FindPackage(c)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("Falls back to a full sync when deltas come from a different history", func() {
+			Expect(FakeRepository(src, 2, false, a, b)).ToNot(HaveOccurred())
+
+			r := NewSystemRepository(config.LuetRepository{
+				Name:   "deltatest",
+				Type:   "disk",
+				Urls:   []string{src},
+				Cached: true,
+				Enable: true,
+			})
+
+			_, err := r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Regenerate the repository from scratch, as with --reset-revision
+			Expect(os.RemoveAll(src)).ToNot(HaveOccurred())
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(FakeRepository(src, 2, false, a)).ToNot(HaveOccurred())
+			Expect(FakeRepository(src, 2, false, a, c)).ToNot(HaveOccurred())
+			Expect(FakeRepository(src, 2, false, a, b11, c)).ToNot(HaveOccurred())
+
+			repo, err := r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.GetRevision()).To(Equal(3))
+
+			db := repo.GetTree().GetDatabase()
+			Expect(len(db.World())).To(Equal(3))
+			_, err = db.FindPackage(b)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Falls back to a full sync when deltas are missing", func() {
+			Expect(FakeRepository(src, 0, false, a)).ToNot(HaveOccurred())
+
+			r := NewSystemRepository(config.LuetRepository{
+				Name:   "deltatest",
+				Type:   "disk",
+				Urls:   []string{src},
+				Cached: true,
+				Enable: true,
+			})
+
+			_, err := r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(FakeRepository(src, 0, false, a, b)).ToNot(HaveOccurred())
+
+			repo, err := r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.GetRevision()).To(Equal(2))
+			Expect(len(repo.GetTree().GetDatabase().World())).To(Equal(2))
+		})
+
+		It("Syncs cached repositories with the compact tree", func() {
+			Expect(FakeRepository(src, 2, true, a, b)).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(src, tree.CompactTreeFile+".tar.gz"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(src, TREE_TARBALL+".gz"))).To(BeTrue())
+
+			r := NewSystemRepository(config.LuetRepository{
+				Name:   "deltatest",
+				Type:   "disk",
+				Urls:   []string{src},
+				Cached: true,
+				Enable: true,
+			})
+
+			repo, err := r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(repo.GetTreePath(), tree.CompactTreeFile))).To(BeTrue())
+			Expect(len(repo.GetTree().GetDatabase().World())).To(Equal(2))
+
+			Expect(FakeRepository(src, 2, true, a, b11, c)).ToNot(HaveOccurred())
+
+			repo, err = r.Sync(false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.GetRevision()).To(Equal(2))
+			Expect(helpers.Exists(filepath.Join(repo.GetTreePath(), tree.CompactTreeFile))).To(BeTrue())
+
+			db := repo.GetTree().GetDatabase()
+			Expect(len(db.World())).To(Equal(3))
+			_, err = db.FindPackage(b)
+			Expect(err).To(HaveOccurred())
+			_, err = db.FindPackage(b11)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
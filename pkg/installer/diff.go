@@ -0,0 +1,199 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/mudler/luet/pkg/compiler"
+	pkg "github.com/mudler/luet/pkg/package"
+	version "github.com/mudler/luet/pkg/versioner"
+)
+
+// PackageChange describes how a package differs between two repositories
+type PackageChange struct {
+	Package string `json:"package"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+
+	// Changes lists the fields of the definition which differ, and
+	// "checksum" if the artifact was rebuilt.
+	Changes []string `json:"changes,omitempty"`
+}
+
+// RepositoryDiff is the list of package changes between two repositories
+type RepositoryDiff struct {
+	OldRevision int `json:"old_revision"`
+	NewRevision int `json:"new_revision"`
+
+	Added      []PackageChange `json:"added,omitempty"`
+	Removed    []PackageChange `json:"removed,omitempty"`
+	Upgraded   []PackageChange `json:"upgraded,omitempty"`
+	Downgraded []PackageChange `json:"downgraded,omitempty"`
+	// Changed are the packages with the same version in both repositories,
+	// but a different definition or artifact.
+	Changed []PackageChange `json:"changed,omitempty"`
+}
+
+// Empty returns true if the repositories have the same packages
+func (d *RepositoryDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Upgraded)+len(d.Downgraded)+len(d.Changed) == 0
+}
+
+// DiffRepositories compares the packages of two repositories, from the
+// first to the second. Versions of a package found only in one of them are
+// paired from the highest, and reported as upgrades or downgrades; the
+// remaining ones are added or removed.
+func DiffRepositories(from, to Repository, v version.Versioner) *RepositoryDiff {
+	if v == nil {
+		v = version.DefaultVersioner()
+	}
+
+	diff := &RepositoryDiff{OldRevision: from.GetRevision(), NewRevision: to.GetRevision()}
+
+	oldPacks := packagesByName(from)
+	newPacks := packagesByName(to)
+	oldChecksums := checksumsByFingerprint(from)
+	newChecksums := checksumsByFingerprint(to)
+
+	names := []string{}
+	for n := range oldPacks {
+		names = append(names, n)
+	}
+	for n := range newPacks {
+		if _, ok := oldPacks[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldVersions, newVersions := oldPacks[name], newPacks[name]
+
+		var removed, added []string
+		for ver, p := range oldVersions {
+			n, ok := newVersions[ver]
+			if !ok {
+				removed = append(removed, ver)
+				continue
+			}
+			changes := definitionChanges(p, n)
+			if !reflect.DeepEqual(oldChecksums[p.GetFingerPrint()], newChecksums[n.GetFingerPrint()]) {
+				changes = append(changes, "checksum")
+			}
+			if len(changes) > 0 {
+				diff.Changed = append(diff.Changed, PackageChange{Package: name, Old: ver, New: ver, Changes: changes})
+			}
+		}
+		for ver := range newVersions {
+			if _, ok := oldVersions[ver]; !ok {
+				added = append(added, ver)
+			}
+		}
+
+		// Sorted from the highest version
+		removed = reverse(v.Sort(removed))
+		added = reverse(v.Sort(added))
+		for len(removed) > 0 && len(added) > 0 {
+			o, n := oldVersions[removed[0]], newVersions[added[0]]
+			c := PackageChange{Package: name, Old: o.GetVersion(), New: n.GetVersion(), Changes: definitionChanges(o, n)}
+			if v.ValidateSelector(n.GetVersion(), ">"+o.GetVersion()) {
+				diff.Upgraded = append(diff.Upgraded, c)
+			} else {
+				diff.Downgraded = append(diff.Downgraded, c)
+			}
+			removed, added = removed[1:], added[1:]
+		}
+		for _, ver := range removed {
+			diff.Removed = append(diff.Removed, PackageChange{Package: name, Old: ver})
+		}
+		for _, ver := range added {
+			diff.Added = append(diff.Added, PackageChange{Package: name, New: ver})
+		}
+	}
+
+	sort.SliceStable(diff.Changed, func(i, j int) bool {
+		if diff.Changed[i].Package != diff.Changed[j].Package {
+			return diff.Changed[i].Package < diff.Changed[j].Package
+		}
+		return diff.Changed[i].Old < diff.Changed[j].Old
+	})
+	return diff
+}
+
+func packagesByName(r Repository) map[string]map[string]pkg.Package {
+	ans := map[string]map[string]pkg.Package{}
+	for _, p := range r.GetTree().GetDatabase().World() {
+		if _, ok := ans[p.GetCategory()+"/"+p.GetName()]; !ok {
+			ans[p.GetCategory()+"/"+p.GetName()] = map[string]pkg.Package{}
+		}
+		ans[p.GetCategory()+"/"+p.GetName()][p.GetVersion()] = p
+	}
+	return ans
+}
+
+// checksumsByFingerprint returns the checksums of the artifacts of each
+// package, by artifact fingerprint (variant and architecture).
+func checksumsByFingerprint(r Repository) map[string]map[string]compiler.Checksums {
+	ans := map[string]map[string]compiler.Checksums{}
+	for _, a := range r.GetIndex() {
+		if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+			continue
+		}
+		p := a.GetCompileSpec().GetPackage()
+		if _, ok := ans[p.GetFingerPrint()]; !ok {
+			ans[p.GetFingerPrint()] = map[string]compiler.Checksums{}
+		}
+		ans[p.GetFingerPrint()][p.GetArtifactFingerPrint()] = a.GetChecksums()
+	}
+	return ans
+}
+
+// definitionChanges returns the names of the definition fields which differ
+func definitionChanges(o, n pkg.Package) []string {
+	var ans []string
+	if !reflect.DeepEqual(packageStrings(o.GetRequires()), packageStrings(n.GetRequires())) {
+		ans = append(ans, "requires")
+	}
+	if !reflect.DeepEqual(packageStrings(o.GetConflicts()), packageStrings(n.GetConflicts())) {
+		ans = append(ans, "conflicts")
+	}
+	if !reflect.DeepEqual(packageStrings(o.GetProvides()), packageStrings(n.GetProvides())) {
+		ans = append(ans, "provides")
+	}
+	if len(o.GetLabels())+len(n.GetLabels()) > 0 && !reflect.DeepEqual(o.GetLabels(), n.GetLabels()) {
+		ans = append(ans, "labels")
+	}
+	return ans
+}
+
+func packageStrings(packs []*pkg.DefaultPackage) []string {
+	ans := []string{}
+	for _, p := range packs {
+		ans = append(ans, p.HumanReadableString())
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+func reverse(s []string) []string {
+	ans := make([]string, len(s))
+	for i := range s {
+		ans[len(s)-1-i] = s[i]
+	}
+	return ans
+}
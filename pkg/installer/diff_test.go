@@ -0,0 +1,92 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repository diff", func() {
+	var oldDir, newDir string
+
+	generate := func(dir string, packs ...*pkg.DefaultPackage) Repository {
+		treeDir, err := ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(treeDir)
+
+		db := pkg.NewInMemoryDatabase(false)
+		for _, p := range packs {
+			_, err := db.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(FakeArtifact(dir, p)).ToNot(HaveOccurred())
+		}
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		repo, err := GenerateRepository("test", "description", "disk", []string{dir}, 1, dir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		return repo
+	}
+
+	BeforeEach(func() {
+		var err error
+		oldDir, err = ioutil.TempDir("", "old")
+		Expect(err).ToNot(HaveOccurred())
+		newDir, err = ioutil.TempDir("", "new")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(oldDir)
+		os.RemoveAll(newDir)
+	})
+
+	It("Reports the package changes", func() {
+		oldRepo := generate(oldDir,
+			&pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"},
+			&pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"},
+			&pkg.DefaultPackage{Name: "c", Category: "test", Version: "2.0"},
+			&pkg.DefaultPackage{Name: "d", Category: "test", Version: "1.0"},
+		)
+		newRepo := generate(newDir,
+			&pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.1"},
+			&pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"},
+			&pkg.DefaultPackage{Name: "d", Category: "test", Version: "1.0",
+				PackageRequires: []*pkg.DefaultPackage{{Name: "a", Category: "test", Version: ">=1.1"}}},
+			&pkg.DefaultPackage{Name: "e", Category: "test", Version: "1.0"},
+		)
+
+		diff := DiffRepositories(oldRepo, newRepo, nil)
+		Expect(diff.Upgraded).To(Equal([]PackageChange{{Package: "test/a", Old: "1.0", New: "1.1"}}))
+		Expect(diff.Downgraded).To(Equal([]PackageChange{{Package: "test/c", Old: "2.0", New: "1.0"}}))
+		Expect(diff.Removed).To(Equal([]PackageChange{{Package: "test/b", Old: "1.0"}}))
+		Expect(diff.Added).To(Equal([]PackageChange{{Package: "test/e", New: "1.0"}}))
+		Expect(len(diff.Changed)).To(Equal(1))
+		Expect(diff.Changed[0].Package).To(Equal("test/d"))
+		// Artifacts are rebuilt, so checksums might differ too
+		Expect(diff.Changed[0].Changes).To(ContainElement("requires"))
+		Expect(diff.Empty()).To(BeFalse())
+
+		Expect(DiffRepositories(newRepo, newRepo, nil).Empty()).To(BeTrue())
+	})
+})
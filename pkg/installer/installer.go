@@ -29,9 +29,11 @@ import (
 	compiler "github.com/mudler/luet/pkg/compiler"
 	"github.com/mudler/luet/pkg/config"
 	"github.com/mudler/luet/pkg/helpers"
+	"github.com/mudler/luet/pkg/license"
 	. "github.com/mudler/luet/pkg/logger"
 	pkg "github.com/mudler/luet/pkg/package"
 	"github.com/mudler/luet/pkg/solver"
+	tree "github.com/mudler/luet/pkg/tree"
 
 	"github.com/pkg/errors"
 )
@@ -146,6 +148,8 @@ func (l *LuetInstaller) Upgrade(s *System) error {
 		return err
 	}
 
+	l.showUnreadNews(syncedRepos, s)
+
 	Info(":thinking: Computing upgrade, please hang tight... :zzz:")
 	if l.Options.UpgradeNewRevisions {
 		Info(":memo: note: will consider new build revisions while upgrading")
@@ -186,6 +190,25 @@ func (l *LuetInstaller) Upgrade(s *System) error {
 	return l.swap(syncedRepos, uninstall, toInstall, s, true)
 }
 
+// showUnreadNews prints the unread news items relevant for the installed packages
+func (l *LuetInstaller) showUnreadNews(repos Repositories, s *System) {
+	installed, err := s.World()
+	if err != nil {
+		return
+	}
+	state, err := LoadNewsState()
+	if err != nil {
+		Warning("Failed reading news state:", err.Error())
+		return
+	}
+	for _, m := range repos.SearchNews(installed, state) {
+		if m.Read {
+			continue
+		}
+		Warning(":newspaper: Unread news from", m.Repository+":", m.Item.Date, m.Item.Title, "- run 'luet news read "+m.Item.ID+"'")
+	}
+}
+
 func (l *LuetInstaller) SyncRepositories(inMemory bool) (Repositories, error) {
 	Spinner(32)
 	defer SpinnerStop()
@@ -279,6 +302,10 @@ func (l *LuetInstaller) swap(syncedRepos Repositories, toRemove pkg.Packages, to
 		return errors.Wrap(err, "failed computing package replacement")
 	}
 
+	if err := checkLicenses(match); err != nil {
+		return err
+	}
+
 	if l.Options.Ask {
 		if len(toRemove) > 0 {
 			Info(":recycle: Packages that are going to be removed from the system:\n ", Yellow(packsToList(toRemove)).BgBlack().String())
@@ -351,6 +378,10 @@ func (l *LuetInstaller) Install(cp pkg.Packages, s *System) error {
 	}
 	Info("Packages that are going to be installed in the system: \n ", Green(matchesToList(match)).BgBlack().String())
 
+	if err := checkLicenses(match); err != nil {
+		return err
+	}
+
 	if l.Options.Ask {
 		Info("By going forward, you are also accepting the licenses of the packages that you are going to install in your system.")
 		if Ask() {
@@ -363,6 +394,15 @@ func (l *LuetInstaller) Install(cp pkg.Packages, s *System) error {
 	return l.install(syncedRepos, match, packages, assertions, allRepos, s)
 }
 
+// checkLicenses enforces the license policy on the packages going to be installed
+func checkLicenses(match map[string]ArtifactMatch) error {
+	var packs pkg.Packages
+	for _, m := range match {
+		packs = append(packs, m.Package)
+	}
+	return license.NewPolicy(config.LuetCfg.GetLicensePolicy()).Enforce(packs)
+}
+
 func (l *LuetInstaller) download(syncedRepos Repositories, toDownload map[string]ArtifactMatch) error {
 
 	// Download packages into cache in parallel.
@@ -435,6 +475,25 @@ func (l *LuetInstaller) Reclaim(s *System) error {
 	return nil
 }
 
+// installedInSlot returns the installed versions of the package in the slot it
+// would be installed in, which is the requested one or the one of its candidate
+// in the repositories. Versions in other slots can be installed side by side.
+func installedInSlot(repos Repositories, p pkg.Package, s *System) pkg.Packages {
+	vers, _ := s.Database.FindPackageVersions(p)
+	if p.GetSlot() != "" {
+		return vers.InSlot(p.GetSlot())
+	}
+
+	sort.Sort(repos) // respect prio
+	for _, r := range repos {
+		c, err := r.GetTree().GetDatabase().FindPackageCandidate(p)
+		if err == nil {
+			return vers.InSlot(c.GetSlot())
+		}
+	}
+	return vers
+}
+
 func (l *LuetInstaller) computeInstall(syncedRepos Repositories, cp pkg.Packages, s *System) (map[string]ArtifactMatch, pkg.Packages, solver.PackagesAssertions, pkg.PackageDatabase, error) {
 	var p pkg.Packages
 	toInstall := map[string]ArtifactMatch{}
@@ -443,7 +502,7 @@ func (l *LuetInstaller) computeInstall(syncedRepos Repositories, cp pkg.Packages
 
 	// Check if the package is installed first
 	for _, pi := range cp {
-		vers, _ := s.Database.FindPackageVersions(pi)
+		vers := installedInSlot(syncedRepos, pi, s)
 
 		if len(vers) >= 1 {
 			//	Warning("Filtering out package " + pi.HumanReadableString() + ", it has other versions already installed. Uninstall one of them first ")
@@ -509,6 +568,8 @@ func (l *LuetInstaller) computeInstall(syncedRepos Repositories, cp pkg.Packages
 			}
 			if matches[0].Package.Matches(artefact.GetCompileSpec().GetPackage()) {
 				currentPack.SetBuildTimestamp(artefact.GetCompileSpec().GetPackage().GetBuildTimestamp())
+				currentPack.SetArch(artefact.GetCompileSpec().GetPackage().GetArch())
+				currentPack.SetVariant(artefact.GetCompileSpec().GetPackage().GetVariant())
 				// Filter out already installed
 				if _, err := s.Database.FindPackage(currentPack); err != nil {
 					toInstall[currentPack.GetFingerPrint()] = ArtifactMatch{Package: currentPack, Artifact: artefact, Repository: matches[0].Repo}
@@ -526,6 +587,12 @@ func (l *LuetInstaller) install(syncedRepos Repositories, toInstall map[string]A
 		return errors.Wrap(err, "Downloading packages")
 	}
 
+	for _, c := range toInstall {
+		if err := l.checkSlotCollisions(c, s); err != nil && !l.Options.Force {
+			return err
+		}
+	}
+
 	all := make(chan ArtifactMatch)
 
 	wg := new(sync.WaitGroup)
@@ -571,6 +638,10 @@ func (l *LuetInstaller) install(syncedRepos Repositories, toInstall map[string]A
 					if err != nil {
 						return errors.Wrap(err, "Error getting package "+ass.Package.HumanReadableString())
 					}
+					err = writeFinalizer(installed.Repository, treePackage)
+					if err != nil {
+						return err
+					}
 
 					toFinalize = append(toFinalize, treePackage)
 				}
@@ -583,6 +654,10 @@ func (l *LuetInstaller) install(syncedRepos Repositories, toInstall map[string]A
 			if err != nil {
 				return errors.Wrap(err, "Error getting package "+c.Package.HumanReadableString())
 			}
+			err = writeFinalizer(c.Repository, treePackage)
+			if err != nil {
+				return err
+			}
 			toFinalize = append(toFinalize, treePackage)
 		}
 	}
@@ -590,6 +665,20 @@ func (l *LuetInstaller) install(syncedRepos Repositories, toInstall map[string]A
 	return s.ExecuteFinalizers(toFinalize)
 }
 
+// writeFinalizer makes the finalizer of a package available along its definition,
+// as trees loaded in the compact format write them only once requested.
+func writeFinalizer(r Repository, p pkg.Package) error {
+	recipe, ok := r.GetTree().(*tree.InstallerRecipe)
+	if !ok {
+		return nil
+	}
+	_, err := recipe.Finalizer(p)
+	if err != nil {
+		return errors.Wrap(err, "Error writing finalizer of "+p.HumanReadableString())
+	}
+	return nil
+}
+
 func (l *LuetInstaller) downloadPackage(a ArtifactMatch) (compiler.Artifact, error) {
 
 	artifact, err := a.Repository.Client().DownloadArtifact(a.Artifact)
@@ -626,6 +715,49 @@ func (l *LuetInstaller) installPackage(a ArtifactMatch, s *System) error {
 	return s.Database.SetPackageFiles(&pkg.PackageFile{PackageFingerprint: a.Package.GetFingerPrint(), Files: files})
 }
 
+// checkSlotCollisions returns an error if any of the files of the package is
+// already installed by a version of it in another slot. Directories can be
+// shared.
+func (l *LuetInstaller) checkSlotCollisions(a ArtifactMatch, s *System) error {
+	installed, _ := s.Database.FindPackageVersions(a.Package)
+	owners := map[string]pkg.Package{}
+	for _, i := range installed {
+		if i.GetSlot() == a.Package.GetSlot() {
+			continue
+		}
+		files, err := s.Database.GetPackageFiles(i)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			owners[f] = i
+		}
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+
+	artifact, err := l.downloadPackage(a)
+	if err != nil {
+		return errors.Wrap(err, "Failed downloading package")
+	}
+	files, err := artifact.FileList()
+	if err != nil {
+		return errors.Wrap(err, "Could not open package archive")
+	}
+	for _, f := range files {
+		owner, ok := owners[f]
+		if !ok {
+			continue
+		}
+		if fi, err := os.Lstat(filepath.Join(s.Target, f)); err == nil && fi.IsDir() {
+			continue
+		}
+		return errors.New("File " + f + " of " + a.Package.HumanReadableString() + " collides with " + owner.HumanReadableString() + " in slot '" + owner.GetSlot() + "'")
+	}
+	return nil
+}
+
 func (l *LuetInstaller) downloadWorker(i int, wg *sync.WaitGroup, c <-chan ArtifactMatch) error {
 	defer wg.Done()
 
@@ -53,6 +53,7 @@ type Repository interface {
 	SetTree(tree.Builder)
 	Write(path string, resetRevision bool) error
 	Sync(bool) (Repository, error)
+	SyncAll(bool) (Repository, error)
 	GetTreePath() string
 	SetTreePath(string)
 	GetMetaPath() string
@@ -70,6 +71,12 @@ type Repository interface {
 	SetPriority(int)
 	GetRepositoryFile(string) (LuetRepositoryFile, error)
 	SetRepositoryFile(string, LuetRepositoryFile)
+	GetDeltaRevisions() int
+	SetDeltaRevisions(int)
+	GetAdvisories() Advisories
+	SetAdvisories(Advisories)
+	GetNews() News
+	SetNews(News)
 	SetName(p string)
 	Serialize() (*LuetSystemRepositoryMetadata, LuetSystemRepositorySerialized)
 }
@@ -0,0 +1,227 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+	version "github.com/mudler/luet/pkg/versioner"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+const (
+	REPOSITORY_NEWSFILE = "repository.news.yaml"
+	REPOFILE_NEWS_KEY   = "news"
+
+	// NewsDir is the folder of a tree holding the news items, one per file
+	NewsDir = "news"
+
+	// NewsStateFile keeps track of the news already read, in the system database folder
+	NewsStateFile = "news.read.yaml"
+
+	newsDateFormat = "2006-01-02"
+)
+
+// NewsItem is an announcement of the repository maintainers
+type NewsItem struct {
+	ID    string `json:"id"`
+	Date  string `json:"date"`
+	Title string `json:"title"`
+	Body  string `json:"body,omitempty"`
+
+	// Affected are the package selectors the item is relevant for.
+	// Items without affected packages are relevant for everyone.
+	Affected []*pkg.DefaultPackage `json:"affected,omitempty"`
+}
+
+type News []*NewsItem
+
+// NewsMatch is a news item along with the repository publishing it
+type NewsMatch struct {
+	Repository string
+	Item       *NewsItem
+	Read       bool
+}
+
+// NewsState holds the news items read, by repository
+type NewsState struct {
+	Read map[string][]string `json:"read"`
+
+	file string
+}
+
+func NewDefaultNewsRepositoryFile() LuetRepositoryFile {
+	return LuetRepositoryFile{
+		FileName:        REPOSITORY_NEWSFILE + ".tar",
+		CompressionType: compiler.GZip,
+	}
+}
+
+// LoadNewsDir reads the news yaml files in the given directory
+func LoadNewsDir(dir string) (News, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := News{}
+	for _, f := range files {
+		if f.IsDir() || !(strings.HasSuffix(f.Name(), ".yaml") || strings.HasSuffix(f.Name(), ".yml")) {
+			continue
+		}
+		dat, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading file "+f.Name())
+		}
+		n := &NewsItem{}
+		err = yaml.Unmarshal(dat, n)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading news item "+f.Name())
+		}
+		if n.ID == "" || n.Title == "" {
+			return nil, errors.New("News item " + f.Name() + " must have an id and a title")
+		}
+		if _, err := time.Parse(newsDateFormat, n.Date); err != nil {
+			return nil, errors.Wrap(err, "Invalid date of news item "+n.ID)
+		}
+		ans = append(ans, n)
+	}
+	return ans, ans.Validate()
+}
+
+func NewNewsFromFile(file string) (News, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ans := News{}
+	err = yaml.Unmarshal(dat, &ans)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading news "+file)
+	}
+	return ans, nil
+}
+
+func (n News) WriteFile(file string) error {
+	data, err := yaml.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, os.ModePerm)
+}
+
+// Validate checks that news ids are unique
+func (n News) Validate() error {
+	ids := map[string]bool{}
+	for _, item := range n {
+		if ids[item.ID] {
+			return errors.New("Duplicate news item " + item.ID)
+		}
+		ids[item.ID] = true
+	}
+	return nil
+}
+
+// Relevant returns true if the item concerns any of the packages
+func (n *NewsItem) Relevant(packs pkg.Packages, v version.Versioner) bool {
+	if len(n.Affected) == 0 {
+		return true
+	}
+	for _, p := range packs {
+		if matchSelectors(n.Affected, p, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchNews returns the news items of the repositories, newest first.
+// If installed is not nil, only the items relevant for the installed packages
+// are returned.
+func (re Repositories) SearchNews(installed pkg.Packages, state *NewsState) []NewsMatch {
+	v := version.DefaultVersioner()
+
+	ans := []NewsMatch{}
+	for _, r := range re {
+		for _, item := range r.GetNews() {
+			if installed != nil && !item.Relevant(installed, v) {
+				continue
+			}
+			ans = append(ans, NewsMatch{Repository: r.GetName(), Item: item, Read: state.IsRead(r.GetName(), item.ID)})
+		}
+	}
+
+	sort.SliceStable(ans, func(i, j int) bool {
+		return ans[i].Item.Date > ans[j].Item.Date
+	})
+	return ans
+}
+
+// LoadNewsState reads the news read from the system database folder
+func LoadNewsState() (*NewsState, error) {
+	file := filepath.Join(config.LuetCfg.GetSystem().GetSystemRepoDatabaseDirPath(), NewsStateFile)
+	s := &NewsState{Read: map[string][]string{}, file: file}
+	if !helpers.Exists(file) {
+		return s, nil
+	}
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(dat, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading "+file)
+	}
+	if s.Read == nil {
+		s.Read = map[string][]string{}
+	}
+	return s, nil
+}
+
+func (s *NewsState) IsRead(repo, id string) bool {
+	for _, r := range s.Read[repo] {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *NewsState) MarkRead(repo, id string) {
+	if !s.IsRead(repo, id) {
+		s.Read[repo] = append(s.Read[repo], id)
+	}
+}
+
+func (s *NewsState) Save() error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.file, data, 0644)
+}
@@ -0,0 +1,146 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const testNewsMigration = `
+id: 2020-10-01-a-migration
+date: "2020-10-01"
+title: a 2.0 needs a manual migration
+body: Run a-migrate after upgrading.
+affected:
+- category: test
+  name: a
+  version: ">=2.0"
+`
+
+const testNewsGeneral = `
+id: 2020-11-01-mirrors
+date: "2020-11-01"
+title: New mirrors available
+`
+
+var _ = Describe("News", func() {
+	var treeDir, repoDir string
+
+	a1 := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+	a2 := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "2.0"}
+
+	BeforeEach(func() {
+		var err error
+		treeDir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+
+		db := pkg.NewInMemoryDatabase(false)
+		_, err = db.CreatePackage(a2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(FakeArtifact(repoDir, a2)).ToNot(HaveOccurred())
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(treeDir, NewsDir), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(treeDir, NewsDir, "migration.yaml"), []byte(testNewsMigration), 0644)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(treeDir, NewsDir, "mirrors.yaml"), []byte(testNewsGeneral), 0644)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(treeDir)
+		os.RemoveAll(repoDir)
+	})
+
+	It("Are shipped with the repository", func() {
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(repo.GetNews())).To(Equal(2))
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+
+		local, err := LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(local.GetTreePath())
+		defer os.RemoveAll(local.GetMetaPath())
+		Expect(len(local.GetNews())).To(Equal(2))
+
+		r := NewSystemRepository(config.LuetRepository{
+			Name:   "news",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})
+		synced, err := r.Sync(false)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(synced.GetTreePath())
+		defer os.RemoveAll(synced.GetMetaPath())
+		Expect(len(synced.GetNews())).To(Equal(2))
+	})
+
+	It("Rejects items without a valid date", func() {
+		Expect(ioutil.WriteFile(filepath.Join(treeDir, NewsDir, "broken.yaml"), []byte("id: broken\ntitle: Broken\ndate: yesterday\n"), 0644)).ToNot(HaveOccurred())
+		_, err := LoadNewsDir(filepath.Join(treeDir, NewsDir))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Filters the items relevant for the installed packages", func() {
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+
+		dbDir, err := ioutil.TempDir("", "system")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dbDir)
+		oldRootfs, oldDatabasePath := config.LuetCfg.GetSystem().Rootfs, config.LuetCfg.GetSystem().DatabasePath
+		config.LuetCfg.GetSystem().Rootfs = dbDir
+		config.LuetCfg.GetSystem().DatabasePath = "db"
+		defer func() {
+			config.LuetCfg.GetSystem().Rootfs = oldRootfs
+			config.LuetCfg.GetSystem().DatabasePath = oldDatabasePath
+		}()
+
+		state, err := LoadNewsState()
+		Expect(err).ToNot(HaveOccurred())
+
+		matches := Repositories{repo}.SearchNews(pkg.Packages{a1}, state)
+		Expect(len(matches)).To(Equal(1))
+		Expect(matches[0].Item.ID).To(Equal("2020-11-01-mirrors"))
+
+		matches = Repositories{repo}.SearchNews(pkg.Packages{a2}, state)
+		Expect(len(matches)).To(Equal(2))
+		Expect(matches[0].Item.ID).To(Equal("2020-11-01-mirrors"))
+		Expect(matches[0].Read).To(BeFalse())
+
+		state.MarkRead("test", "2020-11-01-mirrors")
+		Expect(state.Save()).ToNot(HaveOccurred())
+
+		state, err = LoadNewsState()
+		Expect(err).ToNot(HaveOccurred())
+		matches = Repositories{repo}.SearchNews(nil, state)
+		Expect(len(matches)).To(Equal(2))
+		Expect(matches[0].Read).To(BeTrue())
+		Expect(matches[1].Read).To(BeFalse())
+	})
+})
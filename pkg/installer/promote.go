@@ -0,0 +1,272 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+	tree "github.com/mudler/luet/pkg/tree"
+
+	"github.com/pkg/errors"
+)
+
+type PromoteOptions struct {
+	// TreePath is the definition tree of the destination repository.
+	// If empty, the tree shipped with the destination repository is used.
+	TreePath string
+
+	SolverOptions solver.Options
+}
+
+// PromotePackages copies the artifacts of the given packages, along with their
+// runtime dependencies, from the repository in the src directory to the
+// one in dst. The definitions are copied into the destination tree, and the
+// destination repository is regenerated with a new revision.
+func PromotePackages(src, dst string, packs pkg.Packages, o PromoteOptions) (pkg.Packages, error) {
+	from, err := LoadLocalRepository(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "While loading repository from "+src)
+	}
+	defer os.RemoveAll(from.GetTreePath())
+	defer os.RemoveAll(from.GetMetaPath())
+
+	var to Repository
+	if helpers.Exists(filepath.Join(dst, REPOSITORY_SPECFILE)) {
+		to, err = LoadLocalRepository(dst)
+		if err != nil {
+			return nil, errors.Wrap(err, "While loading repository from "+dst)
+		}
+		defer os.RemoveAll(to.GetTreePath())
+		defer os.RemoveAll(to.GetMetaPath())
+	}
+
+	toPromote, err := promotionClosure(from, packs, o.SolverOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	treePath := o.TreePath
+	if treePath != "" && to != nil {
+		err = checkTreeCoverage(to, toPromote, treePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if treePath == "" {
+		treePath, err = config.LuetCfg.GetSystem().TempDir("promote")
+		if err != nil {
+			return nil, errors.Wrap(err, "Error met while creating tempdir for tree")
+		}
+		defer os.RemoveAll(treePath)
+		if to != nil {
+			err = helpers.CopyDir(to.GetTreePath(), treePath)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error met while copying destination tree")
+			}
+		}
+	}
+
+	err = os.MkdirAll(dst, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = promoteDefinitions(toPromote, treePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = promoteArtifacts(from, toPromote, src, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	// The destination repository keeps its own attributes, if any
+	settings := from
+	if to != nil {
+		settings = to
+	}
+	repo, err := GenerateRepository(
+		settings.GetName(),
+		settings.GetDescription(),
+		settings.GetType(),
+		settings.GetUrls(),
+		settings.GetPriority(),
+		dst,
+		[]string{treePath},
+		pkg.NewInMemoryDatabase(false))
+	if err != nil {
+		return nil, errors.Wrap(err, "While generating repository in "+dst)
+	}
+
+	inheritRepositoryFiles(settings, repo)
+	if len(repo.GetAdvisories()) == 0 && to != nil {
+		repo.SetAdvisories(to.GetAdvisories())
+	}
+	if len(repo.GetNews()) == 0 && to != nil {
+		repo.SetNews(to.GetNews())
+	}
+
+	// Keep publishing deltas if the repository had them
+	repo.SetDeltaRevisions(settings.GetDeltaRevisions())
+
+	err = repo.Write(dst, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPromote, nil
+}
+
+// promotionClosure returns the packages matching the given selectors in the
+// repository, together with their runtime dependencies.
+func promotionClosure(r Repository, packs pkg.Packages, o solver.Options) (pkg.Packages, error) {
+	db := r.GetTree().GetDatabase()
+
+	var targets pkg.Packages
+	for _, p := range packs {
+		var match pkg.Package
+		var err error
+		if p.IsSelector() {
+			match, err = db.FindPackageCandidate(p)
+		} else {
+			match, err = db.FindPackage(p)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Package "+p.HumanReadableString()+" not found in repository "+r.GetName())
+		}
+		targets = append(targets, match)
+	}
+
+	s := solver.NewSolver(o, pkg.NewInMemoryDatabase(false), db, pkg.NewInMemoryDatabase(false))
+	solution, err := s.Install(targets)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed computing dependencies")
+	}
+
+	var ans pkg.Packages
+	for _, assertion := range solution {
+		if assertion.Value {
+			ans = append(ans, assertion.Package)
+		}
+	}
+	return ans, nil
+}
+
+// checkTreeCoverage ensures that the packages already in the destination
+// repository are defined in the given tree, or are being promoted. Otherwise
+// the regenerated repository would silently drop them.
+func checkTreeCoverage(to Repository, packs pkg.Packages, treePath string) error {
+	reciper := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+	if helpers.Exists(treePath) {
+		err := reciper.Load(treePath)
+		if err != nil {
+			return errors.Wrap(err, "Error met while loading tree "+treePath)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, p := range packs {
+		seen[p.GetFingerPrint()] = true
+	}
+
+	var missing []string
+	for _, a := range to.GetIndex() {
+		p := a.GetCompileSpec().GetPackage()
+		if seen[p.GetFingerPrint()] {
+			continue
+		}
+		seen[p.GetFingerPrint()] = true
+		if _, err := reciper.GetDatabase().FindPackage(p); err != nil {
+			missing = append(missing, p.HumanReadableString())
+		}
+	}
+	if len(missing) != 0 {
+		return errors.New("Tree " + treePath + " lacks packages of the destination repository: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// promoteDefinitions copies the definition of the packages into the tree.
+// Packages already present in the tree are updated in place.
+func promoteDefinitions(packs pkg.Packages, treePath string) error {
+	reciper := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+	if helpers.Exists(treePath) {
+		err := reciper.Load(treePath)
+		if err != nil {
+			return errors.Wrap(err, "Error met while loading tree "+treePath)
+		}
+	}
+
+	for _, p := range packs {
+		dir := filepath.Join(treePath, p.GetCategory(), p.GetName(), p.GetVersion())
+		if existing, err := reciper.GetDatabase().FindPackage(p); err == nil && existing.GetPath() != "" {
+			dir = existing.GetPath()
+		}
+
+		Debug("Copying definition of", p.HumanReadableString(), "to", dir)
+		err := helpers.CopyDir(p.GetPath(), dir)
+		if err != nil {
+			return errors.Wrap(err, "Error met while copying definition of "+p.HumanReadableString())
+		}
+	}
+	return nil
+}
+
+// promoteArtifacts copies the package artifacts and their metadata files
+// from the src repository folder to dst, for all the architectures available.
+func promoteArtifacts(r Repository, packs pkg.Packages, src, dst string) error {
+	index := map[string][]compiler.Artifact{}
+	for _, a := range r.GetIndex() {
+		fp := a.GetCompileSpec().GetPackage().GetFingerPrint()
+		index[fp] = append(index[fp], a)
+	}
+
+	for _, p := range packs {
+		artifacts, ok := index[p.GetFingerPrint()]
+		if !ok {
+			return errors.New("No artifact found for " + p.HumanReadableString() + " in repository " + r.GetName())
+		}
+
+		for _, a := range artifacts {
+			files := []string{path.Base(a.GetPath()), a.GetCompileSpec().GetPackage().GetArtifactFingerPrint() + ".metadata.yaml"}
+			provenance, err := provenanceFileName(a)
+			if err != nil {
+				return err
+			}
+			if provenance != "" {
+				files = append(files, provenance)
+			}
+			for _, f := range files {
+				Info("Promoting", f)
+				err := helpers.CopyFile(filepath.Join(src, f), filepath.Join(dst, f))
+				if err != nil {
+					return errors.Wrap(err, "Error met while copying "+f)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/solver"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Promote", func() {
+	Context("Between local repositories", func() {
+		It("Copies packages with their runtime dependencies", func() {
+			src, err := ioutil.TempDir("", "src")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(src)
+			dst, err := ioutil.TempDir("", "dst")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dst)
+
+			b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+			a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0",
+				PackageRequires: []*pkg.DefaultPackage{{Name: "b", Category: "test", Version: ">=1.0"}}}
+			c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+			Expect(FakeRepository(src, 0, false, a, b, c)).ToNot(HaveOccurred())
+
+			promoted, err := PromotePackages(src, dst, pkg.Packages{&pkg.DefaultPackage{Name: "a", Category: "test", Version: ">=0"}},
+				PromoteOptions{SolverOptions: solver.Options{Type: solver.SingleCoreSimple}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(promoted)).To(Equal(2))
+
+			Expect(helpers.Exists(filepath.Join(dst, "a-test-1.0.package.tar"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(dst, "a-test-1.0.metadata.yaml"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(dst, "b-test-1.0.package.tar"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(dst, "b-test-1.0.metadata.yaml"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(dst, "c-test-1.0.package.tar"))).To(BeFalse())
+
+			repo, err := LoadLocalRepository(dst)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(repo.GetTreePath())
+			defer os.RemoveAll(repo.GetMetaPath())
+			Expect(repo.GetRevision()).To(Equal(1))
+			Expect(len(repo.GetIndex())).To(Equal(2))
+			Expect(len(repo.GetTree().GetDatabase().World())).To(Equal(2))
+
+			_, err = PromotePackages(src, dst, pkg.Packages{c},
+				PromoteOptions{SolverOptions: solver.Options{Type: solver.SingleCoreSimple}})
+			Expect(err).ToNot(HaveOccurred())
+
+			repo, err = LoadLocalRepository(dst)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(repo.GetTreePath())
+			defer os.RemoveAll(repo.GetMetaPath())
+			Expect(repo.GetRevision()).To(Equal(2))
+			Expect(len(repo.GetIndex())).To(Equal(3))
+			Expect(len(repo.GetTree().GetDatabase().World())).To(Equal(3))
+			Expect(helpers.Exists(filepath.Join(dst, TREE_TARBALL+".gz"))).To(BeTrue())
+		})
+
+		It("Keeps the deltas of the destination repository", func() {
+			src, err := ioutil.TempDir("", "src")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(src)
+			dst, err := ioutil.TempDir("", "dst")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dst)
+
+			a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+			b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+			Expect(FakeRepository(src, 0, false, b)).ToNot(HaveOccurred())
+			Expect(FakeRepository(dst, 2, false, a)).ToNot(HaveOccurred())
+
+			_, err = PromotePackages(src, dst, pkg.Packages{b},
+				PromoteOptions{SolverOptions: solver.Options{Type: solver.SingleCoreSimple}})
+			Expect(err).ToNot(HaveOccurred())
+
+			repo, err := LoadLocalRepository(dst)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(repo.GetTreePath())
+			defer os.RemoveAll(repo.GetMetaPath())
+			Expect(repo.GetRevision()).To(Equal(2))
+			Expect(repo.GetDeltaRevisions()).To(Equal(2))
+			deltaFile, err := repo.GetRepositoryFile(DeltaRepositoryFileKey(2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(dst, deltaFile.GetFileName()))).To(BeTrue())
+		})
+
+		It("Fails when the tree lacks packages of the destination repository", func() {
+			src, err := ioutil.TempDir("", "src")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(src)
+			dst, err := ioutil.TempDir("", "dst")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dst)
+			treePath, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(treePath)
+
+			a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+			c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+			Expect(FakeRepository(src, 0, false, a, c)).ToNot(HaveOccurred())
+
+			_, err = PromotePackages(src, dst, pkg.Packages{a},
+				PromoteOptions{SolverOptions: solver.Options{Type: solver.SingleCoreSimple}})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = PromotePackages(src, dst, pkg.Packages{c},
+				PromoteOptions{TreePath: treePath, SolverOptions: solver.Options{Type: solver.SingleCoreSimple}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test/a-1.0"))
+			Expect(helpers.Exists(filepath.Join(dst, "c-test-1.0.package.tar"))).To(BeFalse())
+		})
+
+		It("Fails for packages not in the source repository", func() {
+			src, err := ioutil.TempDir("", "src")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(src)
+			dst, err := ioutil.TempDir("", "dst")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dst)
+
+			Expect(FakeRepository(src, 0, false, &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"})).ToNot(HaveOccurred())
+
+			_, err = PromotePackages(src, dst, pkg.Packages{&pkg.DefaultPackage{Name: "a", Category: "test", Version: ">=0"}},
+				PromoteOptions{SolverOptions: solver.Options{Type: solver.SingleCoreSimple}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
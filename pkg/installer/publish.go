@@ -0,0 +1,264 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+	tree "github.com/mudler/luet/pkg/tree"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	REPOSITORY_LOCKFILE = ".repository.lock"
+)
+
+// PublishArtifact adds the artifact described by the metadata file to the
+// repository in dir. The artifact checksums are validated before placing the
+// files, and the repository index and tree are updated from the ones already
+// published, without walking all the artifacts again.
+// The provenance document referenced by the metadata is read from
+// provenanceFile, or from the folder of the metadata file if empty.
+// The package is added to the repository tree from definitionFile, its
+// definition in the source tree, as the package in the metadata carries the
+// build dependencies. If empty, the package must already be in the tree.
+// Concurrent publishes to the same repository are serialized with a lock file.
+func PublishArtifact(dir, artifactFile, metadataFile, provenanceFile, definitionFile string) (compiler.Artifact, error) {
+	dat, err := ioutil.ReadFile(metadataFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading file "+metadataFile)
+	}
+	a, err := compiler.NewPackageArtifactFromYaml(dat)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading yaml "+metadataFile)
+	}
+	if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+		return nil, errors.New("No package found in " + metadataFile)
+	}
+	p := a.GetCompileSpec().GetPackage()
+
+	// The artifact name is not trusted, as it would let it replace any file
+	// of the repository
+	name := p.GetArtifactFingerPrint() + ".package.tar" + a.GetCompressionType().Extension()
+	if path.Base(a.GetPath()) != name {
+		return nil, errors.New("Artifact path in " + metadataFile + " doesn't match " + name)
+	}
+
+	if len(a.GetChecksums()) == 0 {
+		return nil, errors.New("No checksums found in " + metadataFile)
+	}
+
+	a.SetPath(artifactFile)
+	err = a.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "Artifact "+artifactFile+" doesn't match the checksums of "+p.HumanReadableString())
+	}
+
+	provenanceName, err := provenanceFileName(a)
+	if err != nil {
+		return nil, err
+	}
+	if provenanceName != "" {
+		if provenanceFile == "" {
+			provenanceFile = filepath.Join(filepath.Dir(metadataFile), provenanceName)
+		}
+		err = a.GetProvenance().Verify(provenanceFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Provenance "+provenanceFile+" doesn't match the checksums of "+p.HumanReadableString())
+		}
+	}
+
+	var definition pkg.Package
+	if definitionFile != "" {
+		definition, err = readDefinition(definitionFile, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	unlock, err := lockRepository(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	repo, err := LoadLocalRepository(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "While loading repository from "+dir)
+	}
+	defer os.RemoveAll(repo.GetTreePath())
+	defer os.RemoveAll(repo.GetMetaPath())
+
+	Info("Publishing", p.HumanReadableString(), "to", repo.GetName())
+
+	// The tree is checked before placing any file, so artifacts are never
+	// published without a definition
+	db := pkg.NewInMemoryDatabase(false)
+	for _, old := range repo.GetTree().GetDatabase().World() {
+		if old.GetFingerPrint() == p.GetFingerPrint() {
+			if definition == nil {
+				definition = old
+			} else {
+				// Keep the definition path, so finalizers are still shipped
+				definition.SetPath(old.GetPath())
+			}
+			continue
+		}
+		_, err := db.CreatePackage(old)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating package "+old.HumanReadableString())
+		}
+	}
+	if definition == nil {
+		return nil, errors.New("No definition of " + p.HumanReadableString() + " in the repository tree, it must be published along with its definition file")
+	}
+	_, err = db.CreatePackage(definition)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating package "+p.HumanReadableString())
+	}
+
+	// Place the artifact atomically, clients must never see partial files
+	dst := filepath.Join(dir, name)
+	err = helpers.CopyFile(artifactFile, dst+".publish")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error met while copying "+name)
+	}
+	err = os.Rename(dst+".publish", dst)
+	if err != nil {
+		return nil, err
+	}
+	a.SetPath(dst)
+
+	if provenanceName != "" {
+		err = helpers.CopyFile(provenanceFile, filepath.Join(dir, provenanceName))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error met while copying "+provenanceName)
+		}
+	}
+
+	err = a.WriteYaml(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	index := compiler.ArtifactIndex{}
+	for _, old := range repo.GetIndex() {
+		if old.GetCompileSpec().GetPackage().GetArtifactFingerPrint() != p.GetArtifactFingerPrint() {
+			index = append(index, old)
+		}
+	}
+	index = append(index, a)
+
+	updated := NewLuetSystemRepository(
+		config.NewLuetRepository(repo.GetName(), repo.GetType(), repo.GetDescription(), repo.GetUrls(), repo.GetPriority(), true, false),
+		index, tree.NewInstallerRecipe(db))
+	inheritRepositoryFiles(repo, updated)
+	updated.SetAdvisories(repo.GetAdvisories())
+	updated.SetNews(repo.GetNews())
+
+	// Keep publishing deltas if the repository had them
+	updated.SetDeltaRevisions(repo.GetDeltaRevisions())
+
+	err = updated.Write(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// readDefinition reads the definition of the published package p from the
+// source tree file. Definitions in the tree are shared by the artifacts of all
+// the architectures.
+func readDefinition(definitionFile string, p pkg.Package) (pkg.Package, error) {
+	dat, err := ioutil.ReadFile(definitionFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading file "+definitionFile)
+	}
+	definition, err := pkg.DefaultPackageFromYaml(dat)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading yaml "+definitionFile)
+	}
+	if definition.GetFingerPrint() != p.GetFingerPrint() {
+		return nil, errors.New("Definition in " + definitionFile + " doesn't match " + p.HumanReadableString())
+	}
+	definition.SetArch("")
+	definition.SetPath("")
+	return &definition, nil
+}
+
+// ProvenanceFile returns the provenance document referenced by the metadata
+// file, which is expected next to it, or an empty string if there is none.
+func ProvenanceFile(metadataFile string) (string, error) {
+	dat, err := ioutil.ReadFile(metadataFile)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading file "+metadataFile)
+	}
+	a, err := compiler.NewPackageArtifactFromYaml(dat)
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading yaml "+metadataFile)
+	}
+	if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+		return "", errors.New("No package found in " + metadataFile)
+	}
+	name, err := provenanceFileName(a)
+	if err != nil || name == "" {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(metadataFile), name), nil
+}
+
+// provenanceFileName returns the name of the provenance document of the
+// artifact, if any. As for the artifact, references to any other file are
+// refused.
+func provenanceFileName(a compiler.Artifact) (string, error) {
+	ref := a.GetProvenance()
+	if ref == nil {
+		return "", nil
+	}
+	name := a.GetCompileSpec().GetPackage().GetArtifactFingerPrint() + ".provenance.json"
+	if ref.Path != name {
+		return "", errors.New("Provenance path " + ref.Path + " doesn't match " + name)
+	}
+	return name, nil
+}
+
+// lockRepository takes an exclusive lock on the repository in dir, and returns
+// the function to release it.
+func lockRepository(dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, REPOSITORY_LOCKFILE), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed creating lock file")
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "Failed locking repository")
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,228 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Publish", func() {
+	var repoDir, buildDir string
+
+	BeforeEach(func() {
+		var err error
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+		buildDir, err = ioutil.TempDir("", "build")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(FakeRepository(repoDir, 0, false, &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"})).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(repoDir)
+		os.RemoveAll(buildDir)
+	})
+
+	It("Adds artifacts to the repository index", func() {
+		b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+		Expect(FakeArtifact(buildDir, b)).ToNot(HaveOccurred())
+		definition, err := FakeDefinition(buildDir, b)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = PublishArtifact(repoDir, filepath.Join(buildDir, "b-test-1.0.package.tar"), filepath.Join(buildDir, "b-test-1.0.metadata.yaml"), "", definition)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(helpers.Exists(filepath.Join(repoDir, "b-test-1.0.package.tar"))).To(BeTrue())
+		Expect(helpers.Exists(filepath.Join(repoDir, "b-test-1.0.metadata.yaml"))).To(BeTrue())
+
+		repo, err := LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(repo.GetTreePath())
+		defer os.RemoveAll(repo.GetMetaPath())
+		Expect(repo.GetRevision()).To(Equal(2))
+		Expect(len(repo.GetIndex())).To(Equal(2))
+		Expect(len(repo.GetTree().GetDatabase().World())).To(Equal(2))
+		Expect(helpers.Exists(filepath.Join(repoDir, TREE_TARBALL+".gz"))).To(BeTrue())
+	})
+
+	It("Takes the runtime dependencies from the definition of the source tree", func() {
+		a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+		b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0",
+			PackageRequires: []*pkg.DefaultPackage{{Name: "gcc", Category: "devel", Version: ">=0"}}}
+		Expect(FakeArtifact(buildDir, b)).ToNot(HaveOccurred())
+		artifact := filepath.Join(buildDir, "b-test-1.0.package.tar")
+		metadata := filepath.Join(buildDir, "b-test-1.0.metadata.yaml")
+
+		_, err := PublishArtifact(repoDir, artifact, metadata, "", "")
+		Expect(err).To(HaveOccurred())
+		Expect(helpers.Exists(filepath.Join(repoDir, "b-test-1.0.package.tar"))).To(BeFalse())
+
+		definition, err := FakeDefinition(buildDir, &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0",
+			PackageRequires: []*pkg.DefaultPackage{a}})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = PublishArtifact(repoDir, artifact, metadata, "", definition)
+		Expect(err).ToNot(HaveOccurred())
+
+		repo, err := LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(repo.GetTreePath())
+		defer os.RemoveAll(repo.GetMetaPath())
+		published, err := repo.GetTree().GetDatabase().FindPackage(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(published.GetRequires())).To(Equal(1))
+		Expect(published.GetRequires()[0].GetName()).To(Equal("a"))
+
+		// Artifacts of packages already in the tree don't need it
+		Expect(FakeArtifact(buildDir, b)).ToNot(HaveOccurred())
+		_, err = PublishArtifact(repoDir, artifact, metadata, "", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		repo, err = LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(repo.GetTreePath())
+		defer os.RemoveAll(repo.GetMetaPath())
+		published, err = repo.GetTree().GetDatabase().FindPackage(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(published.GetRequires()[0].GetName()).To(Equal("a"))
+	})
+
+	It("Rejects artifacts not matching the checksums", func() {
+		b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+		Expect(FakeArtifact(buildDir, b)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "b-test-1.0.package.tar"), []byte("tampered"), 0644)).ToNot(HaveOccurred())
+
+		_, err := PublishArtifact(repoDir, filepath.Join(buildDir, "b-test-1.0.package.tar"), filepath.Join(buildDir, "b-test-1.0.metadata.yaml"), "", "")
+		Expect(err).To(HaveOccurred())
+		Expect(helpers.Exists(filepath.Join(repoDir, "b-test-1.0.package.tar"))).To(BeFalse())
+	})
+
+	It("Rejects artifacts not named after the package", func() {
+		b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+		Expect(FakeArtifact(buildDir, b)).ToNot(HaveOccurred())
+
+		metadata := filepath.Join(buildDir, "b-test-1.0.metadata.yaml")
+		dat, err := ioutil.ReadFile(metadata)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(dat)).To(ContainSubstring("b-test-1.0.package.tar"))
+		dat = []byte(strings.Replace(string(dat), "b-test-1.0.package.tar", REPOSITORY_SPECFILE, -1))
+		Expect(ioutil.WriteFile(metadata, dat, 0644)).ToNot(HaveOccurred())
+
+		spec, err := ioutil.ReadFile(filepath.Join(repoDir, REPOSITORY_SPECFILE))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = PublishArtifact(repoDir, filepath.Join(buildDir, "b-test-1.0.package.tar"), metadata, "", "")
+		Expect(err).To(HaveOccurred())
+
+		unchanged, err := ioutil.ReadFile(filepath.Join(repoDir, REPOSITORY_SPECFILE))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(unchanged).To(Equal(spec))
+	})
+
+	It("Rejects provenance documents not named after the package", func() {
+		b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"}
+		Expect(FakeArtifact(buildDir, b)).ToNot(HaveOccurred())
+		Expect(FakeProvenance(buildDir, b)).ToNot(HaveOccurred())
+
+		metadata := filepath.Join(buildDir, "b-test-1.0.metadata.yaml")
+		provenance, err := ProvenanceFile(metadata)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(provenance).To(Equal(filepath.Join(buildDir, "b-test-1.0.provenance.json")))
+
+		dat, err := ioutil.ReadFile(metadata)
+		Expect(err).ToNot(HaveOccurred())
+		dat = []byte(strings.Replace(string(dat), "b-test-1.0.provenance.json", "../b-test-1.0.provenance.json", -1))
+		Expect(ioutil.WriteFile(metadata, dat, 0644)).ToNot(HaveOccurred())
+
+		_, err = ProvenanceFile(metadata)
+		Expect(err).To(HaveOccurred())
+		_, err = PublishArtifact(repoDir, filepath.Join(buildDir, "b-test-1.0.package.tar"), metadata, provenance, "")
+		Expect(err).To(HaveOccurred())
+		Expect(helpers.Exists(filepath.Join(repoDir, "b-test-1.0.package.tar"))).To(BeFalse())
+	})
+
+	It("Keeps the configured delta revisions", func() {
+		a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+		Expect(FakeRepository(repoDir, 3, false, a)).ToNot(HaveOccurred())
+
+		for _, p := range []*pkg.DefaultPackage{
+			{Name: "b", Category: "test", Version: "1.0"},
+			{Name: "c", Category: "test", Version: "1.0"},
+		} {
+			Expect(FakeArtifact(buildDir, p)).ToNot(HaveOccurred())
+			definition, err := FakeDefinition(buildDir, p)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = PublishArtifact(repoDir,
+				filepath.Join(buildDir, p.GetFingerPrint()+".package.tar"),
+				filepath.Join(buildDir, p.GetFingerPrint()+".metadata.yaml"), "", definition)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		repo, err := LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(repo.GetTreePath())
+		defer os.RemoveAll(repo.GetMetaPath())
+		Expect(repo.GetRevision()).To(Equal(4))
+		Expect(repo.GetDeltaRevisions()).To(Equal(3))
+		for _, rev := range []int{2, 3, 4} {
+			_, err = repo.GetRepositoryFile(DeltaRepositoryFileKey(rev))
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("Serializes concurrent publishes", func() {
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			p := &pkg.DefaultPackage{Name: fmt.Sprintf("p%d", i), Category: "test", Version: "1.0"}
+			Expect(FakeArtifact(buildDir, p)).ToNot(HaveOccurred())
+			_, err := FakeDefinition(buildDir, p)
+			Expect(err).ToNot(HaveOccurred())
+			wg.Add(1)
+			go func(p *pkg.DefaultPackage) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := PublishArtifact(repoDir,
+					filepath.Join(buildDir, p.GetFingerPrint()+".package.tar"),
+					filepath.Join(buildDir, p.GetFingerPrint()+".metadata.yaml"), "",
+					filepath.Join(buildDir, p.GetFingerPrint()+".definition.yaml"))
+				errs <- err
+			}(p)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		repo, err := LoadLocalRepository(repoDir)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(repo.GetTreePath())
+		defer os.RemoveAll(repo.GetMetaPath())
+		Expect(repo.GetRevision()).To(Equal(6))
+		Expect(len(repo.GetIndex())).To(Equal(6))
+	})
+})
@@ -44,8 +44,9 @@ const (
 	REPOSITORY_SPECFILE = "repository.yaml"
 	TREE_TARBALL        = "tree.tar"
 
-	REPOFILE_TREE_KEY = "tree"
-	REPOFILE_META_KEY = "meta"
+	REPOFILE_TREE_KEY         = "tree"
+	REPOFILE_META_KEY         = "meta"
+	REPOFILE_COMPACT_TREE_KEY = "compact_tree"
 )
 
 type LuetRepositoryFile struct {
@@ -60,6 +61,19 @@ type LuetSystemRepository struct {
 	Index           compiler.ArtifactIndex        `json:"index"`
 	Tree            tree.Builder                  `json:"-"`
 	RepositoryFiles map[string]LuetRepositoryFile `json:"repo_files"`
+
+	// Number of revisions for which deltas are published on Write, saved in
+	// the repository spec so later updates keep the same window
+	DeltaRevisions int `json:"-"`
+
+	// Advisories and news shipped with the repository
+	Advisories Advisories `json:"-"`
+	News       News       `json:"-"`
+
+	// Arches are the architectures the artifacts are built for
+	Arches []string `json:"arches,omitempty"`
+	// Variants are the build variants of the artifacts
+	Variants []string `json:"variants,omitempty"`
 }
 
 type LuetSystemRepositorySerialized struct {
@@ -73,6 +87,9 @@ type LuetSystemRepositorySerialized struct {
 	TreePath        string                        `json:"treepath"`
 	MetaPath        string                        `json:"metapath"`
 	RepositoryFiles map[string]LuetRepositoryFile `json:"repo_files"`
+	Arches          []string                      `json:"arches,omitempty"`
+	Variants        []string                      `json:"variants,omitempty"`
+	DeltaRevisions  int                           `json:"delta_revisions,omitempty"`
 }
 
 type LuetSystemRepositoryMetadata struct {
@@ -157,6 +174,31 @@ func NewDefaultMetaRepositoryFile() LuetRepositoryFile {
 	}
 }
 
+func NewDefaultCompactTreeRepositoryFile() LuetRepositoryFile {
+	return LuetRepositoryFile{
+		FileName:        tree.CompactTreeFile + ".tar",
+		CompressionType: compiler.GZip,
+	}
+}
+
+// inheritRepositoryFiles sets in dst the repository files published by src,
+// with their compression settings. Stored file names carry the compression
+// extension, so the default names are used.
+func inheritRepositoryFiles(src, dst Repository) {
+	for key, def := range map[string]LuetRepositoryFile{
+		REPOFILE_TREE_KEY:         NewDefaultTreeRepositoryFile(),
+		REPOFILE_META_KEY:         NewDefaultMetaRepositoryFile(),
+		REPOFILE_COMPACT_TREE_KEY: NewDefaultCompactTreeRepositoryFile(),
+	} {
+		f, err := src.GetRepositoryFile(key)
+		if err != nil {
+			continue
+		}
+		def.SetCompressionType(f.GetCompressionType())
+		dst.SetRepositoryFile(key, def)
+	}
+}
+
 func (f *LuetRepositoryFile) SetFileName(n string) {
 	f.FileName = n
 }
@@ -193,9 +235,37 @@ func GenerateRepository(name, descr, t string, urls []string, priority int, src
 		return nil, err
 	}
 
-	return NewLuetSystemRepository(
+	advisories := Advisories{}
+	news := News{}
+	for _, treeDir := range treesDir {
+		if helpers.Exists(filepath.Join(treeDir, AdvisoriesDir)) {
+			a, err := LoadAdvisoriesDir(filepath.Join(treeDir, AdvisoriesDir))
+			if err != nil {
+				return nil, errors.Wrap(err, "While loading advisories from "+treeDir)
+			}
+			advisories = append(advisories, a...)
+		}
+		if helpers.Exists(filepath.Join(treeDir, NewsDir)) {
+			n, err := LoadNewsDir(filepath.Join(treeDir, NewsDir))
+			if err != nil {
+				return nil, errors.Wrap(err, "While loading news from "+treeDir)
+			}
+			news = append(news, n...)
+		}
+	}
+	if err := advisories.Validate(); err != nil {
+		return nil, err
+	}
+	if err := news.Validate(); err != nil {
+		return nil, err
+	}
+
+	repo := NewLuetSystemRepository(
 		config.NewLuetRepository(name, t, descr, urls, priority, true, false),
-		art, tr), nil
+		art, tr)
+	repo.SetAdvisories(advisories)
+	repo.SetNews(news)
+	return repo, nil
 }
 
 func NewSystemRepository(repo config.LuetRepository) Repository {
@@ -207,6 +277,8 @@ func NewSystemRepository(repo config.LuetRepository) Repository {
 
 func NewLuetSystemRepository(repo *config.LuetRepository, art []compiler.Artifact, builder tree.Builder) Repository {
 	return &LuetSystemRepository{
+		Arches:          compiler.ArtifactIndex(art).Arches(),
+		Variants:        compiler.ArtifactIndex(art).Variants(),
 		LuetRepository:  repo,
 		Index:           art,
 		Tree:            builder,
@@ -232,6 +304,9 @@ func NewLuetSystemRepositoryFromYaml(data []byte, db pkg.PackageDatabase) (Repos
 			false,
 		),
 		RepositoryFiles: p.RepositoryFiles,
+		Arches:          p.Arches,
+		Variants:        p.Variants,
+		DeltaRevisions:  p.DeltaRevisions,
 	}
 	if p.Revision > 0 {
 		r.Revision = p.Revision
@@ -371,6 +446,24 @@ func (r *LuetSystemRepository) GetRepositoryFile(name string) (LuetRepositoryFil
 func (r *LuetSystemRepository) SetRepositoryFile(name string, f LuetRepositoryFile) {
 	r.RepositoryFiles[name] = f
 }
+func (r *LuetSystemRepository) GetDeltaRevisions() int {
+	return r.DeltaRevisions
+}
+func (r *LuetSystemRepository) SetDeltaRevisions(n int) {
+	r.DeltaRevisions = n
+}
+func (r *LuetSystemRepository) GetAdvisories() Advisories {
+	return r.Advisories
+}
+func (r *LuetSystemRepository) SetAdvisories(a Advisories) {
+	r.Advisories = a
+}
+func (r *LuetSystemRepository) GetNews() News {
+	return r.News
+}
+func (r *LuetSystemRepository) SetNews(n News) {
+	r.News = n
+}
 
 func (r *LuetSystemRepository) ReadSpecFile(file string, removeFile bool) (Repository, error) {
 	dat, err := ioutil.ReadFile(file)
@@ -446,6 +539,20 @@ func (r *LuetSystemRepository) Write(dst string, resetRevision bool) error {
 		return errors.Wrap(err, "Error met while saving the tree")
 	}
 
+	if r.DeltaRevisions > 0 && !resetRevision && helpers.Exists(repospec) {
+		previous, err := LoadLocalRepository(dst)
+		if err != nil {
+			Warning("Failed loading the previous revision, deltas are not generated:", err.Error())
+		} else {
+			defer os.RemoveAll(previous.GetTreePath())
+			defer os.RemoveAll(previous.GetMetaPath())
+			err = r.writeDelta(dst, archive, previous)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	treeFile, err := r.GetRepositoryFile(REPOFILE_TREE_KEY)
 	if err != nil {
 		treeFile = NewDefaultTreeRepositoryFile()
@@ -468,6 +575,61 @@ func (r *LuetSystemRepository) Write(dst string, resetRevision bool) error {
 	treeFile.SetChecksums(a.GetChecksums())
 	r.SetRepositoryFile(REPOFILE_TREE_KEY, treeFile)
 
+	// The compact tree is published along the tree tarball, which is still used by older clients
+	if compactFile, err := r.GetRepositoryFile(REPOFILE_COMPACT_TREE_KEY); err == nil {
+		compact, err := tree.NewCompactTree(r.GetTree().GetDatabase())
+		if err != nil {
+			return errors.Wrap(err, "Error met while creating the compact tree")
+		}
+
+		compactTmpDir, err := config.LuetCfg.GetSystem().TempDir("compact")
+		if err != nil {
+			return errors.Wrap(err, "Error met while creating tempdir for the compact tree")
+		}
+		defer os.RemoveAll(compactTmpDir) // clean up
+
+		err = compact.WriteFile(filepath.Join(compactTmpDir, tree.CompactTreeFile))
+		if err != nil {
+			return err
+		}
+
+		a = compiler.NewPackageArtifact(filepath.Join(dst, compactFile.GetFileName()))
+		a.SetCompressionType(compactFile.GetCompressionType())
+		err = a.Compress(compactTmpDir, 1)
+		if err != nil {
+			return errors.Wrap(err, "Error met while archiving the compact tree")
+		}
+		compactFile.SetFileName(path.Base(a.GetPath()))
+		err = a.Hash()
+		if err != nil {
+			return errors.Wrap(err, "Failed generating checksums for the compact tree")
+		}
+		compactFile.SetChecksums(a.GetChecksums())
+		r.SetRepositoryFile(REPOFILE_COMPACT_TREE_KEY, compactFile)
+	}
+
+	if len(r.Advisories) > 0 {
+		err = r.writeRepositoryFile(dst, REPOFILE_ADVISORIES_KEY, NewDefaultAdvisoriesRepositoryFile(), func(dir string) error {
+			return r.Advisories.WriteFile(filepath.Join(dir, REPOSITORY_ADVISORIESFILE))
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		delete(r.RepositoryFiles, REPOFILE_ADVISORIES_KEY)
+	}
+
+	if len(r.News) > 0 {
+		err = r.writeRepositoryFile(dst, REPOFILE_NEWS_KEY, NewDefaultNewsRepositoryFile(), func(dir string) error {
+			return r.News.WriteFile(filepath.Join(dir, REPOSITORY_NEWSFILE))
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		delete(r.RepositoryFiles, REPOFILE_NEWS_KEY)
+	}
+
 	// Create Metadata struct and serialized repository
 	meta, serialized := r.Serialize()
 
@@ -535,13 +697,27 @@ func (r *LuetSystemRepository) Client() Client {
 			client.RepoData{
 				Urls:           r.GetUrls(),
 				Authentication: r.GetAuthentication(),
+				Http:           r.LuetRepository.Http,
 			})
 	}
 
 	return nil
 }
+
 func (r *LuetSystemRepository) Sync(force bool) (Repository, error) {
+	return r.sync(force, true)
+}
+
+// SyncAll syncs the repository as Sync, but keeps the artifacts of all the
+// architectures and variants, and the definitions as published, without
+// applying the use flags of the system.
+func (r *LuetSystemRepository) SyncAll(force bool) (Repository, error) {
+	return r.sync(force, false)
+}
+
+func (r *LuetSystemRepository) sync(force, filter bool) (Repository, error) {
 	var repoUpdated bool = false
+	var deltaUpdated bool = false
 	var treefs, metafs string
 	aurora := GetAurora()
 
@@ -566,9 +742,10 @@ func (r *LuetSystemRepository) Sync(force bool) (Repository, error) {
 	// Example: /tmp/HttpClient236052003
 	defer os.RemoveAll(file)
 
+	var localRepo Repository
 	if r.Cached {
 		if !force {
-			localRepo, _ := r.ReadSpecFile(filepath.Join(repobasedir, REPOSITORY_SPECFILE), false)
+			localRepo, _ = r.ReadSpecFile(filepath.Join(repobasedir, REPOSITORY_SPECFILE), false)
 			if localRepo != nil {
 				if localRepo.GetRevision() == repo.GetRevision() &&
 					localRepo.GetLastUpdate() == repo.GetLastUpdate() {
@@ -608,7 +785,26 @@ func (r *LuetSystemRepository) Sync(force bool) (Repository, error) {
 	treeFile, _ := repo.GetRepositoryFile(REPOFILE_TREE_KEY)
 	metaFile, _ := repo.GetRepositoryFile(REPOFILE_META_KEY)
 
-	if !repoUpdated {
+	// Prefer the compact tree, when the repository publishes it
+	if compactFile, err := repo.GetRepositoryFile(REPOFILE_COMPACT_TREE_KEY); err == nil {
+		treeFile = compactFile
+	}
+
+	if !repoUpdated && localRepo != nil {
+		err = r.syncDeltas(c, localRepo, repo, treefs, metafs)
+		if err == nil {
+			err = helpers.CopyFile(file, filepath.Join(repobasedir, REPOSITORY_SPECFILE))
+			if err != nil {
+				return nil, errors.Wrap(err, "Error on update "+REPOSITORY_SPECFILE)
+			}
+			Info("Repository", repo.GetName(), "updated to revision", repo.GetRevision(), "with deltas.")
+			deltaUpdated = true
+		} else {
+			Debug("Deltas not applicable for repository", repo.GetName(), ":", err.Error())
+		}
+	}
+
+	if !repoUpdated && !deltaUpdated {
 
 		// Get Tree
 		a := compiler.NewPackageArtifact(treeFile.GetFileName())
@@ -681,7 +877,7 @@ func (r *LuetSystemRepository) Sync(force bool) (Repository, error) {
 				aurora.Bold(aurora.Green(time.Unix(tsec, 0).String())).String(),
 		)
 
-	} else {
+	} else if repoUpdated {
 		Info("Repository", repo.GetName(), "is already up to date.")
 	}
 
@@ -693,20 +889,53 @@ func (r *LuetSystemRepository) Sync(force bool) (Repository, error) {
 	}
 	repo.SetIndex(meta.ToArtifactIndex())
 
+	// Cached repositories up to date already have the documents
+	for key, file := range map[string]string{
+		REPOFILE_ADVISORIES_KEY: REPOSITORY_ADVISORIESFILE,
+		REPOFILE_NEWS_KEY:       REPOSITORY_NEWSFILE,
+	} {
+		if _, err := repo.GetRepositoryFile(key); err == nil &&
+			(!repoUpdated || !helpers.Exists(filepath.Join(metafs, file))) {
+			err = downloadRepositoryFile(c, repo, key, metafs)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = loadRepositoryDocuments(repo, metafs)
+	if err != nil {
+		return nil, err
+	}
+
 	reciper := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
 	err = reciper.Load(treefs)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error met while unpacking rootfs")
 	}
 
+	if filter {
+		err = config.LuetCfg.GetUseFlags().ApplyDatabase(reciper.GetDatabase())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	repo.SetTree(reciper)
 	repo.SetTreePath(treefs)
 
+	if filter {
+		err = repo.(*LuetSystemRepository).filterArtifacts(config.LuetCfg.GetSystem().GetArch(), config.LuetCfg.GetSystem().Variant)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Copy the local available data to the one which was synced
 	// e.g. locally we can override the type (disk), or priority
 	// while remotely it could be advertized differently
 	repo.SetUrls(r.GetUrls())
 	repo.SetAuthentication(r.GetAuthentication())
+	repo.(*LuetSystemRepository).LuetRepository.Http = r.LuetRepository.Http
 	repo.SetType(r.GetType())
 	repo.SetPriority(r.GetPriority())
 	repo.SetName(r.GetName())
@@ -722,6 +951,93 @@ func (r *LuetSystemRepository) Sync(force bool) (Repository, error) {
 	return repo, nil
 }
 
+// LoadLocalRepository reads the repository generated by create-repo in the given
+// directory, unpacking its tree and metadata in temporary folders.
+// Tree and meta paths of the returned repository point to the unpacked data and
+// must be removed by the caller when no longer needed.
+func LoadLocalRepository(dir string) (_ Repository, err error) {
+	repo, err := NewSystemRepository(config.LuetRepository{}).(*LuetSystemRepository).ReadSpecFile(
+		filepath.Join(dir, REPOSITORY_SPECFILE), false)
+	if err != nil {
+		return nil, err
+	}
+
+	treefs, err := config.LuetCfg.GetSystem().TempDir("treefs")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error met while creating tempdir for rootfs")
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(treefs)
+		}
+	}()
+	repo.SetTreePath(treefs)
+
+	metafs, err := config.LuetCfg.GetSystem().TempDir("metafs")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error met while creating tempdir for metafs")
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(metafs)
+		}
+	}()
+	repo.SetMetaPath(metafs)
+
+	treeFile, _ := repo.GetRepositoryFile(REPOFILE_TREE_KEY)
+	metaFile, _ := repo.GetRepositoryFile(REPOFILE_META_KEY)
+
+	type repoFile struct {
+		dst string
+		f   LuetRepositoryFile
+	}
+	files := []repoFile{{treefs, treeFile}, {metafs, metaFile}}
+	for _, key := range []string{REPOFILE_ADVISORIES_KEY, REPOFILE_NEWS_KEY} {
+		if f, err := repo.GetRepositoryFile(key); err == nil {
+			files = append(files, repoFile{metafs, f})
+		}
+	}
+
+	for _, file := range files {
+		dst, f := file.dst, file.f
+		a := compiler.NewPackageArtifact(filepath.Join(dir, f.GetFileName()))
+		a.SetChecksums(f.GetChecksums())
+		a.SetCompressionType(f.GetCompressionType())
+		err = a.Verify()
+		if err != nil {
+			return nil, errors.Wrap(err, "Integrity check failure for "+f.GetFileName())
+		}
+		err = a.Unpack(dst, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error met while unpacking "+f.GetFileName())
+		}
+	}
+
+	meta, err := NewLuetSystemRepositoryMetadata(
+		filepath.Join(metafs, REPOSITORY_METAFILE), false,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "While processing "+REPOSITORY_METAFILE)
+	}
+	repo.SetIndex(meta.ToArtifactIndex())
+
+	reciper := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+	err = reciper.Load(treefs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error met while loading tree")
+	}
+	repo.SetTree(reciper)
+	repo.SetType("disk")
+	repo.SetUrls([]string{dir})
+
+	err = loadRepositoryDocuments(repo, metafs)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
 func (r *LuetSystemRepository) Serialize() (*LuetSystemRepositoryMetadata, LuetSystemRepositorySerialized) {
 
 	serialized := LuetSystemRepositorySerialized{
@@ -733,6 +1049,9 @@ func (r *LuetSystemRepository) Serialize() (*LuetSystemRepositoryMetadata, LuetS
 		Revision:        r.Revision,
 		LastUpdate:      r.LastUpdate,
 		RepositoryFiles: r.RepositoryFiles,
+		Arches:          r.Index.Arches(),
+		Variants:        r.Index.Variants(),
+		DeltaRevisions:  r.DeltaRevisions,
 	}
 
 	// Check if is needed set the index or simply use
@@ -883,3 +1202,140 @@ func (re Repositories) SearchLabel(s string) []PackageMatch {
 func (re Repositories) Search(s string) []PackageMatch {
 	return re.SearchPackages(s, LuetSearchOpts{Pattern: s, Mode: SRegexPkg})
 }
+
+// writeRepositoryFile archives the content written by the given function in
+// dst, and sets it as the repository file with the given key.
+func (r *LuetSystemRepository) writeRepositoryFile(dst, key string, f LuetRepositoryFile, write func(dir string) error) error {
+	tmpDir, err := config.LuetCfg.GetSystem().TempDir(key)
+	if err != nil {
+		return errors.Wrap(err, "Error met while creating tempdir for "+key)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	err = write(tmpDir)
+	if err != nil {
+		return err
+	}
+
+	a := compiler.NewPackageArtifact(filepath.Join(dst, f.GetFileName()))
+	a.SetCompressionType(f.GetCompressionType())
+	err = a.Compress(tmpDir, 1)
+	if err != nil {
+		return errors.Wrap(err, "Error met while archiving "+key)
+	}
+	f.SetFileName(path.Base(a.GetPath()))
+	err = a.Hash()
+	if err != nil {
+		return errors.Wrap(err, "Failed generating checksums for "+key)
+	}
+	f.SetChecksums(a.GetChecksums())
+	r.SetRepositoryFile(key, f)
+	return nil
+}
+
+// filterArtifacts drops the artifacts built for other architectures or
+// variants, or with other use flags than the ones of the tree, and the
+// packages left without any artifact from the tree, so they are not
+// considered as candidates.
+func (r *LuetSystemRepository) filterArtifacts(arch, variant string) error {
+	index := compiler.ArtifactIndex{}
+	built := map[string]bool{}
+	available := map[string]bool{}
+	db := r.GetTree().GetDatabase()
+	for _, a := range r.Index {
+		if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+			index = append(index, a)
+			continue
+		}
+		p := a.GetCompileSpec().GetPackage()
+		built[p.GetFingerPrint()] = true
+		if def, err := db.FindPackage(p); err == nil && !p.MatchUses(def.GetUses()) {
+			Debug("Artifact", p.HumanReadableString(), "of", r.GetName(), "is built with use flags", p.GetUses(), "instead of", def.GetUses())
+			continue
+		}
+		if p.MatchArch(arch) && p.MatchVariant(variant) {
+			index = append(index, a)
+			available[p.GetFingerPrint()] = true
+		}
+	}
+
+	// Prefer the artifacts built for the architecture and the variant to the
+	// generic ones
+	specific := func(p pkg.Package) int {
+		n := 0
+		if p.GetArch() != "" {
+			n++
+		}
+		if p.GetVariant() != "" {
+			n++
+		}
+		return n
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		if index[i].GetCompileSpec() == nil || index[j].GetCompileSpec() == nil {
+			return false
+		}
+		return specific(index[i].GetCompileSpec().GetPackage()) > specific(index[j].GetCompileSpec().GetPackage())
+	})
+	r.Index = index
+
+	for _, p := range db.World() {
+		if built[p.GetFingerPrint()] && !available[p.GetFingerPrint()] {
+			Debug("Package", p.HumanReadableString(), "of", r.GetName(), "is not available for", arch, variant, "with use flags", p.GetUses())
+			err := db.RemovePackage(p)
+			if err != nil {
+				return errors.Wrap(err, "Failed filtering "+p.HumanReadableString())
+			}
+		}
+	}
+	return nil
+}
+
+// loadRepositoryDocuments loads the advisories and news of the repository,
+// unpacked in metafs.
+func loadRepositoryDocuments(repo Repository, metafs string) error {
+	if _, err := repo.GetRepositoryFile(REPOFILE_ADVISORIES_KEY); err == nil {
+		advisories, err := NewAdvisoriesFromFile(filepath.Join(metafs, REPOSITORY_ADVISORIESFILE))
+		if err != nil {
+			return err
+		}
+		repo.SetAdvisories(advisories)
+	}
+	if _, err := repo.GetRepositoryFile(REPOFILE_NEWS_KEY); err == nil {
+		news, err := NewNewsFromFile(filepath.Join(metafs, REPOSITORY_NEWSFILE))
+		if err != nil {
+			return err
+		}
+		repo.SetNews(news)
+	}
+	return nil
+}
+
+// downloadRepositoryFile downloads the repository file with the given key,
+// and unpacks it in dir once verified.
+func downloadRepositoryFile(c Client, repo Repository, key, dir string) error {
+	f, err := repo.GetRepositoryFile(key)
+	if err != nil {
+		return err
+	}
+
+	a, err := c.DownloadArtifact(compiler.NewPackageArtifact(f.GetFileName()))
+	if err != nil {
+		return errors.Wrap(err, "While downloading "+f.GetFileName())
+	}
+	defer os.Remove(a.GetPath())
+
+	a.SetChecksums(f.GetChecksums())
+	a.SetCompressionType(f.GetCompressionType())
+	err = a.Verify()
+	if err != nil {
+		return errors.Wrap(err, "Integrity check failure for "+f.GetFileName())
+	}
+
+	os.MkdirAll(dir, os.ModePerm)
+	err = a.Unpack(dir, true)
+	if err != nil {
+		return errors.Wrap(err, "Error met while unpacking "+f.GetFileName())
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/config"
+	"github.com/mudler/luet/pkg/helpers"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Slots", func() {
+	var treeDir, repoDir, fakeroot string
+	var inst Installer
+	var system *System
+
+	python38 := &pkg.DefaultPackage{Name: "python", Category: "lang", Version: "3.8.1", Slot: "3.8"}
+	python39 := &pkg.DefaultPackage{Name: "python", Category: "lang", Version: "3.9.1", Slot: "3.9"}
+
+	writeRepository := func(files38, files39 []string) {
+		db := pkg.NewInMemoryDatabase(false)
+		for _, p := range []*pkg.DefaultPackage{python38, python39} {
+			_, err := db.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		Expect(FakeArtifact(repoDir, python38, files38...)).ToNot(HaveOccurred())
+		Expect(FakeArtifact(repoDir, python39, files39...)).ToNot(HaveOccurred())
+
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+
+		inst = NewLuetInstaller(LuetInstallerOptions{Concurrency: 1})
+		inst.Repositories(Repositories{NewSystemRepository(config.LuetRepository{
+			Name:   "slots",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})})
+	}
+
+	BeforeEach(func() {
+		var err error
+		treeDir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+		fakeroot, err = ioutil.TempDir("", "fakeroot")
+		Expect(err).ToNot(HaveOccurred())
+		system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(treeDir)
+		os.RemoveAll(repoDir)
+		os.RemoveAll(fakeroot)
+	})
+
+	It("Installs versions in different slots side by side", func() {
+		writeRepository([]string{"usr/bin/python3.8"}, []string{"usr/bin/python3.9"})
+
+		Expect(inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: ">=0", Slot: "3.8"}}, system)).ToNot(HaveOccurred())
+		Expect(inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: ">=0", Slot: "3.9"}}, system)).ToNot(HaveOccurred())
+
+		for _, p := range []*pkg.DefaultPackage{python38, python39} {
+			installed, err := system.Database.FindPackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(installed.GetSlot()).To(Equal(p.GetSlot()))
+		}
+		Expect(helpers.Exists(filepath.Join(fakeroot, "usr", "bin", "python3.8"))).To(BeTrue())
+		Expect(helpers.Exists(filepath.Join(fakeroot, "usr", "bin", "python3.9"))).To(BeTrue())
+	})
+
+	It("Installs versions in other slots without an explicit slot", func() {
+		writeRepository([]string{"usr/bin/python3.8"}, []string{"usr/bin/python3.9"})
+
+		Expect(inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: "3.8.1"}}, system)).ToNot(HaveOccurred())
+		Expect(inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: "3.9.1"}}, system)).ToNot(HaveOccurred())
+
+		for _, p := range []*pkg.DefaultPackage{python38, python39} {
+			installed, err := system.Database.FindPackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(installed.GetSlot()).To(Equal(p.GetSlot()))
+		}
+		Expect(helpers.Exists(filepath.Join(fakeroot, "usr", "bin", "python3.8"))).To(BeTrue())
+		Expect(helpers.Exists(filepath.Join(fakeroot, "usr", "bin", "python3.9"))).To(BeTrue())
+
+		// The version in the slot of the candidate is already installed
+		Expect(inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: ">=3.9"}}, system)).ToNot(HaveOccurred())
+		vers, err := system.Database.FindPackageVersions(python39)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(vers)).To(Equal(2))
+	})
+
+	It("Refuses files installed by another slot", func() {
+		writeRepository([]string{"usr/bin/python"}, []string{"usr/bin/python"})
+
+		Expect(inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: ">=0", Slot: "3.8"}}, system)).ToNot(HaveOccurred())
+		err := inst.Install([]pkg.Package{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: ">=0", Slot: "3.9"}}, system)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("usr/bin/python"))
+
+		_, err = system.Database.FindPackage(python39)
+		Expect(err).To(HaveOccurred())
+	})
+})
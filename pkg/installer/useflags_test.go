@@ -0,0 +1,109 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Use flags", func() {
+	var treeDir, repoDir string
+	var oldUses pkg.UseFlags
+
+	BeforeEach(func() {
+		var err error
+		treeDir, err = ioutil.TempDir("", "tree")
+		Expect(err).ToNot(HaveOccurred())
+		repoDir, err = ioutil.TempDir("", "repo")
+		Expect(err).ToNot(HaveOccurred())
+		oldUses = *config.LuetCfg.GetUseFlags()
+
+		c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+		a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"}
+		a.RequiresIf(map[string][]*pkg.DefaultPackage{"ssl": {c}})
+
+		db := pkg.NewInMemoryDatabase(false)
+		for _, p := range []*pkg.DefaultPackage{a, c} {
+			_, err := db.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(tree.NewInstallerRecipe(db).Save(treeDir)).ToNot(HaveOccurred())
+
+		// a is built with ssl enabled
+		for _, p := range []*pkg.DefaultPackage{
+			{Name: "a", Category: "test", Version: "1.0", UseFlags: []string{"ssl"}},
+			{Name: "c", Category: "test", Version: "1.0"},
+		} {
+			Expect(FakeArtifact(repoDir, p)).ToNot(HaveOccurred())
+		}
+
+		repo, err := GenerateRepository("test", "description", "disk", []string{repoDir}, 1, repoDir, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(repoDir, false)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		*config.LuetCfg.GetUseFlags() = oldUses
+		os.RemoveAll(treeDir)
+		os.RemoveAll(repoDir)
+	})
+
+	sync := func() Repository {
+		r := NewSystemRepository(config.LuetRepository{
+			Name:   "useflags",
+			Type:   "disk",
+			Urls:   []string{repoDir},
+			Enable: true,
+		})
+		synced, err := r.Sync(false)
+		Expect(err).ToNot(HaveOccurred())
+		os.RemoveAll(synced.GetTreePath())
+		os.RemoveAll(synced.GetMetaPath())
+		return synced
+	}
+
+	It("Matches the artifacts built with the flags selected", func() {
+		config.LuetCfg.GetUseFlags().Global = []string{"ssl"}
+		synced := sync()
+		Expect(len(synced.GetIndex())).To(Equal(2))
+
+		a, err := synced.GetTree().GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.GetUses()).To(Equal([]string{"ssl"}))
+		Expect(len(a.GetRequires())).To(Equal(1))
+		Expect(a.GetRequires()[0].GetName()).To(Equal("c"))
+	})
+
+	It("Drops the packages not built with the flags selected", func() {
+		synced := sync()
+		Expect(len(synced.GetIndex())).To(Equal(1))
+
+		db := synced.GetTree().GetDatabase()
+		_, err := db.FindPackage(&pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0"})
+		Expect(err).To(HaveOccurred())
+		_, err = db.FindPackage(&pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,203 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package license
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Expression is a parsed SPDX license expression, e.g. "(MIT OR Apache-2.0) AND BSD-3-Clause"
+type Expression interface {
+	// Licenses returns the license identifiers referenced by the expression
+	Licenses() []string
+	// Satisfied returns true if accept holds for a choice of licenses of the
+	// expression, otherwise the identifiers which are not accepted
+	Satisfied(accept func(id string) bool) (bool, []string)
+	String() string
+}
+
+// License is a single license identifier, optionally with an exception
+type License struct {
+	ID        string
+	Exception string
+}
+
+type compound struct {
+	op   string
+	args []Expression
+}
+
+// Parse reads a license expression. Licenses which are not valid expressions,
+// like free text, are considered a single identifier.
+func Parse(s string) Expression {
+	s = strings.TrimSpace(s)
+	p := &parser{tokens: tokenize(s)}
+	e, err := p.or()
+	if err != nil || p.pos != len(p.tokens) {
+		return &License{ID: s}
+	}
+	return e
+}
+
+func (l *License) Licenses() []string {
+	return []string{l.String()}
+}
+
+func (l *License) Satisfied(accept func(id string) bool) (bool, []string) {
+	if accept(l.String()) {
+		return true, nil
+	}
+	return false, []string{l.String()}
+}
+
+func (l *License) String() string {
+	if l.Exception != "" {
+		return l.ID + " WITH " + l.Exception
+	}
+	return l.ID
+}
+
+func (c *compound) Licenses() []string {
+	var ans []string
+	for _, a := range c.args {
+		ans = append(ans, a.Licenses()...)
+	}
+	return ans
+}
+
+func (c *compound) Satisfied(accept func(id string) bool) (bool, []string) {
+	var rejected []string
+	for _, a := range c.args {
+		ok, r := a.Satisfied(accept)
+		if ok && c.op == "OR" {
+			return true, nil
+		}
+		rejected = append(rejected, r...)
+	}
+	return len(rejected) == 0, rejected
+}
+
+func (c *compound) String() string {
+	var parts []string
+	for _, a := range c.args {
+		if _, ok := a.(*compound); ok {
+			parts = append(parts, "("+a.String()+")")
+		} else {
+			parts = append(parts, a.String())
+		}
+	}
+	return strings.Join(parts, " "+c.op+" ")
+}
+
+func tokenize(s string) []string {
+	s = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s)
+	return strings.Fields(s)
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) keyword(k string) bool {
+	if strings.ToUpper(p.peek()) == k {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Expression, error) {
+	return p.binary("OR", p.and)
+}
+
+func (p *parser) and() (Expression, error) {
+	return p.binary("AND", p.with)
+}
+
+func (p *parser) binary(op string, next func() (Expression, error)) (Expression, error) {
+	e, err := next()
+	if err != nil {
+		return nil, err
+	}
+	c := &compound{op: op, args: []Expression{e}}
+	for p.keyword(op) {
+		e, err := next()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, e)
+	}
+	if len(c.args) == 1 {
+		return c.args[0], nil
+	}
+	return c, nil
+}
+
+func (p *parser) with() (Expression, error) {
+	e, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("WITH") {
+		l, ok := e.(*License)
+		exception := p.peek()
+		if !ok || !isIdentifier(exception) {
+			return nil, errors.New("Invalid license exception")
+		}
+		p.pos++
+		l.Exception = exception
+	}
+	return e, nil
+}
+
+func (p *parser) atom() (Expression, error) {
+	t := p.peek()
+	switch {
+	case t == "(":
+		p.pos++
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("Unbalanced parenthesis")
+		}
+		p.pos++
+		return e, nil
+	case isIdentifier(t):
+		p.pos++
+		return &License{ID: t}, nil
+	}
+	return nil, errors.New("Unexpected token " + t)
+}
+
+func isIdentifier(t string) bool {
+	switch strings.ToUpper(t) {
+	case "", "(", ")", "AND", "OR", "WITH":
+		return false
+	}
+	return true
+}
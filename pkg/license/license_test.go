@@ -0,0 +1,107 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package license_test
+
+import (
+	"github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/license"
+	pkg "github.com/mudler/luet/pkg/package"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("License", func() {
+	withLicense := func(name, l string) pkg.Package {
+		p := pkg.NewPackage(name, "1.0", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+		p.SetCategory("app")
+		p.SetLicense(l)
+		return p
+	}
+
+	Context("Expressions", func() {
+		It("parses compound expressions", func() {
+			e := Parse("(MIT or Apache-2.0) AND GPL-2.0-only WITH Classpath-exception-2.0")
+			Expect(e.Licenses()).To(Equal([]string{"MIT", "Apache-2.0", "GPL-2.0-only WITH Classpath-exception-2.0"}))
+		})
+
+		It("considers free text a single license", func() {
+			e := Parse("Some custom (license")
+			Expect(e.Licenses()).To(Equal([]string{"Some custom (license"}))
+		})
+
+		It("is satisfied by any accepted choice", func() {
+			accept := func(id string) bool { return id == "MIT" }
+
+			ok, _ := Parse("MIT OR GPL-3.0").Satisfied(accept)
+			Expect(ok).To(BeTrue())
+
+			ok, rejected := Parse("MIT AND GPL-3.0").Satisfied(accept)
+			Expect(ok).To(BeFalse())
+			Expect(rejected).To(Equal([]string{"GPL-3.0"}))
+		})
+	})
+
+	Context("Policy", func() {
+		It("accepts licenses matching the allowed patterns and not denied", func() {
+			p := NewPolicy(&config.LuetLicensePolicy{Allowed: []string{"bsd-*", "GPL-2.0*"}, Denied: []string{"BSD-4-Clause"}})
+			Expect(p.Accepts("BSD-3-Clause")).To(BeTrue())
+			Expect(p.Accepts("BSD-4-Clause")).To(BeFalse())
+			Expect(p.Accepts("GPL-2.0-only WITH Classpath-exception-2.0")).To(BeTrue())
+			Expect(p.Accepts("MIT")).To(BeFalse())
+		})
+
+		It("reports the violating packages", func() {
+			p := NewPolicy(&config.LuetLicensePolicy{Denied: []string{"GPL-3.0*"}, RequireLicense: true})
+			violations := p.Check(pkg.Packages{
+				withLicense("a", "MIT"),
+				withLicense("b", "GPL-3.0-only"),
+				withLicense("c", "GPL-3.0-only OR MIT"),
+				withLicense("d", ""),
+			})
+			Expect(len(violations)).To(Equal(2))
+			Expect(violations[0].Package.GetName()).To(Equal("b"))
+			Expect(violations[0].Rejected).To(Equal([]string{"GPL-3.0-only"}))
+			Expect(violations[1].Package.GetName()).To(Equal("d"))
+			Expect(violations[1].String()).To(ContainSubstring("declares no license"))
+		})
+
+		It("fails only in fail mode", func() {
+			packs := pkg.Packages{withLicense("a", "GPL-3.0")}
+			policy := &config.LuetLicensePolicy{Allowed: []string{"MIT"}, Mode: ModeWarn}
+			Expect(NewPolicy(policy).Enforce(packs)).ToNot(HaveOccurred())
+
+			policy.Mode = ModeFail
+			Expect(NewPolicy(policy).Enforce(packs)).To(HaveOccurred())
+			Expect(NewPolicy(policy).Enforce(pkg.Packages{withLicense("b", "MIT")})).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("Report", func() {
+		It("groups the packages by license", func() {
+			report := Report(pkg.Packages{
+				withLicense("a", "MIT"),
+				withLicense("b", "MIT OR Apache-2.0"),
+				withLicense("c", ""),
+			})
+			Expect(report).To(Equal([]Usage{
+				{License: "", Packages: []string{"app/c-1.0"}},
+				{License: "Apache-2.0", Packages: []string{"app/b-1.0"}},
+				{License: "MIT", Packages: []string{"app/a-1.0", "app/b-1.0"}},
+			}))
+		})
+	})
+})
@@ -0,0 +1,169 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package license
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mudler/luet/pkg/config"
+	. "github.com/mudler/luet/pkg/logger"
+	pkg "github.com/mudler/luet/pkg/package"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ModeWarn = "warn"
+	ModeFail = "fail"
+)
+
+// Policy lists the licenses packages can be distributed or installed with
+type Policy struct {
+	Allowed        []string
+	Denied         []string
+	RequireLicense bool
+	Fail           bool
+}
+
+// Violation is a package not complying with the policy
+type Violation struct {
+	Package pkg.Package
+	License string
+	// Rejected are the licenses of the expression which are not accepted
+	Rejected []string
+}
+
+// Usage is a license along with the packages declaring it
+type Usage struct {
+	License  string   `json:"license"`
+	Packages []string `json:"packages"`
+}
+
+func NewPolicy(c *config.LuetLicensePolicy) *Policy {
+	return &Policy{
+		Allowed:        c.Allowed,
+		Denied:         c.Denied,
+		RequireLicense: c.RequireLicense,
+		Fail:           c.Mode == ModeFail,
+	}
+}
+
+// Empty returns true if the policy has no rules
+func (p *Policy) Empty() bool {
+	return len(p.Allowed) == 0 && len(p.Denied) == 0 && !p.RequireLicense
+}
+
+// Accepts returns true if the license identifier is not denied, and it is
+// allowed if an allow list is given
+func (p *Policy) Accepts(id string) bool {
+	if matchAny(p.Denied, id) {
+		return false
+	}
+	return len(p.Allowed) == 0 || matchAny(p.Allowed, id)
+}
+
+// Check returns the packages which licenses are not accepted by the policy
+func (p *Policy) Check(packs pkg.Packages) []Violation {
+	var ans []Violation
+	for _, pack := range packs {
+		l := strings.TrimSpace(pack.GetLicense())
+		if l == "" {
+			if p.RequireLicense {
+				ans = append(ans, Violation{Package: pack})
+			}
+			continue
+		}
+		if ok, rejected := Parse(l).Satisfied(p.Accepts); !ok {
+			ans = append(ans, Violation{Package: pack, License: l, Rejected: rejected})
+		}
+	}
+	sort.SliceStable(ans, func(i, j int) bool {
+		return ans[i].Package.HumanReadableString() < ans[j].Package.HumanReadableString()
+	})
+	return ans
+}
+
+// Enforce reports the packages violating the policy, and returns an error if
+// the policy is set to fail.
+func (p *Policy) Enforce(packs pkg.Packages) error {
+	if p.Empty() {
+		return nil
+	}
+	violations := p.Check(packs)
+	for _, v := range violations {
+		Warning(":scroll: License policy:", v.String())
+	}
+	if len(violations) > 0 && p.Fail {
+		return errors.Errorf("%d packages violate the license policy", len(violations))
+	}
+	return nil
+}
+
+func (v Violation) String() string {
+	if v.License == "" {
+		return v.Package.HumanReadableString() + " declares no license"
+	}
+	return v.Package.HumanReadableString() + " is licensed under '" + v.License + "', not accepting " + strings.Join(v.Rejected, ", ")
+}
+
+// Report returns the licenses of the packages, along with the packages
+// declaring them. Packages without a license are listed under an empty one.
+func Report(packs pkg.Packages) []Usage {
+	usage := map[string][]string{}
+	for _, p := range packs {
+		l := strings.TrimSpace(p.GetLicense())
+		if l == "" {
+			usage[""] = append(usage[""], p.HumanReadableString())
+			continue
+		}
+		seen := map[string]bool{}
+		for _, id := range Parse(l).Licenses() {
+			if !seen[id] {
+				seen[id] = true
+				usage[id] = append(usage[id], p.HumanReadableString())
+			}
+		}
+	}
+
+	ans := []Usage{}
+	for l, packages := range usage {
+		sort.Strings(packages)
+		ans = append(ans, Usage{License: l, Packages: packages})
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].License < ans[j].License
+	})
+	return ans
+}
+
+// matchAny returns true if the license matches any of the patterns. Licenses
+// with an exception also match the patterns of the license alone.
+func matchAny(patterns []string, id string) bool {
+	candidates := []string{strings.ToLower(id)}
+	if i := strings.Index(strings.ToUpper(id), " WITH "); i > 0 {
+		candidates = append(candidates, strings.ToLower(id[:i]))
+	}
+	for _, pattern := range patterns {
+		for _, c := range candidates {
+			if ok, _ := path.Match(strings.ToLower(pattern), c); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
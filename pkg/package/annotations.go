@@ -20,4 +20,7 @@ type AnnotationKey string
 
 const (
 	ConfigProtectAnnnotation AnnotationKey = "config_protect"
+	// SubpackageAnnotation marks packages split from the build of another
+	// one, its value is the fingerprint of the package built.
+	SubpackageAnnotation AnnotationKey = "subpackage_of"
 )
@@ -368,7 +368,8 @@ func (db *BoltDatabase) FindPackageCandidate(p Package) (Package, error) {
 
 }
 
-// FindPackages return the list of the packages beloging to cat/name  (any versions in requested range)
+// FindPackages return the list of the packages beloging to cat/name  (any versions in requested range),
+// in the requested slot if any
 // FIXME: Optimize, see inmemorydb
 func (db *BoltDatabase) FindPackages(p Package) (Packages, error) {
 	if !p.IsSelector() {
@@ -379,6 +380,7 @@ func (db *BoltDatabase) FindPackages(p Package) (Packages, error) {
 		return []Package{pack}, nil
 	}
 
+	slot := p.GetSlot()
 	// Provides: Treat as the replaced package here
 	if provided, err := db.getProvide(p); err == nil {
 		p = provided
@@ -389,7 +391,7 @@ func (db *BoltDatabase) FindPackages(p Package) (Packages, error) {
 
 	var versionsInWorld []Package
 	for _, w := range db.World() {
-		if w.GetName() != p.GetName() || w.GetCategory() != p.GetCategory() {
+		if w.GetName() != p.GetName() || w.GetCategory() != p.GetCategory() || !w.MatchSlot(slot) {
 			continue
 		}
 
@@ -326,7 +326,8 @@ func (db *InMemoryDatabase) FindPackageVersions(p Package) (Packages, error) {
 	return Packages(versionsInWorld), nil
 }
 
-// FindPackages return the list of the packages beloging to cat/name (any versions in requested range)
+// FindPackages return the list of the packages beloging to cat/name (any versions in requested range),
+// in the requested slot if any
 func (db *InMemoryDatabase) FindPackages(p Package) (Packages, error) {
 	if !p.IsSelector() {
 		pack, err := db.FindPackage(p)
@@ -335,6 +336,7 @@ func (db *InMemoryDatabase) FindPackages(p Package) (Packages, error) {
 		}
 		return []Package{pack}, nil
 	}
+	slot := p.GetSlot()
 	// Provides: Treat as the replaced package here
 	if provided, err := db.getProvide(p); err == nil {
 		p = provided
@@ -362,6 +364,9 @@ func (db *InMemoryDatabase) FindPackages(p Package) (Packages, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "Cache mismatch - this shouldn't happen")
 		}
+		if !w.MatchSlot(slot) {
+			continue
+		}
 		versionsInWorld = append(versionsInWorld, w)
 	}
 	return Packages(versionsInWorld), nil
@@ -374,9 +379,12 @@ func (db *InMemoryDatabase) UpdatePackage(p Package) error {
 		return err
 	}
 
-	return db.Set(p.GetFingerPrint(), enc)
-
-	return errors.New(fmt.Sprintf("Package not found: %s", p.HumanReadableString()))
+	if err := db.Set(p.GetFingerPrint(), enc); err != nil {
+		return err
+	}
+	// Requires might have changed along with the use flags
+	db.populateCaches(p)
+	return nil
 }
 
 func (db *InMemoryDatabase) GetPackages() []string {
@@ -56,6 +56,11 @@ type Package interface {
 
 	GetRequires() []*DefaultPackage
 	GetConflicts() []*DefaultPackage
+
+	GetRequiresIf() map[string][]*DefaultPackage
+	GetConflictsIf() map[string][]*DefaultPackage
+	RequiresIf(map[string][]*DefaultPackage) Package
+	ConflictsIf(map[string][]*DefaultPackage) Package
 	Expand(PackageDatabase) (Packages, error)
 	SetCategory(string)
 
@@ -72,6 +77,8 @@ type Package interface {
 	AddUse(use string)
 	RemoveUse(use string)
 	GetUses() []string
+	HasUseFlag(string) bool
+	MatchUses([]string) bool
 
 	Yaml() ([]byte, error)
 	Explain()
@@ -107,10 +114,23 @@ type Package interface {
 	String() string
 	HumanReadableString() string
 	HashFingerprint(string) string
+	GetArtifactFingerPrint() string
 
 	SetBuildTimestamp(s string)
 	GetBuildTimestamp() string
 
+	GetArch() string
+	SetArch(string)
+	MatchArch(string) bool
+
+	GetVariant() string
+	SetVariant(string)
+	MatchVariant(string) bool
+
+	GetSlot() string
+	SetSlot(string)
+	MatchSlot(string) bool
+
 	Clone() Package
 }
 
@@ -220,7 +240,13 @@ type DefaultPackage struct {
 	PackageRequires  []*DefaultPackage `json:"requires"`           // Affects YAML field names too.
 	PackageConflicts []*DefaultPackage `json:"conflicts"`          // Affects YAML field names too.
 	Provides         []*DefaultPackage `json:"provides,omitempty"` // Affects YAML field names too.
-	Hidden           bool              `json:"hidden,omitempty"`   // Affects YAML field names too.
+
+	// PackageRequiresIf and PackageConflictsIf are the requires and conflicts
+	// which apply only when the use flag they are listed under is enabled
+	PackageRequiresIf  map[string][]*DefaultPackage `json:"requires_if,omitempty"`  // Affects YAML field names too.
+	PackageConflictsIf map[string][]*DefaultPackage `json:"conflicts_if,omitempty"` // Affects YAML field names too.
+
+	Hidden bool `json:"hidden,omitempty"` // Affects YAML field names too.
 
 	// Annotations are used for core features/options
 	Annotations map[string]string `json:"annotations,omitempty"` // Affects YAML field names too
@@ -234,6 +260,18 @@ type DefaultPackage struct {
 	BuildTimestamp string   `json:"buildtimestamp,omitempty"`
 
 	Labels map[string]string `json:"labels,omitempty"` // Affects YAML field names too.
+
+	// Arch is the architecture the package artifact was built for.
+	// Packages without an architecture can be installed everywhere.
+	Arch string `json:"arch,omitempty"`
+
+	// Variant is the build variant of the package artifact, built with its
+	// own values. Packages without a variant can be installed everywhere.
+	Variant string `json:"variant,omitempty"`
+
+	// Slot allows versions of the package in different slots to be installed
+	// side by side. Requires with a slot match only the versions in it.
+	Slot string `json:"slot,omitempty"`
 }
 
 // State represent the package state
@@ -264,6 +302,21 @@ func (p *DefaultPackage) GetFingerPrint() string {
 	return fmt.Sprintf("%s-%s-%s", p.Name, p.Category, p.Version)
 }
 
+// GetArtifactFingerPrint returns the fingerprint used to name the package
+// artifacts, which includes the variant and the architecture if any. This
+// allows a repository to host the artifacts of the same package for different
+// variants and architectures.
+func (p *DefaultPackage) GetArtifactFingerPrint() string {
+	fp := p.GetFingerPrint()
+	if p.Variant != "" {
+		fp = fmt.Sprintf("%s-%s", fp, p.Variant)
+	}
+	if p.Arch != "" {
+		fp = fmt.Sprintf("%s-%s", fp, p.Arch)
+	}
+	return fp
+}
+
 func (p *DefaultPackage) HashFingerprint(salt string) string {
 	h := md5.New()
 	io.WriteString(h, fmt.Sprintf("%s-%s", p.GetFingerPrint(), salt))
@@ -288,6 +341,53 @@ func (p *DefaultPackage) GetPackageName() string {
 	return fmt.Sprintf("%s-%s", p.Name, p.Category)
 }
 
+// GetArch returns the package architecture
+func (p *DefaultPackage) GetArch() string {
+	return p.Arch
+}
+
+// SetArch sets the package architecture
+func (p *DefaultPackage) SetArch(arch string) {
+	p.Arch = arch
+}
+
+// MatchArch returns true if the package can be installed on the given architecture
+func (p *DefaultPackage) MatchArch(arch string) bool {
+	return p.Arch == "" || arch == "" || p.Arch == arch
+}
+
+// GetVariant returns the package build variant
+func (p *DefaultPackage) GetVariant() string {
+	return p.Variant
+}
+
+// SetVariant sets the package build variant
+func (p *DefaultPackage) SetVariant(variant string) {
+	p.Variant = variant
+}
+
+// MatchVariant returns true if the package can be installed on systems
+// using the given variant
+func (p *DefaultPackage) MatchVariant(variant string) bool {
+	return p.Variant == "" || p.Variant == variant
+}
+
+// GetSlot returns the package slot
+func (p *DefaultPackage) GetSlot() string {
+	return p.Slot
+}
+
+// SetSlot sets the package slot
+func (p *DefaultPackage) SetSlot(slot string) {
+	p.Slot = slot
+}
+
+// MatchSlot returns true if the package is in the given slot, or if no slot
+// is given
+func (p *DefaultPackage) MatchSlot(slot string) bool {
+	return slot == "" || p.Slot == slot
+}
+
 // GetBuildTimestamp returns the package build timestamp
 func (p *DefaultPackage) GetBuildTimestamp() string {
 	return p.BuildTimestamp
@@ -417,6 +517,39 @@ func (p *DefaultPackage) SetName(s string) {
 func (p *DefaultPackage) GetUses() []string {
 	return p.UseFlags
 }
+
+// HasUseFlag returns true if the package is affected by the use flag: it is
+// enabled by default, or it enables requires or conflicts
+func (p *DefaultPackage) HasUseFlag(use string) bool {
+	if _, ok := p.PackageRequiresIf[use]; ok {
+		return true
+	}
+	if _, ok := p.PackageConflictsIf[use]; ok {
+		return true
+	}
+	for _, u := range p.UseFlags {
+		if u == use {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchUses returns true if the package was built with the same use flags
+// enabled, in any order
+func (p *DefaultPackage) MatchUses(uses []string) bool {
+	enabled := map[string]bool{}
+	for _, u := range uses {
+		enabled[u] = true
+	}
+	for _, u := range p.UseFlags {
+		if !enabled[u] {
+			return false
+		}
+		delete(enabled, u)
+	}
+	return len(enabled) == 0
+}
 func (p *DefaultPackage) AddLabel(k, v string) {
 	if p.Labels == nil {
 		p.Labels = make(map[string]string, 0)
@@ -442,11 +575,43 @@ func (p *DefaultPackage) SetProvides(req []*DefaultPackage) Package {
 	p.Provides = req
 	return p
 }
+
+// GetRequires returns the packages required, along with the ones required
+// by the enabled use flags
 func (p *DefaultPackage) GetRequires() []*DefaultPackage {
-	return p.PackageRequires
+	return p.withUses(p.PackageRequires, p.PackageRequiresIf)
 }
+
+// GetConflicts returns the packages in conflict, along with the ones in
+// conflict with the enabled use flags
 func (p *DefaultPackage) GetConflicts() []*DefaultPackage {
-	return p.PackageConflicts
+	return p.withUses(p.PackageConflicts, p.PackageConflictsIf)
+}
+
+func (p *DefaultPackage) withUses(deps []*DefaultPackage, conditional map[string][]*DefaultPackage) []*DefaultPackage {
+	var extra []*DefaultPackage
+	for _, u := range p.UseFlags {
+		extra = append(extra, conditional[u]...)
+	}
+	if len(extra) == 0 {
+		return deps
+	}
+	return append(append([]*DefaultPackage{}, deps...), extra...)
+}
+
+func (p *DefaultPackage) GetRequiresIf() map[string][]*DefaultPackage {
+	return p.PackageRequiresIf
+}
+func (p *DefaultPackage) GetConflictsIf() map[string][]*DefaultPackage {
+	return p.PackageConflictsIf
+}
+func (p *DefaultPackage) RequiresIf(req map[string][]*DefaultPackage) Package {
+	p.PackageRequiresIf = req
+	return p
+}
+func (p *DefaultPackage) ConflictsIf(req map[string][]*DefaultPackage) Package {
+	p.PackageConflictsIf = req
+	return p
 }
 func (p *DefaultPackage) Requires(req []*DefaultPackage) Package {
 	p.PackageRequires = req
@@ -621,6 +786,17 @@ func (set Packages) Best(v version.Versioner) Package {
 	return versionsMap[sorted[len(sorted)-1]]
 }
 
+// InSlot returns the packages of the set in the given slot
+func (set Packages) InSlot(slot string) Packages {
+	var result Packages
+	for _, p := range set {
+		if p.GetSlot() == slot {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
 func (set Packages) Unique() Packages {
 	var result Packages
 	uniq := make(map[string]Package)
@@ -652,6 +828,7 @@ func (pack *DefaultPackage) buildFormula(definitiondb PackageDatabase, db Packag
 	var formulas []bf.Formula
 
 	// Do conflict with other packages versions (if A is selected, then conflict with other versions of A)
+	// in the same slot, as versions in different slots can be installed together
 	packages, _ := definitiondb.FindPackageVersions(p)
 	if len(packages) > 0 {
 		for _, cp := range packages {
@@ -660,7 +837,7 @@ func (pack *DefaultPackage) buildFormula(definitiondb PackageDatabase, db Packag
 				return nil, err
 			}
 			B := bf.Var(encodedB)
-			if !p.Matches(cp) {
+			if !p.Matches(cp) && p.GetSlot() == cp.GetSlot() {
 				formulas = append(formulas, bf.Or(bf.Not(A), bf.Or(bf.Not(A), bf.Not(B))))
 			}
 		}
@@ -693,7 +870,7 @@ func (pack *DefaultPackage) buildFormula(definitiondb PackageDatabase, db Packag
 							return nil, err
 						}
 						B := bf.Var(encodedB)
-						if !o.Matches(c) {
+						if !o.Matches(c) && o.GetSlot() == c.GetSlot() {
 							priorityConstraints = append(priorityConstraints, bf.Not(B))
 							priorityALO = append(priorityALO, B)
 						}
@@ -708,7 +885,7 @@ func (pack *DefaultPackage) buildFormula(definitiondb PackageDatabase, db Packag
 					formulas = append(formulas, bf.Or(bf.Not(A), bf.Or(bf.And(C, bf.Or(priorityConstraints...)), bf.And(bf.Not(C), bf.Or(priorityALO...)))))
 				}
 
-				// AMO - At most one
+				// AMO - At most one, for each slot
 				for _, o := range packages {
 					encodedB, err := o.Encode(db)
 					if err != nil {
@@ -722,7 +899,7 @@ func (pack *DefaultPackage) buildFormula(definitiondb PackageDatabase, db Packag
 							return nil, err
 						}
 						I := bf.Var(encodedI)
-						if !o.Matches(i) {
+						if !o.Matches(i) && o.GetSlot() == i.GetSlot() {
 							formulas = append(formulas, bf.Or(bf.Not(A), bf.Or(bf.Not(I), bf.Not(B))))
 						}
 					}
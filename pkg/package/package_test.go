@@ -462,4 +462,101 @@ var _ = Describe("Package", func() {
 		})
 	})
 
+	Context("Architecture", func() {
+		It("Names artifacts by architecture", func() {
+			p := &DefaultPackage{Name: "A", Category: "test", Version: "1.0"}
+			Expect(p.GetArtifactFingerPrint()).To(Equal(p.GetFingerPrint()))
+			Expect(p.MatchArch("arm64")).To(BeTrue())
+
+			p.SetArch("amd64")
+			Expect(p.GetArtifactFingerPrint()).To(Equal("A-test-1.0-amd64"))
+			Expect(p.GetFingerPrint()).To(Equal("A-test-1.0"))
+			Expect(p.MatchArch("amd64")).To(BeTrue())
+			Expect(p.MatchArch("arm64")).To(BeFalse())
+		})
+	})
+
+	Context("Variants", func() {
+		It("Names artifacts by variant", func() {
+			p := &DefaultPackage{Name: "A", Category: "test", Version: "1.0"}
+			Expect(p.MatchVariant("clang")).To(BeTrue())
+
+			p.SetVariant("gcc")
+			Expect(p.GetArtifactFingerPrint()).To(Equal("A-test-1.0-gcc"))
+			p.SetArch("amd64")
+			Expect(p.GetArtifactFingerPrint()).To(Equal("A-test-1.0-gcc-amd64"))
+			Expect(p.GetFingerPrint()).To(Equal("A-test-1.0"))
+			Expect(p.MatchVariant("gcc")).To(BeTrue())
+			Expect(p.MatchVariant("clang")).To(BeFalse())
+			Expect(p.MatchVariant("")).To(BeFalse())
+		})
+	})
+
+	Context("Use flags", func() {
+		It("Requires and conflicts by the enabled flags", func() {
+			b := &DefaultPackage{Name: "B", Category: "test", Version: "1.0"}
+			c := &DefaultPackage{Name: "C", Category: "test", Version: "1.0"}
+			a := &DefaultPackage{Name: "A", Category: "test", Version: "1.0", PackageRequires: []*DefaultPackage{b}}
+			a.RequiresIf(map[string][]*DefaultPackage{"ssl": {c}})
+			a.ConflictsIf(map[string][]*DefaultPackage{"static": {b}})
+
+			Expect(a.GetRequires()).To(Equal([]*DefaultPackage{b}))
+			Expect(a.GetConflicts()).To(BeEmpty())
+			Expect(a.HasUseFlag("ssl")).To(BeTrue())
+			Expect(a.HasUseFlag("doc")).To(BeFalse())
+
+			a.AddUse("ssl")
+			a.AddUse("static")
+			Expect(a.GetRequires()).To(Equal([]*DefaultPackage{b, c}))
+			Expect(a.GetConflicts()).To(Equal([]*DefaultPackage{b}))
+			Expect(a.PackageRequires).To(Equal([]*DefaultPackage{b}))
+
+			Expect(a.MatchUses([]string{"static", "ssl"})).To(BeTrue())
+			Expect(a.MatchUses([]string{"ssl"})).To(BeFalse())
+			Expect(a.MatchUses([]string{"ssl", "static", "doc"})).To(BeFalse())
+		})
+
+		It("Applies the flags selected", func() {
+			a := &DefaultPackage{Name: "A", Category: "test", Version: "1.0", UseFlags: []string{"doc"}}
+			a.RequiresIf(map[string][]*DefaultPackage{"ssl": {}})
+			b := &DefaultPackage{Name: "B", Category: "test", Version: "1.0"}
+
+			uses := &UseFlags{}
+			Expect(uses.Add("ssl", "-doc", "test/B:http2", "test/A:-ssl")).ToNot(HaveOccurred())
+			Expect(uses.Global).To(Equal([]string{"ssl", "-doc"}))
+			Expect(uses.Packages).To(Equal(map[string][]string{"test/B": {"http2"}, "test/A": {"-ssl"}}))
+			Expect(uses.Add("test/A:")).To(HaveOccurred())
+			Expect(uses.Add("-")).To(HaveOccurred())
+
+			Expect(uses.Apply(a)).To(BeTrue())
+			Expect(a.GetUses()).To(BeEmpty())
+
+			// Global flags don't apply to packages not affected by them
+			Expect(uses.Apply(b)).To(BeTrue())
+			Expect(b.GetUses()).To(Equal([]string{"http2"}))
+			Expect(uses.Apply(b)).To(BeFalse())
+		})
+
+		It("Applies the flags to the packages of a database", func() {
+			db := NewInMemoryDatabase(false)
+			c := &DefaultPackage{Name: "C", Category: "test", Version: "1.0"}
+			a := &DefaultPackage{Name: "A", Category: "test", Version: "1.0"}
+			a.RequiresIf(map[string][]*DefaultPackage{"ssl": {c}})
+			for _, p := range []Package{a, c} {
+				_, err := db.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			uses := &UseFlags{Global: []string{"ssl"}}
+			Expect(uses.ApplyDatabase(db)).ToNot(HaveOccurred())
+
+			p, err := db.FindPackage(a)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.GetUses()).To(Equal([]string{"ssl"}))
+			p, err = db.FindPackage(c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.GetUses()).To(BeEmpty())
+			Expect(db.GetRevdeps(c)).To(HaveLen(1))
+		})
+	})
 })
@@ -0,0 +1,105 @@
+// Copyright © 2019-2020 Ettore Di Giacinto <mudler@gentoo.org>
+//                       Daniele Rondina <geaaru@sabayonlinux.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package pkg
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UseFlags are the use flags selected for the packages, flags prefixed with
+// "-" are disabled. Global flags apply to all the packages affected by them,
+// the flags of a package (by category/name) apply after them, to that package
+// only.
+type UseFlags struct {
+	Global   []string            `json:"global,omitempty" yaml:"global,omitempty" mapstructure:"global"`
+	Packages map[string][]string `json:"packages,omitempty" yaml:"packages,omitempty" mapstructure:"packages"`
+}
+
+// Add adds the flags given in the command line format: either "flag",
+// "-flag", or "category/name:flag" for a single package.
+func (u *UseFlags) Add(flags ...string) error {
+	for _, f := range flags {
+		pack := ""
+		if i := strings.LastIndex(f, ":"); i != -1 {
+			pack, f = f[:i], f[i+1:]
+		}
+		if strings.TrimPrefix(f, "-") == "" {
+			return errors.New("Invalid use flag '" + f + "'")
+		}
+		if pack == "" {
+			u.Global = append(u.Global, f)
+			continue
+		}
+		if u.Packages == nil {
+			u.Packages = map[string][]string{}
+		}
+		u.Packages[pack] = append(u.Packages[pack], f)
+	}
+	return nil
+}
+
+// Apply enables and disables the selected flags on the package, and returns
+// true if its flags changed
+func (u *UseFlags) Apply(p Package) bool {
+	before := append([]string{}, p.GetUses()...)
+	for _, f := range u.Global {
+		if p.HasUseFlag(strings.TrimPrefix(f, "-")) {
+			setUse(p, f)
+		}
+	}
+	for _, f := range u.Packages[p.GetCategory()+"/"+p.GetName()] {
+		setUse(p, f)
+	}
+	return !p.MatchUses(before)
+}
+
+// ApplyDatabase applies the selected flags to all the packages of the
+// database
+func (u *UseFlags) ApplyDatabase(db PackageDatabase) error {
+	if len(u.Global) == 0 && len(u.Packages) == 0 {
+		return nil
+	}
+	for _, p := range db.World() {
+		if !u.Apply(p) {
+			continue
+		}
+		if err := db.UpdatePackage(p); err != nil {
+			return errors.Wrap(err, "Failed setting use flags of "+p.HumanReadableString())
+		}
+	}
+	return nil
+}
+
+func setUse(p Package, f string) {
+	if strings.HasPrefix(f, "-") {
+		p.RemoveUse(strings.TrimPrefix(f, "-"))
+	} else {
+		p.AddUse(f)
+	}
+}
+
+// UseValues returns the template values of the use flags enabled on the
+// package, available to its build spec as {{ .Values.use.<flag> }}
+func UseValues(p Package) map[string]interface{} {
+	use := map[string]interface{}{}
+	for _, u := range p.GetUses() {
+		use[u] = true
+	}
+	return map[string]interface{}{"use": use}
+}
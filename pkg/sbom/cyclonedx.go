@@ -0,0 +1,155 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/compiler"
+)
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string    `json:"timestamp"`
+	Tools     []cdxTool `json:"tools"`
+}
+
+type cdxTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	License cdxLicenseName `json:"license"`
+}
+
+type cdxLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cdxReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxComponent struct {
+	BOMRef             string         `json:"bom-ref,omitempty"`
+	Type               string         `json:"type"`
+	Group              string         `json:"group,omitempty"`
+	Name               string         `json:"name"`
+	Version            string         `json:"version,omitempty"`
+	Description        string         `json:"description,omitempty"`
+	Licenses           []cdxLicense   `json:"licenses,omitempty"`
+	Hashes             []cdxHash      `json:"hashes,omitempty"`
+	Purl               string         `json:"purl,omitempty"`
+	ExternalReferences []cdxReference `json:"externalReferences,omitempty"`
+	Components         []cdxComponent `json:"components,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// CycloneDX returns the document in the CycloneDX 1.2 JSON format. The files of
+// each package are listed as its sub-components.
+func (d *Document) CycloneDX() ([]byte, error) {
+	tool := cdxTool{Name: d.Tool}
+	if i := strings.Index(d.Tool, "-"); i > 0 {
+		tool = cdxTool{Name: d.Tool[:i], Version: d.Tool[i+1:]}
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.2",
+		SerialNumber: "urn:uuid:" + uuid,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: d.Created.Format(time.RFC3339),
+			Tools:     []cdxTool{tool},
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+
+	for _, c := range d.Components {
+		p := c.Package
+		cc := cdxComponent{
+			BOMRef:      c.ID(),
+			Type:        "library",
+			Group:       p.GetCategory(),
+			Name:        p.GetName(),
+			Version:     p.GetVersion(),
+			Description: p.GetDescription(),
+			Hashes:      cdxHashes(c.Checksums),
+			Purl:        "pkg:generic/" + p.GetCategory() + "/" + p.GetName() + "@" + p.GetVersion(),
+		}
+		if p.GetArch() != "" {
+			cc.Purl += "?arch=" + p.GetArch()
+		}
+		if l := p.GetLicense(); l != "" {
+			cc.Licenses = []cdxLicense{{License: cdxLicenseName{Name: l}}}
+		}
+		for _, uri := range p.GetURI() {
+			cc.ExternalReferences = append(cc.ExternalReferences, cdxReference{Type: "website", URL: uri})
+		}
+		for _, f := range c.Files {
+			fc := cdxComponent{Type: "file", Name: f.Path}
+			if f.SHA1 != "" {
+				fc.Hashes = []cdxHash{{Alg: "SHA-1", Content: f.SHA1}, {Alg: "SHA-256", Content: f.SHA256}}
+			}
+			cc.Components = append(cc.Components, fc)
+		}
+		doc.Components = append(doc.Components, cc)
+
+		dep := cdxDependency{Ref: c.ID(), DependsOn: []string{}}
+		for _, r := range d.Dependencies(c) {
+			dep.DependsOn = append(dep.DependsOn, r.ID())
+		}
+		doc.Dependencies = append(doc.Dependencies, dep)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func cdxHashes(c compiler.Checksums) []cdxHash {
+	var ans []cdxHash
+	if sum, ok := c[string(compiler.SHA256)]; ok {
+		ans = append(ans, cdxHash{Alg: "SHA-256", Content: sum})
+	}
+	return ans
+}
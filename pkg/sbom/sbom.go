@@ -0,0 +1,237 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SPDX      = "spdx"
+	CycloneDX = "cyclonedx"
+)
+
+// File is a file shipped by a package, with its hashes if known
+type File struct {
+	Path   string
+	SHA1   string
+	SHA256 string
+}
+
+// Component is a package described by the bill of materials
+type Component struct {
+	Package pkg.Package
+	// Checksums of the package artifact, if known
+	Checksums compiler.Checksums
+	Files     []File
+}
+
+// Document is a bill of materials, which can be exported in the SPDX and
+// CycloneDX formats
+type Document struct {
+	Name    string
+	Tool    string
+	Created time.Time
+
+	Components []*Component
+}
+
+func NewDocument(name, tool string) *Document {
+	return &Document{Name: name, Tool: tool, Created: time.Now().UTC()}
+}
+
+// FromSystem describes the packages installed in the system database. If
+// target is not empty, the files installed under it are hashed.
+func FromSystem(name, tool string, db pkg.PackageDatabase, target string) (*Document, error) {
+	d := NewDocument(name, tool)
+	for _, p := range db.World() {
+		c := &Component{Package: p}
+		files, err := db.GetPackageFiles(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed getting files of "+p.HumanReadableString())
+		}
+		for _, f := range files {
+			file := File{Path: f}
+			if target != "" {
+				file.SHA1, file.SHA256, err = hashFile(filepath.Join(target, f))
+				if err != nil {
+					return nil, err
+				}
+			}
+			c.Files = append(c.Files, file)
+		}
+		d.Components = append(d.Components, c)
+	}
+	d.sort()
+	return d, nil
+}
+
+// FromArtifacts describes the packages of the given artifacts. If unpack is
+// true, the artifacts available locally are unpacked to hash their files.
+func FromArtifacts(name, tool string, artifacts []compiler.Artifact, unpack bool) (*Document, error) {
+	d := NewDocument(name, tool)
+	for _, a := range artifacts {
+		if a.GetCompileSpec() == nil || a.GetCompileSpec().GetPackage() == nil {
+			continue
+		}
+		c := &Component{Package: a.GetCompileSpec().GetPackage(), Checksums: a.GetChecksums()}
+
+		hashes := map[string][2]string{}
+		if unpack && helpers.Exists(a.GetPath()) {
+			var err error
+			hashes, err = artifactHashes(a)
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed hashing files of "+a.GetPath())
+			}
+		}
+		for _, f := range a.GetFiles() {
+			h := hashes[f]
+			c.Files = append(c.Files, File{Path: f, SHA1: h[0], SHA256: h[1]})
+		}
+		d.Components = append(d.Components, c)
+	}
+	d.sort()
+	return d, nil
+}
+
+func (d *Document) sort() {
+	sort.SliceStable(d.Components, func(i, j int) bool {
+		return d.Components[i].ID() < d.Components[j].ID()
+	})
+}
+
+// ID returns an identifier of the component unique in the document
+func (c *Component) ID() string {
+	return sanitizeID(c.Package.GetArtifactFingerPrint())
+}
+
+// Dependencies returns the components of the document required by c
+func (d *Document) Dependencies(c *Component) []*Component {
+	var ans []*Component
+	for _, r := range c.Package.GetRequires() {
+		for _, dep := range d.Components {
+			if dep.Package.GetName() != r.GetName() || dep.Package.GetCategory() != r.GetCategory() {
+				continue
+			}
+			if !r.IsSelector() && r.GetVersion() != dep.Package.GetVersion() {
+				continue
+			}
+			if r.IsSelector() {
+				if match, _ := r.SelectorMatchVersion(dep.Package.GetVersion(), nil); !match {
+					continue
+				}
+			}
+			ans = append(ans, dep)
+		}
+	}
+	return ans
+}
+
+// Export returns the document in the given format
+func (d *Document) Export(format string) ([]byte, error) {
+	switch format {
+	case SPDX:
+		return d.SPDX()
+	case CycloneDX:
+		return d.CycloneDX()
+	default:
+		return nil, errors.New("Unsupported format " + format + ", available: spdx, cyclonedx")
+	}
+}
+
+// artifactHashes unpacks the artifact in a temporary folder, and returns the
+// SHA1 and SHA256 of its regular files
+func artifactHashes(a compiler.Artifact) (map[string][2]string, error) {
+	dir, err := ioutil.TempDir("", "sbom")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	err = a.Unpack(dir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := map[string][2]string{}
+	for _, f := range a.GetFiles() {
+		sha1sum, sha256sum, err := hashFile(filepath.Join(dir, f))
+		if err != nil {
+			return nil, err
+		}
+		ans[f] = [2]string{sha1sum, sha256sum}
+	}
+	return ans, nil
+}
+
+// hashFile returns the SHA1 and SHA256 of a regular file. Other kinds of files,
+// and missing ones, have no hashes.
+func hashFile(path string) (string, string, error) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	h1 := sha1.New()
+	h256 := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), f); err != nil {
+		return "", "", errors.Wrap(err, "Failed hashing "+path)
+	}
+	return fmt.Sprintf("%x", h1.Sum(nil)), fmt.Sprintf("%x", h256.Sum(nil)), nil
+}
+
+// sanitizeID keeps only the characters allowed in SPDX identifiers
+func sanitizeID(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed generating uuid")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,162 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/compiler"
+	pkg "github.com/mudler/luet/pkg/package"
+	. "github.com/mudler/luet/pkg/sbom"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SBOM", func() {
+	a := &pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0", License: "MIT", Uri: []string{"https://example.com/a"},
+		PackageRequires: []*pkg.DefaultPackage{{Name: "b", Category: "test", Version: ">=1.0"}}}
+	b := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.1", License: "GPL-2.0"}
+
+	Context("Installed system", func() {
+		var target string
+		var db pkg.PackageDatabase
+
+		BeforeEach(func() {
+			var err error
+			target, err = ioutil.TempDir("", "target")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(target, "a"), []byte("a"), 0644)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(target, "b"), []byte("b"), 0644)).ToNot(HaveOccurred())
+
+			db = pkg.NewInMemoryDatabase(false)
+			for _, p := range []*pkg.DefaultPackage{a, b} {
+				_, err := db.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(db.SetPackageFiles(&pkg.PackageFile{PackageFingerprint: p.GetFingerPrint(), Files: []string{p.GetName()}})).ToNot(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(target)
+		})
+
+		It("Exports SPDX documents", func() {
+			doc, err := FromSystem("system", "luet-test", db, target)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := doc.Export(SPDX)
+			Expect(err).ToNot(HaveOccurred())
+
+			var spdx map[string]interface{}
+			Expect(json.Unmarshal(data, &spdx)).ToNot(HaveOccurred())
+			Expect(spdx["spdxVersion"]).To(Equal("SPDX-2.2"))
+
+			packages := spdx["packages"].([]interface{})
+			Expect(len(packages)).To(Equal(2))
+			first := packages[0].(map[string]interface{})
+			Expect(first["name"]).To(Equal("test/a"))
+			Expect(first["licenseDeclared"]).To(Equal("MIT"))
+			Expect(first["downloadLocation"]).To(Equal("https://example.com/a"))
+			Expect(first["filesAnalyzed"]).To(BeTrue())
+
+			files := spdx["files"].([]interface{})
+			Expect(len(files)).To(Equal(2))
+			checksums := files[0].(map[string]interface{})["checksums"].([]interface{})
+			// sha256 of "a"
+			Expect(checksums[1].(map[string]interface{})["checksumValue"]).To(Equal("ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"))
+
+			Expect(spdx["relationships"]).To(ContainElement(map[string]interface{}{
+				"spdxElementId":      "SPDXRef-Package-a-test-1.0",
+				"relationshipType":   "DEPENDS_ON",
+				"relatedSpdxElement": "SPDXRef-Package-b-test-1.1",
+			}))
+		})
+
+		It("Exports CycloneDX documents", func() {
+			doc, err := FromSystem("system", "luet-test", db, "")
+			Expect(err).ToNot(HaveOccurred())
+			data, err := doc.Export(CycloneDX)
+			Expect(err).ToNot(HaveOccurred())
+
+			var cdx map[string]interface{}
+			Expect(json.Unmarshal(data, &cdx)).ToNot(HaveOccurred())
+			Expect(cdx["bomFormat"]).To(Equal("CycloneDX"))
+
+			components := cdx["components"].([]interface{})
+			Expect(len(components)).To(Equal(2))
+			Expect(components[1].(map[string]interface{})["purl"]).To(Equal("pkg:generic/test/b@1.1"))
+
+			Expect(cdx["dependencies"]).To(ContainElement(map[string]interface{}{
+				"ref":       "a-test-1.0",
+				"dependsOn": []interface{}{"b-test-1.1"},
+			}))
+		})
+
+		It("Links only the versions matching the requires", func() {
+			b09 := &pkg.DefaultPackage{Name: "b", Category: "test", Version: "0.9"}
+			_, err := db.CreatePackage(b09)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(db.SetPackageFiles(&pkg.PackageFile{PackageFingerprint: b09.GetFingerPrint(), Files: []string{}})).ToNot(HaveOccurred())
+
+			doc, err := FromSystem("system", "luet-test", db, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(doc.Components)).To(Equal(3))
+
+			for _, c := range doc.Components {
+				if c.Package.GetName() != "a" {
+					continue
+				}
+				deps := doc.Dependencies(c)
+				Expect(len(deps)).To(Equal(1))
+				Expect(deps[0].Package.GetVersion()).To(Equal("1.1"))
+			}
+		})
+
+		It("Rejects unknown formats", func() {
+			doc, err := FromSystem("system", "luet-test", db, "")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = doc.Export("xml")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Artifacts", func() {
+		It("Hashes the artifact files", func() {
+			dir, err := ioutil.TempDir("", "artifacts")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			Expect(FakeArtifact(dir, b)).ToNot(HaveOccurred())
+			dat, err := ioutil.ReadFile(filepath.Join(dir, b.GetFingerPrint()+".metadata.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			art, err := compiler.NewPackageArtifactFromYaml(dat)
+			Expect(err).ToNot(HaveOccurred())
+			art.SetPath(filepath.Join(dir, filepath.Base(art.GetPath())))
+			art.SetFiles([]string{b.GetName()})
+
+			doc, err := FromArtifacts("build", "luet-test", []compiler.Artifact{art}, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(doc.Components)).To(Equal(1))
+			Expect(doc.Components[0].Checksums).ToNot(BeEmpty())
+			Expect(len(doc.Components[0].Files)).To(Equal(1))
+			// sha256 of "1.1", the content of the fake artifact file
+			Expect(doc.Components[0].Files[0].SHA256).To(Equal("b05e244762b1e472be89a93800cc3ee326743cecb55984bf12813addb8de66d0"))
+		})
+	})
+})
@@ -0,0 +1,175 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/compiler"
+)
+
+const noAssertion = "NOASSERTION"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxPackage struct {
+	SPDXID           string         `json:"SPDXID"`
+	Name             string         `json:"name"`
+	VersionInfo      string         `json:"versionInfo"`
+	DownloadLocation string         `json:"downloadLocation"`
+	Homepage         string         `json:"homepage,omitempty"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	CopyrightText    string         `json:"copyrightText"`
+	Description      string         `json:"description,omitempty"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	HasFiles         []string       `json:"hasFiles,omitempty"`
+}
+
+type spdxFile struct {
+	SPDXID           string         `json:"SPDXID"`
+	FileName         string         `json:"fileName"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDX returns the document in the SPDX 2.2 JSON format
+func (d *Document) SPDX() ([]byte, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              d.Name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + sanitizeID(d.Name) + "-" + uuid,
+		CreationInfo: spdxCreationInfo{
+			Created:  d.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: " + d.Tool},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	for _, c := range d.Components {
+		p := c.Package
+		id := "SPDXRef-Package-" + c.ID()
+		sp := spdxPackage{
+			SPDXID:           id,
+			Name:             p.GetCategory() + "/" + p.GetName(),
+			VersionInfo:      p.GetVersion(),
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  spdxLicense(p.GetLicense()),
+			CopyrightText:    noAssertion,
+			Description:      p.GetDescription(),
+			Checksums:        spdxChecksums(c.Checksums),
+		}
+		if uri := p.GetURI(); len(uri) > 0 {
+			sp.DownloadLocation = uri[0]
+			sp.Homepage = uri[0]
+		}
+
+		// Files can be listed only if they were all hashed
+		analyzed := len(c.Files) > 0
+		for _, f := range c.Files {
+			if f.SHA1 == "" {
+				analyzed = false
+			}
+		}
+		if analyzed {
+			sp.FilesAnalyzed = true
+			for _, f := range c.Files {
+				fid := "SPDXRef-File-" + c.ID() + "-" + sanitizeID(f.Path)
+				sp.HasFiles = append(sp.HasFiles, fid)
+				doc.Files = append(doc.Files, spdxFile{
+					SPDXID:   fid,
+					FileName: "./" + strings.TrimPrefix(f.Path, "/"),
+					Checksums: []spdxChecksum{
+						{Algorithm: "SHA1", ChecksumValue: f.SHA1},
+						{Algorithm: "SHA256", ChecksumValue: f.SHA256},
+					},
+					LicenseConcluded: noAssertion,
+					CopyrightText:    noAssertion,
+				})
+			}
+		}
+		doc.Packages = append(doc.Packages, sp)
+
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: id,
+		})
+		for _, dep := range d.Dependencies(c) {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      id,
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: "SPDXRef-Package-" + dep.ID(),
+			})
+		}
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func spdxLicense(l string) string {
+	if l == "" {
+		return noAssertion
+	}
+	return l
+}
+
+func spdxChecksums(c compiler.Checksums) []spdxChecksum {
+	var ans []spdxChecksum
+	if sum, ok := c[string(compiler.SHA256)]; ok {
+		ans = append(ans, spdxChecksum{Algorithm: "SHA256", ChecksumValue: sum})
+	}
+	return ans
+}
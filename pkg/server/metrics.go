@@ -0,0 +1,95 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/mudler/luet/pkg/logger"
+)
+
+// Metrics collects statistics about the requests served
+type Metrics struct {
+	sync.Mutex
+	start    time.Time
+	requests int64
+	bytes    int64
+	status   map[string]int64
+}
+
+type MetricsSnapshot struct {
+	Requests int64            `json:"requests"`
+	Bytes    int64            `json:"bytes"`
+	Status   map[string]int64 `json:"status"`
+	Uptime   float64          `json:"uptime_seconds"`
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{start: time.Now(), status: map[string]int64{}}
+}
+
+func (m *Metrics) record(status int, bytes int64) {
+	m.Lock()
+	defer m.Unlock()
+	m.requests++
+	m.bytes += bytes
+	m.status[strconv.Itoa(status)]++
+}
+
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.Lock()
+	defer m.Unlock()
+	s := MetricsSnapshot{
+		Requests: m.requests,
+		Bytes:    m.bytes,
+		Status:   map[string]int64{},
+		Uptime:   time.Since(m.start).Seconds(),
+	}
+	for k, v := range m.status {
+		s.Status[k] = v
+	}
+	return s
+}
+
+// Wrap records the requests served by the given handler
+func (m *Metrics) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.record(rec.status, rec.bytes)
+		Debug(r.RemoteAddr, r.Method, r.URL.Path, rec.status, rec.bytes)
+	})
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
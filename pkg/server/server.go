@@ -0,0 +1,415 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudler/luet/pkg/config"
+	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/mudler/luet/pkg/installer/client"
+	. "github.com/mudler/luet/pkg/logger"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	APIPrefix = "/api/v1/"
+
+	// DefaultMaxUploadSize is the size limit of uploads, in bytes, used when
+	// none is configured
+	DefaultMaxUploadSize int64 = 4 << 30
+)
+
+type Options struct {
+	// Dir is the repository folder served
+	Dir string
+
+	// Tokens and BasicAuth are the credentials accepted, as sent by the http client
+	// with the token and basic authentication keys. If both are empty, no
+	// authentication is required.
+	Tokens    []string
+	BasicAuth []string // "user:password"
+
+	// Upload enables publishing artifacts, which requires authentication
+	Upload bool
+	// MaxUploadSize limits the size in bytes of the uploads, so clients can't
+	// fill the temporary folder. Defaults to DefaultMaxUploadSize
+	MaxUploadSize int64
+
+	TLSCert  string
+	TLSKey   string
+	ClientCA string // Require client certificates signed by this CA
+}
+
+// RepositoryServer serves the files of a repository and exposes an API to
+// query its content.
+type RepositoryServer struct {
+	Options Options
+	Metrics *Metrics
+
+	sync.Mutex
+	repo    installer.Repository
+	repoMod time.Time
+}
+
+func NewRepositoryServer(o Options) *RepositoryServer {
+	return &RepositoryServer{Options: o, Metrics: NewMetrics()}
+}
+
+// Handler returns the http handler of the server, with authentication and
+// metrics applied to every request.
+func (s *RepositoryServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(APIPrefix+"repository", s.handleRepository)
+	mux.HandleFunc(APIPrefix+"search", s.handleSearch)
+	mux.HandleFunc(APIPrefix+"metrics", s.handleMetrics)
+	mux.HandleFunc(client.PublishPath, s.handlePublish)
+	mux.HandleFunc("/", s.handleFile)
+
+	return s.Metrics.Wrap(s.authenticate(mux))
+}
+
+func (s *RepositoryServer) ListenAndServe(address string) error {
+	srv := &http.Server{Addr: address, Handler: s.Handler()}
+
+	if s.Options.TLSCert == "" {
+		return srv.ListenAndServe()
+	}
+
+	if s.Options.ClientCA != "" {
+		ca, err := ioutil.ReadFile(s.Options.ClientCA)
+		if err != nil {
+			return errors.Wrap(err, "Failed reading client CA")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return errors.New("No valid certificate found in " + s.Options.ClientCA)
+		}
+		srv.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		}
+	}
+
+	return srv.ListenAndServeTLS(s.Options.TLSCert, s.Options.TLSKey)
+}
+
+func (s *RepositoryServer) authenticationRequired() bool {
+	return len(s.Options.Tokens) != 0 || len(s.Options.BasicAuth) != 0
+}
+
+func (s *RepositoryServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authenticationRequired() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		switch {
+		case strings.HasPrefix(auth, "token "):
+			if matchCredential(strings.TrimPrefix(auth, "token "), s.Options.Tokens) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		case strings.HasPrefix(auth, "Basic "):
+			dec, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+			if err == nil && matchCredential(string(dec), s.Options.BasicAuth) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="luet"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func matchCredential(c string, accepted []string) bool {
+	for _, a := range accepted {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(a)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// handleFile serves the repository files, supporting ETags and Range requests.
+func (s *RepositoryServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	f, err := http.Dir(s.Options.Dir).Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if info.IsDir() {
+		http.FileServer(http.Dir(s.Options.Dir)).ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// Repository returns the repository served, reloading it when it was
+// regenerated.
+func (s *RepositoryServer) Repository() (installer.Repository, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	info, err := os.Stat(path.Join(s.Options.Dir, installer.REPOSITORY_SPECFILE))
+	if err != nil {
+		return nil, errors.Wrap(err, "No repository found")
+	}
+
+	if s.repo == nil || !info.ModTime().Equal(s.repoMod) {
+		repo, err := installer.LoadLocalRepository(s.Options.Dir)
+		if err != nil {
+			return nil, err
+		}
+		// The tree is loaded in memory
+		os.RemoveAll(repo.GetMetaPath())
+		if s.repo != nil {
+			os.RemoveAll(s.repo.GetTreePath())
+		}
+		s.repo = repo
+		s.repoMod = info.ModTime()
+		Debug("Loaded repository", repo.GetName(), "revision", repo.GetRevision())
+	}
+	return s.repo, nil
+}
+
+// Close releases the resources held by the server
+func (s *RepositoryServer) Close() {
+	s.Lock()
+	defer s.Unlock()
+	if s.repo != nil {
+		os.RemoveAll(s.repo.GetTreePath())
+		s.repo = nil
+	}
+}
+
+type PackageResult struct {
+	Name       string            `json:"name"`
+	Category   string            `json:"category"`
+	Version    string            `json:"version"`
+	Repository string            `json:"repository"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Artifact   string            `json:"artifact,omitempty"`
+	Checksums  map[string]string `json:"checksums,omitempty"`
+}
+
+type RepositoryResult struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Revision    int             `json:"revision"`
+	LastUpdate  string          `json:"last_update"`
+	Packages    []PackageResult `json:"packages"`
+}
+
+func (s *RepositoryServer) handleRepository(w http.ResponseWriter, r *http.Request) {
+	repo, err := s.Repository()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := RepositoryResult{
+		Name:        repo.GetName(),
+		Description: repo.GetDescription(),
+		Revision:    repo.GetRevision(),
+		LastUpdate:  repo.GetLastUpdate(),
+		Packages:    []PackageResult{},
+	}
+	for _, a := range repo.GetIndex() {
+		p := a.GetCompileSpec().GetPackage()
+		res.Packages = append(res.Packages, PackageResult{
+			Name:       p.GetName(),
+			Category:   p.GetCategory(),
+			Version:    p.GetVersion(),
+			Repository: repo.GetName(),
+			Labels:     p.GetLabels(),
+			Artifact:   path.Base(a.GetPath()),
+			Checksums:  a.GetChecksums(),
+		})
+	}
+
+	writeJSON(w, res)
+}
+
+func (s *RepositoryServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	repo, err := s.Repository()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	mode := installer.LuetSearchModeType(r.URL.Query().Get("mode"))
+	switch mode {
+	case "":
+		mode = installer.SRegexPkg
+	case installer.SRegexPkg, installer.SLabel, installer.SRegexLabel:
+	default:
+		http.Error(w, "Invalid search mode "+string(mode), http.StatusBadRequest)
+		return
+	}
+
+	artifacts := map[string]string{}
+	for _, a := range repo.GetIndex() {
+		artifacts[a.GetCompileSpec().GetPackage().GetFingerPrint()] = path.Base(a.GetPath())
+	}
+
+	res := []PackageResult{}
+	for _, m := range (installer.Repositories{repo}).SearchPackages(q, installer.LuetSearchOpts{Pattern: q, Mode: mode}) {
+		res = append(res, PackageResult{
+			Name:       m.Package.GetName(),
+			Category:   m.Package.GetCategory(),
+			Version:    m.Package.GetVersion(),
+			Repository: m.Repo.GetName(),
+			Labels:     m.Package.GetLabels(),
+			Artifact:   artifacts[m.Package.GetFingerPrint()],
+		})
+	}
+
+	writeJSON(w, res)
+}
+
+// handlePublish adds the artifact, metadata, provenance and definition files
+// uploaded as a multipart form to the repository.
+func (s *RepositoryServer) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if !s.Options.Upload || !s.authenticationRequired() {
+		http.Error(w, "Uploads are disabled", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpdir, err := config.LuetCfg.GetSystem().TempDir("upload")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	limit := s.Options.MaxUploadSize
+	if limit <= 0 {
+		limit = DefaultMaxUploadSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		field := part.FormName()
+		if field != "artifact" && field != "metadata" && field != "provenance" && field != "definition" {
+			continue
+		}
+		files[field] = filepath.Join(tmpdir, field)
+		f, err := os.Create(files[field])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, err = io.Copy(f, part)
+		f.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if files["artifact"] == "" || files["metadata"] == "" {
+		http.Error(w, "Both artifact and metadata files are required", http.StatusBadRequest)
+		return
+	}
+
+	// The provenance document, if any, is only read from the upload
+	provenance := files["provenance"]
+	if provenance == "" {
+		provenance = filepath.Join(tmpdir, "provenance")
+	}
+
+	a, err := installer.PublishArtifact(s.Options.Dir, files["artifact"], files["metadata"], provenance, files["definition"])
+	if err != nil {
+		Warning("Failed publishing artifact:", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := a.GetCompileSpec().GetPackage()
+	writeJSON(w, PackageResult{
+		Name:      p.GetName(),
+		Category:  p.GetCategory(),
+		Version:   p.GetVersion(),
+		Labels:    p.GetLabels(),
+		Artifact:  path.Base(a.GetPath()),
+		Checksums: a.GetChecksums(),
+	})
+}
+
+func (s *RepositoryServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Metrics.Snapshot())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		Warning("Failed encoding response:", err.Error())
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/helpers"
+	"github.com/mudler/luet/pkg/installer/client"
+	pkg "github.com/mudler/luet/pkg/package"
+	. "github.com/mudler/luet/pkg/server"
+	. "github.com/mudler/luet/tests/helpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repository server", func() {
+	var dir string
+	var srv *RepositoryServer
+	var ts *httptest.Server
+
+	get := func(url string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+url, nil)
+		Expect(err).ToNot(HaveOccurred())
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		return resp
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "serve")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(FakeRepository(dir, 0, false,
+			&pkg.DefaultPackage{Name: "a", Category: "test", Version: "1.0", Labels: map[string]string{"foo": "bar"}},
+			&pkg.DefaultPackage{Name: "b", Category: "test", Version: "1.0"},
+		)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ts.Close()
+		srv.Close()
+		os.RemoveAll(dir)
+	})
+
+	Context("Without authentication", func() {
+		BeforeEach(func() {
+			srv = NewRepositoryServer(Options{Dir: dir})
+			ts = httptest.NewServer(srv.Handler())
+		})
+
+		It("Serves files with ETags and ranges", func() {
+			resp := get("/repository.yaml", nil)
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			etag := resp.Header.Get("ETag")
+			Expect(etag).ToNot(BeEmpty())
+
+			cached := get("/repository.yaml", map[string]string{"If-None-Match": etag})
+			defer cached.Body.Close()
+			Expect(cached.StatusCode).To(Equal(http.StatusNotModified))
+
+			partial := get("/repository.yaml", map[string]string{"Range": "bytes=0-3"})
+			defer partial.Body.Close()
+			Expect(partial.StatusCode).To(Equal(http.StatusPartialContent))
+			data, err := ioutil.ReadAll(partial.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(data)).To(Equal(4))
+
+			missing := get("/../../etc/passwd", nil)
+			defer missing.Body.Close()
+			Expect(missing.StatusCode).To(Equal(http.StatusNotFound))
+		})
+
+		It("Lists and searches the repository", func() {
+			resp := get("/api/v1/repository", nil)
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			res := RepositoryResult{}
+			Expect(json.NewDecoder(resp.Body).Decode(&res)).ToNot(HaveOccurred())
+			Expect(res.Name).To(Equal("test"))
+			Expect(len(res.Packages)).To(Equal(2))
+
+			search := get("/api/v1/search?q=foo&mode=label", nil)
+			defer search.Body.Close()
+			Expect(search.StatusCode).To(Equal(http.StatusOK))
+			matches := []PackageResult{}
+			Expect(json.NewDecoder(search.Body).Decode(&matches)).ToNot(HaveOccurred())
+			Expect(len(matches)).To(Equal(1))
+			Expect(matches[0].Name).To(Equal("a"))
+			Expect(matches[0].Artifact).To(Equal("a-test-1.0.package.tar"))
+
+			invalid := get("/api/v1/search?q=foo&mode=invalid", nil)
+			defer invalid.Body.Close()
+			Expect(invalid.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Reports metrics", func() {
+			get("/repository.yaml", nil).Body.Close()
+			get("/notexisting", nil).Body.Close()
+
+			resp := get("/api/v1/metrics", nil)
+			defer resp.Body.Close()
+			m := MetricsSnapshot{}
+			Expect(json.NewDecoder(resp.Body).Decode(&m)).ToNot(HaveOccurred())
+			Expect(m.Requests).To(Equal(int64(2)))
+			Expect(m.Status["200"]).To(Equal(int64(1)))
+			Expect(m.Status["404"]).To(Equal(int64(1)))
+			Expect(m.Bytes).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("With authentication", func() {
+		BeforeEach(func() {
+			srv = NewRepositoryServer(Options{Dir: dir, Tokens: []string{"secret"}, BasicAuth: []string{"user:pass"}})
+			ts = httptest.NewServer(srv.Handler())
+		})
+
+		It("Accepts the credentials sent by the http client", func() {
+			resp := get("/repository.yaml", nil)
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+			resp = get("/repository.yaml", map[string]string{"Authorization": "token wrong"})
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+			resp = get("/repository.yaml", map[string]string{"Authorization": "token secret"})
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			req, err := http.NewRequest("GET", ts.URL+"/repository.yaml", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.SetBasicAuth("user", "pass")
+			resp, err = http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("Refuses uploads when not enabled", func() {
+			build, err := ioutil.TempDir("", "build")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(build)
+			c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+			Expect(FakeArtifact(build, c)).ToNot(HaveOccurred())
+
+			err = client.NewHttpClient(client.RepoData{Urls: []string{ts.URL}, Authentication: map[string]string{"token": "secret"}}).
+				Upload(filepath.Join(build, "c-test-1.0.package.tar"), filepath.Join(build, "c-test-1.0.metadata.yaml"), "", "")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("With uploads", func() {
+		BeforeEach(func() {
+			srv = NewRepositoryServer(Options{Dir: dir, Tokens: []string{"secret"}, Upload: true})
+			ts = httptest.NewServer(srv.Handler())
+		})
+
+		It("Publishes artifacts from authenticated clients", func() {
+			build, err := ioutil.TempDir("", "build")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(build)
+			c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+			Expect(FakeArtifact(build, c)).ToNot(HaveOccurred())
+			artifact := filepath.Join(build, "c-test-1.0.package.tar")
+			metadata := filepath.Join(build, "c-test-1.0.metadata.yaml")
+			definition, err := FakeDefinition(build, c)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = client.NewHttpClient(client.RepoData{Urls: []string{ts.URL}}).Upload(artifact, metadata, "", definition)
+			Expect(err).To(HaveOccurred())
+
+			err = client.NewHttpClient(client.RepoData{Urls: []string{ts.URL}, Authentication: map[string]string{"token": "secret"}}).
+				Upload(artifact, metadata, "", definition)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(dir, "c-test-1.0.package.tar"))).To(BeTrue())
+
+			resp := get("/api/v1/repository", map[string]string{"Authorization": "token secret"})
+			defer resp.Body.Close()
+			res := RepositoryResult{}
+			Expect(json.NewDecoder(resp.Body).Decode(&res)).ToNot(HaveOccurred())
+			Expect(res.Revision).To(Equal(2))
+			Expect(len(res.Packages)).To(Equal(3))
+		})
+
+		It("Rejects uploads over the size limit", func() {
+			srv.Options.MaxUploadSize = 512
+			build, err := ioutil.TempDir("", "build")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(build)
+			c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+			Expect(FakeArtifact(build, c)).ToNot(HaveOccurred())
+			definition, err := FakeDefinition(build, c)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = client.NewHttpClient(client.RepoData{Urls: []string{ts.URL}, Authentication: map[string]string{"token": "secret"}}).
+				Upload(filepath.Join(build, "c-test-1.0.package.tar"), filepath.Join(build, "c-test-1.0.metadata.yaml"), "", definition)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("too large"))
+			Expect(helpers.Exists(filepath.Join(dir, "c-test-1.0.package.tar"))).To(BeFalse())
+		})
+
+		It("Publishes the provenance of artifacts", func() {
+			build, err := ioutil.TempDir("", "build")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(build)
+			c := &pkg.DefaultPackage{Name: "c", Category: "test", Version: "1.0"}
+			Expect(FakeArtifact(build, c)).ToNot(HaveOccurred())
+			Expect(FakeProvenance(build, c)).ToNot(HaveOccurred())
+			artifact := filepath.Join(build, "c-test-1.0.package.tar")
+			metadata := filepath.Join(build, "c-test-1.0.metadata.yaml")
+			provenance := filepath.Join(build, "c-test-1.0.provenance.json")
+			definition, err := FakeDefinition(build, c)
+			Expect(err).ToNot(HaveOccurred())
+
+			uploader := client.NewHttpClient(client.RepoData{Urls: []string{ts.URL}, Authentication: map[string]string{"token": "secret"}})
+			Expect(uploader.Upload(artifact, metadata, "", definition)).To(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(dir, "c-test-1.0.package.tar"))).To(BeFalse())
+
+			Expect(uploader.Upload(artifact, metadata, provenance, definition)).ToNot(HaveOccurred())
+			Expect(helpers.Exists(filepath.Join(dir, "c-test-1.0.package.tar"))).To(BeTrue())
+			Expect(helpers.Exists(filepath.Join(dir, "c-test-1.0.provenance.json"))).To(BeTrue())
+		})
+	})
+})
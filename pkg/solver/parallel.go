@@ -471,6 +471,7 @@ func (s *Parallel) UpgradeUniverse(dropremoved bool) (pkg.Packages, PackagesAsse
 			defer wg.Done()
 			for p := range c {
 				available, err := s.DefinitionDatabase.FindPackageVersions(p)
+				available = available.InSlot(p.GetSlot())
 				if len(available) == 0 || err != nil {
 					removed = append(removed, p)
 					continue
@@ -576,6 +577,7 @@ func (s *Parallel) Upgrade(checkconflicts, full bool) (pkg.Packages, PackagesAss
 			for p := range c {
 				installedcopy.CreatePackage(p)
 				packages, err := universe.FindPackageVersions(p)
+				packages = packages.InSlot(p.GetSlot())
 				if err == nil && len(packages) != 0 {
 					best := packages.Best(nil)
 					if !best.Matches(p) {
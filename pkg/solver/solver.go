@@ -414,6 +414,7 @@ func (s *Solver) UpgradeUniverse(dropremoved bool) (pkg.Packages, PackagesAssert
 	// Grab all the installed ones, see if they are eligible for update
 	for _, p := range s.Installed() {
 		available, err := s.DefinitionDatabase.FindPackageVersions(p)
+		available = available.InSlot(p.GetSlot())
 		if len(available) == 0 || err != nil {
 			removed = append(removed, p)
 			continue
@@ -513,6 +514,7 @@ func (s *Solver) Upgrade(checkconflicts, full bool) (pkg.Packages, PackagesAsser
 	for _, p := range s.InstalledDatabase.World() {
 		installedcopy.CreatePackage(p)
 		packages, err := universe.FindPackageVersions(p)
+		packages = packages.InSlot(p.GetSlot())
 		if err == nil && len(packages) != 0 {
 			best := packages.Best(nil)
 			if !best.Matches(p) {
@@ -1147,6 +1147,128 @@ var _ = Describe("Solver", func() {
 
 	})
 
+	Context("Use flags", func() {
+		It("Requires packages only with the use flag enabled", func() {
+			C := pkg.NewPackage("C", "", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			B := pkg.NewPackage("B", "", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			A := pkg.NewPackage("A", "", []*pkg.DefaultPackage{B}, []*pkg.DefaultPackage{})
+			A.RequiresIf(map[string][]*pkg.DefaultPackage{"ssl": {C}})
+
+			for _, p := range []pkg.Package{A, B, C} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			solution, err := s.Install([]pkg.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(PackageAssert{Package: B, Value: true}))
+			Expect(solution).ToNot(ContainElement(PackageAssert{Package: C, Value: true}))
+
+			uses := &pkg.UseFlags{Global: []string{"ssl"}}
+			Expect(uses.ApplyDatabase(dbDefinitions)).ToNot(HaveOccurred())
+
+			solution, err = s.Install([]pkg.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(PackageAssert{Package: B, Value: true}))
+			Expect(solution).To(ContainElement(PackageAssert{Package: C, Value: true}))
+		})
+
+		It("Conflicts with packages only with the use flag enabled", func() {
+			C := pkg.NewPackage("C", "", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			A := pkg.NewPackage("A", "", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			A.SetCategory("test")
+			A.ConflictsIf(map[string][]*pkg.DefaultPackage{"ssl": {C}})
+
+			for _, p := range []pkg.Package{A, C} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err := dbInstalled.CreatePackage(C)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = s.Install([]pkg.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+
+			uses := &pkg.UseFlags{Packages: map[string][]string{"test/A": {"ssl"}}}
+			Expect(uses.ApplyDatabase(dbDefinitions)).ToNot(HaveOccurred())
+
+			solution, err := s.Install([]pkg.Package{A})
+			Expect(len(solution)).To(Equal(0))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Slots", func() {
+		It("Installs versions in different slots side by side", func() {
+			P38 := pkg.NewPackage("python", "3.8.1", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P38.SetCategory("lang")
+			P38.SetSlot("3.8")
+			P39 := pkg.NewPackage("python", "3.9.1", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P39.SetCategory("lang")
+			P39.SetSlot("3.9")
+
+			for _, p := range []pkg.Package{P38, P39} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err := dbInstalled.CreatePackage(P38)
+			Expect(err).ToNot(HaveOccurred())
+
+			solution, err := s.Install([]pkg.Package{P39})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(PackageAssert{Package: P38, Value: true}))
+			Expect(solution).To(ContainElement(PackageAssert{Package: P39, Value: true}))
+		})
+
+		It("Selects the slot asked by requires", func() {
+			P38 := pkg.NewPackage("python", "3.8.1", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P38.SetCategory("lang")
+			P38.SetSlot("3.8")
+			P39 := pkg.NewPackage("python", "3.9.1", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P39.SetCategory("lang")
+			P39.SetSlot("3.9")
+			A := pkg.NewPackage("a", "1.0", []*pkg.DefaultPackage{&pkg.DefaultPackage{Name: "python", Category: "lang", Version: ">=0", Slot: "3.8"}}, []*pkg.DefaultPackage{})
+			A.SetCategory("test")
+
+			for _, p := range []pkg.Package{P38, P39, A} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			solution, err := s.Install([]pkg.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(PackageAssert{Package: A, Value: true}))
+			Expect(solution).To(ContainElement(PackageAssert{Package: P38, Value: true}))
+			Expect(solution).ToNot(ContainElement(PackageAssert{Package: P39, Value: true}))
+		})
+
+		It("Upgrades within the installed slot", func() {
+			P381 := pkg.NewPackage("python", "3.8.1", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P381.SetCategory("lang")
+			P381.SetSlot("3.8")
+			P382 := pkg.NewPackage("python", "3.8.2", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P382.SetCategory("lang")
+			P382.SetSlot("3.8")
+			P39 := pkg.NewPackage("python", "3.9.1", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			P39.SetCategory("lang")
+			P39.SetSlot("3.9")
+
+			for _, p := range []pkg.Package{P382, P39} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err := dbInstalled.CreatePackage(P381)
+			Expect(err).ToNot(HaveOccurred())
+
+			uninstall, solution, err := s.Upgrade(true, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(uninstall)).To(Equal(1))
+			Expect(uninstall[0].GetVersion()).To(Equal("3.8.1"))
+			Expect(solution).To(ContainElement(PackageAssert{Package: P382, Value: true}))
+			Expect(solution).ToNot(ContainElement(PackageAssert{Package: P39, Value: true}))
+		})
+	})
+
 	Context("Complex data sets", func() {
 		It("Solves them correctly", func() {
 			C := pkg.NewPackage("C", "", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
@@ -26,11 +26,15 @@ type DefaultPackageSanitized struct {
 	Name             string                     `json:"name" yaml:"name"`
 	Version          string                     `json:"version" yaml:"version"`
 	Category         string                     `json:"category" yaml:"category"`
+	Slot             string                     `json:"slot,omitempty" yaml:"slot,omitempty"`
 	UseFlags         []string                   `json:"use_flags,omitempty" yaml:"use_flags,omitempty"`
 	PackageRequires  []*DefaultPackageSanitized `json:"requires,omitempty" yaml:"requires,omitempty"`
 	PackageConflicts []*DefaultPackageSanitized `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
 	Provides         []*DefaultPackageSanitized `json:"provides,omitempty" yaml:"provides,omitempty"`
 
+	PackageRequiresIf  map[string][]*DefaultPackageSanitized `json:"requires_if,omitempty" yaml:"requires_if,omitempty"`
+	PackageConflictsIf map[string][]*DefaultPackageSanitized `json:"conflicts_if,omitempty" yaml:"conflicts_if,omitempty"`
+
 	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 
 	// Path is set only internally when tree is loaded from disk
@@ -57,6 +61,7 @@ func NewDefaultPackageSanitized(p pkg.Package) *DefaultPackageSanitized {
 		Name:        p.GetName(),
 		Version:     p.GetVersion(),
 		Category:    p.GetCategory(),
+		Slot:        p.GetSlot(),
 		UseFlags:    p.GetUses(),
 		Hidden:      p.IsHidden(),
 		Path:        p.GetPath(),
@@ -67,30 +72,35 @@ func NewDefaultPackageSanitized(p pkg.Package) *DefaultPackageSanitized {
 		Annotations: p.GetAnnotations(),
 	}
 
-	if p.GetRequires() != nil && len(p.GetRequires()) > 0 {
+	// The requires and conflicts of the enabled use flags are serialized
+	// separately, in the conditional fields
+	requires, conflicts := rawDeps(p)
+	if len(requires) > 0 {
 		ans.PackageRequires = []*DefaultPackageSanitized{}
-		for _, r := range p.GetRequires() {
+		for _, r := range requires {
 			// I avoid recursive call of NewDefaultPackageSanitized
 			ans.PackageRequires = append(ans.PackageRequires,
 				&DefaultPackageSanitized{
 					Name:     r.Name,
 					Version:  r.Version,
 					Category: r.Category,
+					Slot:     r.Slot,
 					Hidden:   r.IsHidden(),
 				},
 			)
 		}
 	}
 
-	if p.GetConflicts() != nil && len(p.GetConflicts()) > 0 {
+	if len(conflicts) > 0 {
 		ans.PackageConflicts = []*DefaultPackageSanitized{}
-		for _, c := range p.GetConflicts() {
+		for _, c := range conflicts {
 			// I avoid recursive call of NewDefaultPackageSanitized
 			ans.PackageConflicts = append(ans.PackageConflicts,
 				&DefaultPackageSanitized{
 					Name:     c.Name,
 					Version:  c.Version,
 					Category: c.Category,
+					Slot:     c.Slot,
 					Hidden:   c.IsHidden(),
 				},
 			)
@@ -112,6 +122,41 @@ func NewDefaultPackageSanitized(p pkg.Package) *DefaultPackageSanitized {
 		}
 	}
 
+	ans.PackageRequiresIf = newConditionalSanitized(p.GetRequiresIf())
+	ans.PackageConflictsIf = newConditionalSanitized(p.GetConflictsIf())
+
+	return ans
+}
+
+// rawDeps returns the requires and conflicts declared by the package, without
+// the ones enabled by its use flags
+func rawDeps(p pkg.Package) ([]*pkg.DefaultPackage, []*pkg.DefaultPackage) {
+	if d, ok := p.(*pkg.DefaultPackage); ok {
+		return d.PackageRequires, d.PackageConflicts
+	}
+	return p.GetRequires(), p.GetConflicts()
+}
+
+// newConditionalSanitized returns the requires or conflicts enabled by the
+// use flags
+func newConditionalSanitized(deps map[string][]*pkg.DefaultPackage) map[string][]*DefaultPackageSanitized {
+	if len(deps) == 0 {
+		return nil
+	}
+	ans := map[string][]*DefaultPackageSanitized{}
+	for use, packs := range deps {
+		for _, d := range packs {
+			ans[use] = append(ans[use],
+				&DefaultPackageSanitized{
+					Name:     d.Name,
+					Version:  d.Version,
+					Category: d.Category,
+					Slot:     d.Slot,
+					Hidden:   d.IsHidden(),
+				},
+			)
+		}
+	}
 	return ans
 }
 
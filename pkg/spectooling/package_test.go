@@ -84,4 +84,57 @@ var _ = Describe("Spec Tooling", func() {
 		})
 
 	})
+
+	Context("Conditional dependencies", func() {
+		It("Keeps the requires and conflicts of the use flags", func() {
+			b := pkg.NewPackage("B", "1.0", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			c := pkg.NewPackage("C", "1.0", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			a := pkg.NewPackage("A", "1.0", []*pkg.DefaultPackage{}, []*pkg.DefaultPackage{})
+			a.RequiresIf(map[string][]*pkg.DefaultPackage{"ssl": {b}})
+			a.ConflictsIf(map[string][]*pkg.DefaultPackage{"static": {c}})
+
+			res := NewDefaultPackageSanitized(a)
+			Expect(res.PackageRequiresIf).To(Equal(map[string][]*DefaultPackageSanitized{
+				"ssl": {{Name: "B", Version: "1.0"}},
+			}))
+			Expect(res.PackageConflictsIf).To(Equal(map[string][]*DefaultPackageSanitized{
+				"static": {{Name: "C", Version: "1.0"}},
+			}))
+
+			data, err := res.Yaml()
+			Expect(err).ToNot(HaveOccurred())
+			p, err := pkg.DefaultPackageFromYaml(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.GetRequiresIf()["ssl"][0].GetName()).To(Equal("B"))
+			Expect(p.GetConflictsIf()["static"][0].GetName()).To(Equal("C"))
+		})
+
+		It("Writes back the declared requires when use flags are enabled", func() {
+			definition := []byte(`
+name: "A"
+version: "1.0"
+use_flags:
+- ssl
+requires:
+- name: "B"
+  version: "1.0"
+requires_if:
+  ssl:
+  - name: "C"
+    version: "1.0"
+`)
+			a, err := pkg.DefaultPackageFromYaml(definition)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(a.GetRequires())).To(Equal(2))
+
+			data, err := NewDefaultPackageSanitized(&a).Yaml()
+			Expect(err).ToNot(HaveOccurred())
+			p, err := pkg.DefaultPackageFromYaml(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.PackageRequires).To(HaveLen(1))
+			Expect(p.PackageRequires[0].GetName()).To(Equal("B"))
+			Expect(p.GetRequiresIf()["ssl"][0].GetName()).To(Equal("C"))
+			Expect(len(p.GetRequires())).To(Equal(2))
+		})
+	})
 })
@@ -0,0 +1,177 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/pkg/errors"
+)
+
+const (
+	CompactTreeFile = "tree.json"
+)
+
+// CompactTree is a single file representation of an installer tree, which can be
+// loaded without walking and parsing each definition file.
+type CompactTree struct {
+	Packages []*pkg.DefaultPackage `json:"packages"`
+
+	// Finalizers are indexed by the package directory, relative to the tree
+	// root, with the same layout used by InstallerRecipe.Save
+	Finalizers map[string]string `json:"finalizers,omitempty"`
+}
+
+// CompactTreeDir returns the directory of the package, relative to the tree root.
+func CompactTreeDir(p pkg.Package) string {
+	return path.Join(p.GetCategory(), p.GetName(), p.GetVersion())
+}
+
+func NewCompactTree(db pkg.PackageDatabase) (*CompactTree, error) {
+	t := &CompactTree{Packages: []*pkg.DefaultPackage{}, Finalizers: map[string]string{}}
+
+	for _, p := range db.World() {
+		// Copy the package, the path is relative to where the tree is unpacked
+		dp := *p.(*pkg.DefaultPackage)
+		dp.SetPath("")
+		t.Packages = append(t.Packages, &dp)
+
+		finalizerPath := p.Rel(FinalizerFile)
+		if p.GetPath() != "" && helpers.Exists(finalizerPath) && !p.HasAnnotation(string(pkg.SubpackageAnnotation)) {
+			dat, err := ioutil.ReadFile(finalizerPath)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading file "+finalizerPath)
+			}
+			t.Finalizers[CompactTreeDir(p)] = string(dat)
+		}
+	}
+	return t, nil
+}
+
+func NewCompactTreeFromFile(file string) (*CompactTree, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	t := &CompactTree{}
+	err = json.Unmarshal(dat, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading compact tree "+file)
+	}
+	if t.Finalizers == nil {
+		t.Finalizers = map[string]string{}
+	}
+	return t, nil
+}
+
+func (t *CompactTree) WriteFile(file string) error {
+	// Selectors must not be escaped, as for DefaultPackage.JSON()
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(t)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buffer.Bytes(), 0644)
+}
+
+// SetPackage adds or replaces the package stored in the given directory.
+func (t *CompactTree) SetPackage(dir string, p *pkg.DefaultPackage) {
+	t.RemovePackage(dir)
+	p.SetPath("")
+	t.Packages = append(t.Packages, p)
+}
+
+// RemovePackage removes the package stored in the given directory.
+func (t *CompactTree) RemovePackage(dir string) {
+	packs := []*pkg.DefaultPackage{}
+	for _, p := range t.Packages {
+		if CompactTreeDir(p) != dir {
+			packs = append(packs, p)
+		}
+	}
+	t.Packages = packs
+}
+
+// LoadCompact loads a compact tree file. Packages are placed in the directory
+// of the file, where nothing is written until their finalizer is requested
+// with Finalizer.
+func (r *InstallerRecipe) LoadCompact(file string) error {
+	t, err := NewCompactTreeFromFile(file)
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Dir(file)
+	r.SourcePath = append(r.SourcePath, root)
+	if r.finalizers == nil {
+		r.finalizers = map[string]string{}
+	}
+
+	for _, p := range t.Packages {
+		dir := filepath.Join(root, filepath.FromSlash(CompactTreeDir(p)))
+
+		if finalizer, ok := t.Finalizers[CompactTreeDir(p)]; ok {
+			r.finalizers[dir] = finalizer
+		} else if helpers.Exists(filepath.Join(dir, FinalizerFile)) {
+			// Left by a previous load of the tree
+			os.Remove(filepath.Join(dir, FinalizerFile))
+		}
+
+		p.SetPath(dir)
+		_, err = r.Database.CreatePackage(p)
+		if err != nil {
+			return errors.Wrap(err, "Error creating package "+p.GetName())
+		}
+	}
+	return nil
+}
+
+// Finalizer returns the path of the finalizer of the package. The finalizers
+// of packages loaded from a compact tree are written along their definition,
+// so they can be rendered.
+func (r *InstallerRecipe) Finalizer(p pkg.Package) (string, error) {
+	finalizer, ok := r.finalizers[p.GetPath()]
+	if !ok {
+		return p.Rel(FinalizerFile), nil
+	}
+
+	err := os.MkdirAll(p.GetPath(), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	data, err := p.Yaml()
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(p.Rel(DefinitionFile), data, 0644)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(p.Rel(FinalizerFile), []byte(finalizer), 0644)
+	if err != nil {
+		return "", err
+	}
+	return p.Rel(FinalizerFile), nil
+}
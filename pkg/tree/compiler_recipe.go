@@ -92,7 +92,7 @@ func (r *CompilerRecipe) Load(path string) error {
 			compileDefPath := pack.Rel(CompilerDefinitionFile)
 			if helpers.Exists(compileDefPath) {
 
-				dat, err := helpers.RenderFiles(compileDefPath, currentpath, "")
+				dat, err := helpers.RenderFilesWithDefaults(compileDefPath, currentpath, pkg.UseValues(&pack))
 				if err != nil {
 					return errors.Wrap(err,
 						"Error templating file "+CompilerDefinitionFile+" from "+
@@ -107,6 +107,8 @@ func (r *CompilerRecipe) Load(path string) error {
 				}
 				pack.Requires(packbuild.GetRequires())
 				pack.Conflicts(packbuild.GetConflicts())
+				pack.RequiresIf(packbuild.GetRequiresIf())
+				pack.ConflictsIf(packbuild.GetConflictsIf())
 			}
 
 			_, err = r.Database.CreatePackage(&pack)
@@ -114,6 +116,25 @@ func (r *CompilerRecipe) Load(path string) error {
 				return errors.Wrap(err, "Error creating package "+pack.GetName())
 			}
 
+			// Subpackages are built along with the package they are split from
+			subpackages, err := ReadSubpackages(&pack)
+			if err != nil {
+				return err
+			}
+			for _, sub := range subpackages {
+				// Subpackages depend only on their parent in the build graph,
+				// their runtime requires and conflicts are in the installer tree
+				parent := pack
+				sub.Requires([]*pkg.DefaultPackage{&parent})
+				sub.Conflicts([]*pkg.DefaultPackage{})
+				sub.RequiresIf(nil)
+				sub.ConflictsIf(nil)
+				_, err = r.Database.CreatePackage(sub)
+				if err != nil {
+					return errors.Wrap(err, "Error creating package "+sub.GetName())
+				}
+			}
+
 		case CollectionFile:
 			dat, err := ioutil.ReadFile(currentpath)
 			if err != nil {
@@ -137,7 +158,7 @@ func (r *CompilerRecipe) Load(path string) error {
 					if err != nil {
 						return errors.Wrap(err, "Error reading file "+currentpath)
 					}
-					dat, err := helpers.RenderHelm(string(buildyaml), raw, map[string]interface{}{})
+					dat, err := helpers.RenderHelm(string(buildyaml), raw, pkg.UseValues(&pack))
 					if err != nil {
 						return errors.Wrap(err,
 							"Error templating file "+CompilerDefinitionFile+" from "+
@@ -152,6 +173,8 @@ func (r *CompilerRecipe) Load(path string) error {
 					}
 					pack.Requires(packbuild.GetRequires())
 					pack.Conflicts(packbuild.GetConflicts())
+					pack.RequiresIf(packbuild.GetRequiresIf())
+					pack.ConflictsIf(packbuild.GetConflictsIf())
 				}
 
 				_, err = r.Database.CreatePackage(&pack)
@@ -43,6 +43,10 @@ func NewInstallerRecipe(db pkg.PackageDatabase) Builder {
 type InstallerRecipe struct {
 	SourcePath []string
 	Database   pkg.PackageDatabase
+
+	// finalizers of the packages loaded from a compact tree, indexed by
+	// the package directory
+	finalizers map[string]string
 }
 
 func (r *InstallerRecipe) Save(path string) error {
@@ -60,8 +64,12 @@ func (r *InstallerRecipe) Save(path string) error {
 			return err
 		}
 		// Instead of rdeps, have a different tree for build deps.
-		finalizerPath := p.Rel(FinalizerFile)
-		if helpers.Exists(finalizerPath) { // copy finalizer file from the source tree
+		// Subpackages share the folder of their parent, but not its finalizer
+		finalizerPath, err := r.Finalizer(p)
+		if err != nil {
+			return err
+		}
+		if helpers.Exists(finalizerPath) && !p.HasAnnotation(string(pkg.SubpackageAnnotation)) { // copy finalizer file from the source tree
 			helpers.CopyFile(finalizerPath, filepath.Join(dir, FinalizerFile))
 		}
 
@@ -77,6 +85,11 @@ func (r *InstallerRecipe) Load(path string) error {
 		))
 	}
 
+	// Trees synced in the compact format are loaded directly
+	if helpers.Exists(filepath.Join(path, CompactTreeFile)) {
+		return r.LoadCompact(filepath.Join(path, CompactTreeFile))
+	}
+
 	r.SourcePath = append(r.SourcePath, path)
 
 	//r.Tree().SetPackageSet(pkg.NewBoltDatabase(tmpfile.Name()))
@@ -108,6 +121,17 @@ func (r *InstallerRecipe) Load(path string) error {
 				return errors.Wrap(err, "Error creating package "+pack.GetName())
 			}
 
+			subpackages, err := ReadSubpackages(&pack)
+			if err != nil {
+				return err
+			}
+			for _, sub := range subpackages {
+				_, err = r.Database.CreatePackage(sub)
+				if err != nil {
+					return errors.Wrap(err, "Error creating package "+sub.GetName())
+				}
+			}
+
 		case CollectionFile:
 			packs, err := pkg.DefaultPackagesFromYaml(dat)
 			if err != nil {
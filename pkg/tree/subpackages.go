@@ -0,0 +1,78 @@
+// Copyright © 2020 Ettore Di Giacinto <mudler@gentoo.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package tree
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	"github.com/mudler/luet/pkg/helpers"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/pkg/errors"
+)
+
+// subpackagesKey is looked up in the build specs before rendering them, so
+// only the ones declaring subpackages are rendered while loading a tree
+const subpackagesKey = "subpackages:"
+
+type subpackagesSpec struct {
+	Subpackages []pkg.DefaultPackage `json:"subpackages"`
+}
+
+// ReadSubpackages returns the packages split from the build of parent, which
+// are declared in the subpackages section of its build spec. They inherit the
+// category, the version and the path of parent.
+func ReadSubpackages(parent pkg.Package) ([]*pkg.DefaultPackage, error) {
+	buildFile := parent.Rel(CompilerDefinitionFile)
+	if !helpers.Exists(buildFile) {
+		return nil, nil
+	}
+	raw, err := ioutil.ReadFile(buildFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading file "+buildFile)
+	}
+	if !bytes.Contains(raw, []byte(subpackagesKey)) {
+		return nil, nil
+	}
+
+	dat, err := helpers.RenderFilesWithDefaults(buildFile, parent.Rel(DefinitionFile), pkg.UseValues(parent))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error templating file "+buildFile)
+	}
+	var spec subpackagesSpec
+	if err := yaml.Unmarshal([]byte(dat), &spec); err != nil {
+		return nil, errors.Wrap(err, "Error reading subpackages from "+buildFile)
+	}
+
+	subpackages := []*pkg.DefaultPackage{}
+	for i := range spec.Subpackages {
+		sub := spec.Subpackages[i]
+		if sub.Name == "" {
+			return nil, errors.New("Subpackage without name in " + buildFile)
+		}
+		if sub.Category == "" {
+			sub.Category = parent.GetCategory()
+		}
+		if sub.Version == "" {
+			sub.Version = parent.GetVersion()
+		}
+		sub.SetPath(parent.GetPath())
+		sub.AddAnnotation(string(pkg.SubpackageAnnotation), parent.GetFingerPrint())
+		subpackages = append(subpackages, &sub)
+	}
+	return subpackages, nil
+}
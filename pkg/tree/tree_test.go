@@ -23,11 +23,13 @@ package tree_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/mudler/luet/pkg/helpers"
 	pkg "github.com/mudler/luet/pkg/package"
 	"github.com/mudler/luet/pkg/solver"
 	. "github.com/mudler/luet/pkg/tree"
@@ -185,4 +187,78 @@ var _ = Describe("Tree", func() {
 		})
 	})
 
+	Context("Tree with subpackages", func() {
+		It("Reads the subpackages from the build specs", func() {
+			generalRecipe := NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			err := generalRecipe.Load("../../tests/fixtures/subpackages")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(generalRecipe.GetDatabase().World())).To(Equal(4))
+
+			foo, err := generalRecipe.GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "foo", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			doc, err := generalRecipe.GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "foo-doc", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.GetDescription()).To(Equal("Documentation of foo"))
+			Expect(doc.GetPath()).To(Equal(foo.GetPath()))
+			Expect(doc.GetAnnotations()).To(HaveKeyWithValue(string(pkg.SubpackageAnnotation), "foo-test-1.0"))
+
+			// Subpackages are built along with their parent, and keep their own
+			// requires and conflicts only at runtime
+			Expect(len(doc.GetRequires())).To(Equal(1))
+			Expect(doc.GetRequires()[0].GetName()).To(Equal("foo"))
+			Expect(len(doc.GetConflicts())).To(Equal(0))
+
+			installerRecipe := NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+			err = installerRecipe.Load("../../tests/fixtures/subpackages")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(installerRecipe.GetDatabase().World())).To(Equal(4))
+			doc, err = installerRecipe.GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "foo-doc", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(doc.GetRequires())).To(Equal(1))
+			Expect(doc.GetRequires()[0].GetName()).To(Equal("foo-dev"))
+			Expect(len(doc.GetConflicts())).To(Equal(1))
+			Expect(doc.GetConflicts()[0].GetName()).To(Equal("bar"))
+		})
+	})
+
+	Context("Compact tree", func() {
+		It("writes and reads back the same tree with finalizers", func() {
+			tmpdir, err := ioutil.TempDir("", "compact")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			generalRecipe := NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+			err = generalRecipe.Load("../../tests/fixtures/buildableseed")
+			Expect(err).ToNot(HaveOccurred())
+			err = generalRecipe.Load("../../tests/fixtures/finalizers")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(generalRecipe.GetDatabase().World())).To(Equal(5))
+
+			compact, err := NewCompactTree(generalRecipe.GetDatabase())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(compact.Finalizers)).To(Equal(1))
+			Expect(compact.WriteFile(filepath.Join(tmpdir, CompactTreeFile))).ToNot(HaveOccurred())
+
+			loaded := NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+			err = loaded.Load(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(loaded.GetDatabase().World())).To(Equal(5))
+
+			D, err := loaded.GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "d", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(D.GetPath()).To(Equal(filepath.Join(tmpdir, "test", "d", "1.0")))
+			Expect(helpers.Exists(D.Rel(DefinitionFile))).To(BeFalse())
+
+			alpine, err := loaded.GetDatabase().FindPackage(&pkg.DefaultPackage{Name: "alpine", Category: "seed", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(helpers.Exists(alpine.Rel(FinalizerFile))).To(BeFalse())
+
+			finalizer, err := loaded.(*InstallerRecipe).Finalizer(alpine)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(finalizer).To(Equal(alpine.Rel(FinalizerFile)))
+			Expect(helpers.Exists(alpine.Rel(FinalizerFile))).To(BeTrue())
+			Expect(helpers.Exists(alpine.Rel(DefinitionFile))).To(BeTrue())
+		})
+	})
+
 })
@@ -0,0 +1,107 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/installer"
+	pkg "github.com/mudler/luet/pkg/package"
+	"github.com/mudler/luet/pkg/tree"
+)
+
+// FakeRepository writes a repository in dst with an artifact for each
+// package, without requiring a backend to build them.
+func FakeRepository(dst string, deltas int, compact bool, packs ...*pkg.DefaultPackage) error {
+	treeDir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(treeDir)
+
+	db := pkg.NewInMemoryDatabase(false)
+	for _, p := range packs {
+		_, err := db.CreatePackage(p)
+		if err != nil {
+			return err
+		}
+
+		err = FakeArtifact(dst, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tree.NewInstallerRecipe(db).Save(treeDir)
+	if err != nil {
+		return err
+	}
+
+	repo, err := installer.GenerateRepository("test", "description", "disk", []string{dst}, 1, dst, []string{treeDir}, pkg.NewInMemoryDatabase(false))
+	if err != nil {
+		return err
+	}
+	repo.SetDeltaRevisions(deltas)
+	if compact {
+		repo.SetRepositoryFile(installer.REPOFILE_COMPACT_TREE_KEY, installer.NewDefaultCompactTreeRepositoryFile())
+	}
+	return repo.Write(dst, false)
+}
+
+// FakeArtifact writes in dst an artifact of the package, along with its
+// metadata file. The artifact contains the given files, or one named after
+// the package if none is given.
+func FakeArtifact(dst string, p *pkg.DefaultPackage, files ...string) error {
+	content, err := ioutil.TempDir("", "content")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(content)
+	if len(files) == 0 {
+		files = []string{p.GetName()}
+	}
+	for _, f := range files {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(content, f)), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(content, f), []byte(p.GetVersion()), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	a := compiler.NewPackageArtifact(filepath.Join(dst, p.GetArtifactFingerPrint()+".package.tar"))
+	a.SetCompileSpec(&compiler.LuetCompilationSpec{Package: p})
+	err = a.Compress(content, 1)
+	if err != nil {
+		return err
+	}
+	return a.WriteYaml(dst)
+}
+
+// FakeProvenance writes a provenance document for the artifact of the package
+// written by FakeArtifact in dst, and references it from the metadata file.
+func FakeProvenance(dst string, p *pkg.DefaultPackage) error {
+	ref, err := (&compiler.Provenance{}).Write(filepath.Join(dst, p.GetArtifactFingerPrint()+".provenance.json"))
+	if err != nil {
+		return err
+	}
+
+	a := compiler.NewPackageArtifact(filepath.Join(dst, p.GetArtifactFingerPrint()+".package.tar"))
+	a.SetCompileSpec(&compiler.LuetCompilationSpec{Package: p})
+	a.SetProvenance(ref)
+	return a.WriteYaml(dst)
+}
+
+// FakeDefinition writes in dst the definition of the package, as found in the
+// source tree, and returns its path.
+func FakeDefinition(dst string, p *pkg.DefaultPackage) (string, error) {
+	data, err := p.Yaml()
+	if err != nil {
+		return "", err
+	}
+	definition := filepath.Join(dst, p.GetFingerPrint()+".definition.yaml")
+	return definition, ioutil.WriteFile(definition, data, 0644)
+}